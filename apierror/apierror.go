@@ -0,0 +1,38 @@
+// Package apierror writes the JSON error envelope every endpoint answers with:
+//
+//	{"error": {"code": "...", "message": "...", "details": {...}, "request_id": "..."}}
+//
+// code is a stable, machine-readable string clients can branch on; message is
+// meant for people and may change.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error is the body of the envelope.
+type Error struct {
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	Details    interface{} `json:"details,omitempty"`
+	Request_id string      `json:"request_id,omitempty"`
+}
+
+// RequestID returns the id the RequestID middleware stored in the request
+// context, or "" when the request did not pass through it.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value("requestID").(string)
+	return id
+}
+
+// Write sends status with an envelope built from code, message and details.
+// details may be nil.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error Error `json:"error"`
+	}{Error{Code: code, Message: message, Details: details, Request_id: RequestID(r)}})
+}
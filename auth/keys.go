@@ -0,0 +1,207 @@
+// Package auth holds the keys access tokens are signed and verified with.
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"my-go-project/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// HMACKeyID is the kid of the single key used when no key directory is
+// configured.
+const HMACKeyID = "hmac"
+
+// minRSABits is the smallest RSA modulus accepted for signing or verifying.
+const minRSABits = 2048
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{} // nil for verify-only keys
+	public  interface{}
+	// notBefore is when the key may start signing; retireAt, when set, is
+	// when it stops verifying.
+	notBefore time.Time
+	retireAt  time.Time
+}
+
+func (k *key) retired(now time.Time) bool {
+	return !k.retireAt.IsZero() && !now.Before(k.retireAt)
+}
+
+// KeyManager signs tokens with the newest active key and verifies them with
+// any key that is not retired, so tokens signed with a key that was just
+// rotated out keep working until they expire. Verification only accepts the
+// algorithms of the loaded keys, and a token must use the algorithm of the
+// key its kid names.
+type KeyManager struct {
+	keys    map[string]*key
+	methods []string
+	now     func() time.Time
+}
+
+// NewHMACKeyManager signs and verifies with a shared HS256 secret. It is meant
+// for development; its key is never published in the JWKS.
+func NewHMACKeyManager(secret []byte) *KeyManager {
+	k := &key{id: HMACKeyID, method: jwt.SigningMethodHS256, private: secret, public: secret}
+	return &KeyManager{keys: map[string]*key{k.id: k}, methods: []string{k.method.Alg()}, now: time.Now}
+}
+
+// LoadKeyManager reads every PEM file in dir. A file's name without its
+// extension is the key's kid: "<kid>.pem" holds a PKCS#8 (or PKCS#1 RSA)
+// private key, "<kid>.pub.pem" a PKIX public key that is only used to verify.
+// RSA keys sign with RS256 and Ed25519 keys with EdDSA. schedule sets when
+// each key activates and retires; only scheduled private keys sign, and one
+// of them must be active now.
+func LoadKeyManager(dir string, schedule []config.SigningKey) (*KeyManager, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &KeyManager{keys: map[string]*key{}, now: time.Now}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		k, err := loadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("load signing key %s: %w", path, err)
+		}
+		if _, dup := m.keys[k.id]; dup {
+			return nil, fmt.Errorf("duplicate signing key id %q in %s", k.id, dir)
+		}
+		m.keys[k.id] = k
+		if alg := k.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			m.methods = append(m.methods, alg)
+		}
+	}
+	sort.Strings(m.methods)
+
+	scheduled := map[string]bool{}
+	for _, s := range schedule {
+		k, ok := m.keys[s.KID]
+		if !ok {
+			return nil, fmt.Errorf("scheduled signing key %q not found in %s", s.KID, dir)
+		}
+		k.notBefore, k.retireAt = s.NotBefore, s.RetireAt
+		scheduled[k.id] = true
+	}
+	// unscheduled private keys only verify
+	for id, k := range m.keys {
+		if !scheduled[id] {
+			k.private = nil
+		}
+	}
+	if m.signingKey(m.now()) == nil {
+		return nil, fmt.Errorf("no signing key in %s is active now", dir)
+	}
+	return m, nil
+}
+
+// signingKey is the private key with the latest notBefore that has passed,
+// ties going to the greater kid, or nil if none is active at now.
+func (m *KeyManager) signingKey(now time.Time) *key {
+	var newest *key
+	for _, k := range m.keys {
+		if k.private == nil || now.Before(k.notBefore) || k.retired(now) {
+			continue
+		}
+		if newest == nil || k.notBefore.After(newest.notBefore) ||
+			(k.notBefore.Equal(newest.notBefore) && k.id > newest.id) {
+			newest = k
+		}
+	}
+	return newest
+}
+
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	name := filepath.Base(path)
+	k := &key{}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		k.id = strings.TrimSuffix(name, ".pem")
+		k.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		k.id = strings.TrimSuffix(name, ".pem")
+		k.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		k.id = strings.TrimSuffix(name, ".pub.pem")
+		k.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := k.private.(crypto.Signer); ok {
+		k.public = signer.Public()
+	}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key is %d bits, need at least %d", pub.N.BitLen(), minRSABits)
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", k.public)
+	}
+	return k, nil
+}
+
+// Sign issues a token for claims with the newest active key, naming it in the
+// kid header.
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	k := m.signingKey(m.now())
+	if k == nil {
+		return "", errors.New("no signing key is active")
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.private)
+}
+
+// Parse verifies tokenString into claims.
+func (m *KeyManager) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, m.keyFunc, jwt.WithValidMethods(m.methods))
+}
+
+func (m *KeyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if k.retired(m.now()) {
+		return nil, fmt.Errorf("signing key %q is retired", kid)
+	}
+	// the allow-list alone would let an RS256 token name an EdDSA key
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("signing key %q does not use %s", kid, token.Method.Alg())
+	}
+	return k.public, nil
+}
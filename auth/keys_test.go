@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"my-go-project/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKey(t *testing.T, dir, kid string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signedKID(t *testing.T, m *KeyManager) (string, string) {
+	t.Helper()
+	token, err := m.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return token, kid
+}
+
+func publishedKIDs(m *KeyManager) []string {
+	var kids []string
+	for _, k := range m.JWKS().Keys {
+		kids = append(kids, k.Kid)
+	}
+	return kids
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	for _, kid := range []string{"2026-09", "2026-10", "2026-11"} {
+		writeKey(t, dir, kid)
+	}
+	oct := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	nov := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	schedule := []config.SigningKey{
+		{KID: "2026-09", RetireAt: oct.Add(time.Hour)},
+		{KID: "2026-10", NotBefore: oct},
+		{KID: "2026-11", NotBefore: nov},
+	}
+
+	m, err := LoadKeyManager(dir, schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := oct.Add(-time.Minute)
+	m.now = func() time.Time { return clock }
+
+	oldToken, kid := signedKID(t, m)
+	if kid != "2026-09" {
+		t.Fatalf("signed with %q before October, want 2026-09", kid)
+	}
+	if got := publishedKIDs(m); len(got) != 3 {
+		t.Fatalf("published %v, want all three keys", got)
+	}
+
+	// the October key takes over, and the September one still verifies
+	clock = oct.Add(time.Minute)
+	if _, kid := signedKID(t, m); kid != "2026-10" {
+		t.Fatalf("signed with %q in October, want 2026-10", kid)
+	}
+	if _, err := m.Parse(oldToken, &jwt.RegisteredClaims{}); err != nil {
+		t.Fatalf("token of the rotated-out key: %v", err)
+	}
+
+	// once retired, the September key neither verifies nor is published
+	clock = oct.Add(time.Hour)
+	if _, err := m.Parse(oldToken, &jwt.RegisteredClaims{}); err == nil {
+		t.Fatal("token of a retired key verified")
+	}
+	if got := publishedKIDs(m); len(got) != 2 || got[0] != "2026-10" || got[1] != "2026-11" {
+		t.Fatalf("published %v, want [2026-10 2026-11]", got)
+	}
+
+	clock = nov
+	if _, kid := signedKID(t, m); kid != "2026-11" {
+		t.Fatalf("signed with %q in November, want 2026-11", kid)
+	}
+}
+
+func TestLoadKeyManagerSchedule(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2026-10")
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		schedule []config.SigningKey
+		wantErr  bool
+	}{
+		{"active key", []config.SigningKey{{KID: "2026-10"}}, false},
+		{"unknown key", []config.SigningKey{{KID: "2026-10"}, {KID: "2027-01"}}, true},
+		{"nothing scheduled", nil, true},
+		{"only an upcoming key", []config.SigningKey{{KID: "2026-10", NotBefore: future}}, true},
+		{"only a retired key", []config.SigningKey{{KID: "2026-10", RetireAt: time.Now().Add(-time.Hour)}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeyManager(dir, tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
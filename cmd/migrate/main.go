@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"my-go-project/config"
+	"my-go-project/db"
+	"my-go-project/migrations"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n applied migrations (default 1)
+  status      list migrations and whether they are applied`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	dbCfg, err := config.LoadDatabase()
+	if err != nil {
+		log.Fatal("failed to load config: ", err)
+	}
+
+	dbPool, err := db.ConnectDB(dbCfg)
+	if err != nil {
+		log.Fatal("failed to connect with db", err)
+	}
+	defer dbPool.Close()
+
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "up":
+		n, err := migrations.Up(ctx, dbPool)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("✅ applied %d migration(s)\n", n)
+
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps <= 0 {
+				log.Fatalf("invalid step count %q", os.Args[2])
+			}
+		}
+		n, err := migrations.Down(ctx, dbPool, steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("✅ rolled back %d migration(s)\n", n)
+
+	case "status":
+		statuses, err := migrations.List(ctx, dbPool)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,611 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"my-go-project/money"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the server needs at startup.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	JWT       JWTConfig       `yaml:"jwt" toml:"jwt"`
+	CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+	Payments  PaymentsConfig  `yaml:"payments" toml:"payments"`
+	Inventory InventoryConfig `yaml:"inventory" toml:"inventory"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Images    ImagesConfig    `yaml:"images" toml:"images"`
+	Shipping  ShippingConfig  `yaml:"shipping" toml:"shipping"`
+	Tax       TaxConfig       `yaml:"tax" toml:"tax"`
+	GuestCart GuestCartConfig `yaml:"guest_cart" toml:"guest_cart"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port" toml:"port"`
+	// Environment is "production", "development" or "test". Only development
+	// and test may use the fake payment provider.
+	Environment string `yaml:"environment" toml:"environment"`
+}
+
+type DatabaseConfig struct {
+	URL string `yaml:"url" toml:"url"`
+	// QueryTimeout bounds each repository call; 0 disables the limit.
+	QueryTimeout time.Duration `yaml:"query_timeout" toml:"query_timeout"`
+}
+
+type JWTConfig struct {
+	// Secret signs HS256 tokens when KeysDir is empty.
+	Secret string `yaml:"secret" toml:"secret"`
+	// KeysDir holds the RS256/EdDSA key files; Keys schedules when each one
+	// starts signing and stops verifying.
+	KeysDir string       `yaml:"keys_dir" toml:"keys_dir"`
+	Keys    []SigningKey `yaml:"keys" toml:"keys"`
+	// TTL is the lifetime of access tokens; keep it short and let clients
+	// use their refresh token.
+	TTL        time.Duration `yaml:"ttl" toml:"ttl"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" toml:"refresh_ttl"`
+}
+
+// SigningKey schedules the key of KeysDir named KID. Of the private keys whose
+// NotBefore has passed, the newest signs; every key verifies until RetireAt,
+// and a zero RetireAt never retires it.
+type SigningKey struct {
+	KID       string    `yaml:"kid" toml:"kid"`
+	NotBefore time.Time `yaml:"not_before" toml:"not_before"`
+	RetireAt  time.Time `yaml:"retire_at" toml:"retire_at"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+}
+
+type PaymentsConfig struct {
+	// Provider selects the PaymentProvider. "fake" is the only one that ships
+	// today and charges nothing, so it is refused in production.
+	Provider string `yaml:"provider" toml:"provider"`
+	// Currency is the one the provider settles in; orders priced in another
+	// currency cannot be paid.
+	Currency string `yaml:"currency" toml:"currency"`
+	// VaultKey is the base64 encoded 32-byte AES key of the local card vault.
+	VaultKey string `yaml:"vault_key" toml:"vault_key"`
+	// VaultPath is the file the local card vault is kept in.
+	VaultPath string `yaml:"vault_path" toml:"vault_path"`
+}
+
+type InventoryConfig struct {
+	// HoldTTL is how long a pending order keeps its stock reserved before it
+	// is cancelled and the stock goes back on sale.
+	HoldTTL time.Duration `yaml:"hold_ttl" toml:"hold_ttl"`
+	// SweepInterval is how often expired holds are looked for.
+	SweepInterval time.Duration `yaml:"sweep_interval" toml:"sweep_interval"`
+}
+
+type GuestCartConfig struct {
+	// TTL is how long a guest cart lives after it is started; its guest token
+	// expires with it.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+	// SweepInterval is how often expired guest carts are deleted.
+	SweepInterval time.Duration `yaml:"sweep_interval" toml:"sweep_interval"`
+	// Merge decides the quantity of a product that is in both the guest cart
+	// and the user's cart at login: "sum" adds them up, "max" keeps the larger,
+	// "user" keeps the user's and "guest" takes the guest's. What the guest
+	// cart adds never exceeds the stock on hand.
+	Merge string `yaml:"merge" toml:"merge"`
+}
+
+type StorageConfig struct {
+	// Backend is "local", files under LocalDir served by the API itself, or
+	// "s3" for an S3-compatible bucket.
+	Backend  string `yaml:"backend" toml:"backend"`
+	LocalDir string `yaml:"local_dir" toml:"local_dir"`
+	// PublicURL is the base of the links handed to clients, e.g. a CDN. It
+	// defaults to /media for local storage and to the bucket URL for s3.
+	PublicURL string   `yaml:"public_url" toml:"public_url"`
+	S3        S3Config `yaml:"s3" toml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	Region          string `yaml:"region" toml:"region"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
+	// PathStyle addresses objects as endpoint/bucket/key, as MinIO expects.
+	PathStyle bool `yaml:"path_style" toml:"path_style"`
+}
+
+type ImagesConfig struct {
+	// MaxUploadBytes caps the size of one uploaded image file.
+	MaxUploadBytes int64 `yaml:"max_upload_bytes" toml:"max_upload_bytes"`
+	// MaxPixels caps width x height, so a small file cannot decode into a
+	// huge bitmap.
+	MaxPixels int `yaml:"max_pixels" toml:"max_pixels"`
+}
+
+type ShippingConfig struct {
+	// Rates are the shipping methods on offer. With none, orders ship free.
+	Rates []ShippingRate `yaml:"rates" toml:"rates"`
+}
+
+// ShippingRate is one shipping method. Amounts are minor units of Currency.
+// A flat rate costs Amount; a weight rate costs Amount plus PerKg for every
+// started kilogram; a free_over rate costs Amount unless the discounted
+// merchandise reaches Threshold.
+type ShippingRate struct {
+	Method string `yaml:"method" toml:"method"`
+	Name   string `yaml:"name" toml:"name"`
+	Kind   string `yaml:"kind" toml:"kind"`
+	// Countries are the ISO 3166-1 alpha-2 codes the method ships to; empty
+	// means everywhere.
+	Countries []string `yaml:"countries" toml:"countries"`
+	Currency  string   `yaml:"currency" toml:"currency"`
+	Amount    int64    `yaml:"amount" toml:"amount"`
+	PerKg     int64    `yaml:"per_kg" toml:"per_kg"`
+	Threshold int64    `yaml:"threshold" toml:"threshold"`
+}
+
+type TaxConfig struct {
+	// ShippingTaxable taxes the shipping charge along with the goods.
+	ShippingTaxable bool `yaml:"shipping_taxable" toml:"shipping_taxable"`
+	// Rates is the rate table. Every rate of the destination country whose
+	// Region is empty or the destination's applies.
+	Rates []TaxRate `yaml:"rates" toml:"rates"`
+}
+
+// TaxRate is a tax of Percent (up to two decimals) on orders shipped to
+// Country, or to Region of it. Inclusive rates are already part of the
+// catalog prices; the others are added at checkout.
+type TaxRate struct {
+	Name      string  `yaml:"name" toml:"name"`
+	Country   string  `yaml:"country" toml:"country"`
+	Region    string  `yaml:"region" toml:"region"`
+	Percent   float64 `yaml:"percent" toml:"percent"`
+	Inclusive bool    `yaml:"inclusive" toml:"inclusive"`
+}
+
+// BasisPoints is Percent in hundredths of a percent.
+func (t TaxRate) BasisPoints() int64 {
+	return int64(math.Round(t.Percent * 100))
+}
+
+// VaultKeyBytes decodes VaultKey.
+func (p PaymentsConfig) VaultKeyBytes() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(p.VaultKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("decodes to %d bytes, want 32", len(key))
+	}
+	return key, nil
+}
+
+// Default returns the settings used when neither the config file nor the
+// environment says otherwise. Secrets and the database URL have no default.
+func Default() Config {
+	return Config{
+		Server:    ServerConfig{Port: "8080", Environment: "production"},
+		Database:  DatabaseConfig{QueryTimeout: 5 * time.Second},
+		JWT:       JWTConfig{TTL: 15 * time.Minute, RefreshTTL: 30 * 24 * time.Hour},
+		CORS:      CORSConfig{AllowedOrigins: []string{"http://localhost:5173"}},
+		Payments:  PaymentsConfig{Currency: "USD", VaultPath: "card_vault.json"},
+		Inventory: InventoryConfig{HoldTTL: 15 * time.Minute, SweepInterval: time.Minute},
+		Storage:   StorageConfig{Backend: "local", LocalDir: "uploads", S3: S3Config{Region: "us-east-1"}},
+		Images:    ImagesConfig{MaxUploadBytes: 10 << 20, MaxPixels: 40_000_000},
+		GuestCart: GuestCartConfig{TTL: 30 * 24 * time.Hour, SweepInterval: time.Hour, Merge: "sum"},
+	}
+}
+
+// Load builds the configuration from defaults, then the optional file named by
+// APP_CONFIG (.yaml, .yml or .toml), then environment variables, and validates
+// the result.
+func Load() (Config, error) {
+	cfg, err := load()
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadDatabase is like Load but only requires the database settings, for
+// tools such as the migration runner that never serve HTTP.
+func LoadDatabase() (DatabaseConfig, error) {
+	cfg, err := load()
+	if err != nil {
+		return DatabaseConfig{}, err
+	}
+
+	if cfg.Database.URL == "" {
+		return DatabaseConfig{}, errors.New("invalid config: database.url is required (DATABASE_URL)")
+	}
+	return cfg.Database, nil
+}
+
+func load() (Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("APP_CONFIG"); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := loadEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file type %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	if v := os.Getenv("APP_PORT"); v != "" {
+		cfg.Server.Port = v
+	}
+	if v := os.Getenv("APP_ENV"); v != "" {
+		cfg.Server.Environment = v
+	}
+	if v := os.Getenv("DATABASE_URL"); v != "" {
+		cfg.Database.URL = v
+	}
+	if v := os.Getenv("DB_QUERY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("DB_QUERY_TIMEOUT: %w", err)
+		}
+		cfg.Database.QueryTimeout = d
+	}
+	if v := os.Getenv("JWT_SECRET"); v != "" {
+		cfg.JWT.Secret = v
+	}
+	if v := os.Getenv("JWT_KEYS_DIR"); v != "" {
+		cfg.JWT.KeysDir = v
+	}
+	if v := os.Getenv("JWT_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("JWT_TTL: %w", err)
+		}
+		cfg.JWT.TTL = d
+	}
+	if v := os.Getenv("JWT_REFRESH_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("JWT_REFRESH_TTL: %w", err)
+		}
+		cfg.JWT.RefreshTTL = d
+	}
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		cfg.CORS.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("PAYMENT_PROVIDER"); v != "" {
+		cfg.Payments.Provider = v
+	}
+	if v := os.Getenv("PAYMENT_CURRENCY"); v != "" {
+		cfg.Payments.Currency = v
+	}
+	if v := os.Getenv("CARD_VAULT_KEY"); v != "" {
+		cfg.Payments.VaultKey = v
+	}
+	if v := os.Getenv("CARD_VAULT_PATH"); v != "" {
+		cfg.Payments.VaultPath = v
+	}
+	if v := os.Getenv("INVENTORY_HOLD_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("INVENTORY_HOLD_TTL: %w", err)
+		}
+		cfg.Inventory.HoldTTL = d
+	}
+	if v := os.Getenv("INVENTORY_SWEEP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("INVENTORY_SWEEP_INTERVAL: %w", err)
+		}
+		cfg.Inventory.SweepInterval = d
+	}
+	if v := os.Getenv("STORAGE_BACKEND"); v != "" {
+		cfg.Storage.Backend = v
+	}
+	if v := os.Getenv("STORAGE_LOCAL_DIR"); v != "" {
+		cfg.Storage.LocalDir = v
+	}
+	if v := os.Getenv("STORAGE_PUBLIC_URL"); v != "" {
+		cfg.Storage.PublicURL = v
+	}
+	if v := os.Getenv("S3_ENDPOINT"); v != "" {
+		cfg.Storage.S3.Endpoint = v
+	}
+	if v := os.Getenv("S3_REGION"); v != "" {
+		cfg.Storage.S3.Region = v
+	}
+	if v := os.Getenv("S3_BUCKET"); v != "" {
+		cfg.Storage.S3.Bucket = v
+	}
+	if v := os.Getenv("S3_ACCESS_KEY_ID"); v != "" {
+		cfg.Storage.S3.AccessKeyID = v
+	}
+	if v := os.Getenv("S3_SECRET_ACCESS_KEY"); v != "" {
+		cfg.Storage.S3.SecretAccessKey = v
+	}
+	if v := os.Getenv("S3_PATH_STYLE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("S3_PATH_STYLE: %w", err)
+		}
+		cfg.Storage.S3.PathStyle = b
+	}
+	if v := os.Getenv("IMAGES_MAX_UPLOAD_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("IMAGES_MAX_UPLOAD_BYTES: %w", err)
+		}
+		cfg.Images.MaxUploadBytes = n
+	}
+	if v := os.Getenv("IMAGES_MAX_PIXELS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("IMAGES_MAX_PIXELS: %w", err)
+		}
+		cfg.Images.MaxPixels = n
+	}
+	if v := os.Getenv("GUEST_CART_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("GUEST_CART_TTL: %w", err)
+		}
+		cfg.GuestCart.TTL = d
+	}
+	if v := os.Getenv("GUEST_CART_SWEEP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("GUEST_CART_SWEEP_INTERVAL: %w", err)
+		}
+		cfg.GuestCart.SweepInterval = d
+	}
+	if v := os.Getenv("GUEST_CART_MERGE"); v != "" {
+		cfg.GuestCart.Merge = v
+	}
+	return nil
+}
+
+// Validate reports every missing or invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %q is not a valid port", c.Server.Port))
+	}
+	switch c.Server.Environment {
+	case "production", "development", "test":
+	default:
+		errs = append(errs, fmt.Errorf("server.environment %q must be production, development or test", c.Server.Environment))
+	}
+	if c.Database.URL == "" {
+		errs = append(errs, errors.New("database.url is required (DATABASE_URL)"))
+	}
+	if c.Database.QueryTimeout < 0 {
+		errs = append(errs, errors.New("database.query_timeout must not be negative"))
+	}
+	if c.JWT.KeysDir == "" && len(c.JWT.Secret) < 16 {
+		errs = append(errs, errors.New("jwt.secret must be at least 16 characters (JWT_SECRET) unless jwt.keys_dir is set"))
+	}
+	errs = append(errs, c.JWT.validate()...)
+	if c.JWT.TTL <= 0 {
+		errs = append(errs, errors.New("jwt.ttl must be positive"))
+	}
+	if c.JWT.RefreshTTL <= c.JWT.TTL {
+		errs = append(errs, errors.New("jwt.refresh_ttl must be longer than jwt.ttl"))
+	}
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("cors.allowed_origins must list at least one origin"))
+	}
+	switch c.Payments.Provider {
+	case "":
+		errs = append(errs, errors.New("payments.provider is required (PAYMENT_PROVIDER)"))
+	case "fake":
+		if c.Server.Environment == "production" {
+			errs = append(errs, errors.New("payments.provider fake charges nothing and is only allowed with server.environment development or test (APP_ENV)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("payments.provider %q is not supported", c.Payments.Provider))
+	}
+	if !money.KnownCurrency(c.Payments.Currency) {
+		errs = append(errs, fmt.Errorf("payments.currency %q must be a supported ISO 4217 code", c.Payments.Currency))
+	}
+	if c.Payments.VaultKey == "" {
+		errs = append(errs, errors.New("payments.vault_key is required (CARD_VAULT_KEY)"))
+	} else if _, err := c.Payments.VaultKeyBytes(); err != nil {
+		errs = append(errs, fmt.Errorf("payments.vault_key must be 32 bytes of base64: %w", err))
+	}
+	if c.Payments.VaultPath == "" {
+		errs = append(errs, errors.New("payments.vault_path is required (CARD_VAULT_PATH)"))
+	}
+	if c.Inventory.HoldTTL <= 0 {
+		errs = append(errs, errors.New("inventory.hold_ttl must be positive"))
+	}
+	if c.Inventory.SweepInterval <= 0 {
+		errs = append(errs, errors.New("inventory.sweep_interval must be positive"))
+	}
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.LocalDir == "" {
+			errs = append(errs, errors.New("storage.local_dir is required for the local backend (STORAGE_LOCAL_DIR)"))
+		}
+	case "s3":
+		s3 := c.Storage.S3
+		if s3.Endpoint == "" || s3.Bucket == "" {
+			errs = append(errs, errors.New("storage.s3.endpoint and storage.s3.bucket are required for the s3 backend (S3_ENDPOINT, S3_BUCKET)"))
+		}
+		if s3.Region == "" {
+			errs = append(errs, errors.New("storage.s3.region is required for the s3 backend (S3_REGION)"))
+		}
+		if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			errs = append(errs, errors.New("storage.s3 credentials are required for the s3 backend (S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY)"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend %q must be local or s3", c.Storage.Backend))
+	}
+	if c.Images.MaxUploadBytes <= 0 {
+		errs = append(errs, errors.New("images.max_upload_bytes must be positive"))
+	}
+	if c.Images.MaxPixels <= 0 {
+		errs = append(errs, errors.New("images.max_pixels must be positive"))
+	}
+	errs = append(errs, c.Shipping.validate()...)
+	errs = append(errs, c.Tax.validate()...)
+	if c.GuestCart.TTL <= 0 {
+		errs = append(errs, errors.New("guest_cart.ttl must be positive"))
+	}
+	if c.GuestCart.SweepInterval <= 0 {
+		errs = append(errs, errors.New("guest_cart.sweep_interval must be positive"))
+	}
+	switch c.GuestCart.Merge {
+	case "sum", "max", "user", "guest":
+	default:
+		errs = append(errs, fmt.Errorf("guest_cart.merge %q must be sum, max, user or guest", c.GuestCart.Merge))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+var (
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	methodPattern  = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+)
+
+func (c JWTConfig) validate() []error {
+	var errs []error
+	if c.KeysDir != "" && len(c.Keys) == 0 {
+		errs = append(errs, errors.New("jwt.keys is required with jwt.keys_dir"))
+	}
+	if c.KeysDir == "" && len(c.Keys) > 0 {
+		errs = append(errs, errors.New("jwt.keys needs jwt.keys_dir (JWT_KEYS_DIR)"))
+	}
+	seen := map[string]bool{}
+	for i, k := range c.Keys {
+		name := fmt.Sprintf("jwt.keys[%d]", i)
+		if k.KID == "" {
+			errs = append(errs, fmt.Errorf("%s.kid is required", name))
+		} else if seen[k.KID] {
+			errs = append(errs, fmt.Errorf("%s.kid %q is listed twice", name, k.KID))
+		}
+		seen[k.KID] = true
+		if !k.RetireAt.IsZero() && !k.RetireAt.After(k.NotBefore) {
+			errs = append(errs, fmt.Errorf("%s.retire_at must be after its not_before", name))
+		}
+	}
+	return errs
+}
+
+func (c ShippingConfig) validate() []error {
+	var errs []error
+	methods := map[string]bool{}
+	for i, r := range c.Rates {
+		name := fmt.Sprintf("shipping.rates[%d]", i)
+		if !methodPattern.MatchString(r.Method) {
+			errs = append(errs, fmt.Errorf("%s.method %q must be 1 to 32 lowercase letters, digits, dashes or underscores", name, r.Method))
+		} else if methods[r.Method] {
+			errs = append(errs, fmt.Errorf("%s.method %q is listed twice", name, r.Method))
+		}
+		methods[r.Method] = true
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name is required", name))
+		}
+		for _, country := range r.Countries {
+			if !countryPattern.MatchString(country) {
+				errs = append(errs, fmt.Errorf("%s.countries: %q is not an ISO 3166-1 alpha-2 code", name, country))
+			}
+		}
+		if !money.KnownCurrency(r.Currency) {
+			errs = append(errs, fmt.Errorf("%s.currency %q must be a supported ISO 4217 code", name, r.Currency))
+		}
+		if r.Amount < 0 || r.PerKg < 0 || r.Threshold < 0 {
+			errs = append(errs, fmt.Errorf("%s amounts must not be negative", name))
+		}
+		switch r.Kind {
+		case "flat":
+		case "weight":
+			if r.PerKg == 0 {
+				errs = append(errs, fmt.Errorf("%s.per_kg is required for a weight rate", name))
+			}
+		case "free_over":
+			if r.Threshold == 0 {
+				errs = append(errs, fmt.Errorf("%s.threshold is required for a free_over rate", name))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s.kind %q must be flat, weight or free_over", name, r.Kind))
+		}
+	}
+	return errs
+}
+
+func (c TaxConfig) validate() []error {
+	var errs []error
+	inclusive := map[string]bool{}
+	for i, t := range c.Rates {
+		name := fmt.Sprintf("tax.rates[%d]", i)
+		if t.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name is required", name))
+		}
+		if !countryPattern.MatchString(t.Country) {
+			errs = append(errs, fmt.Errorf("%s.country %q is not an ISO 3166-1 alpha-2 code", name, t.Country))
+		}
+		if t.Percent <= 0 || t.Percent >= 100 || math.Abs(t.Percent*100-float64(t.BasisPoints())) > 1e-6 {
+			errs = append(errs, fmt.Errorf("%s.percent %v must be above 0, below 100 and have at most two decimals", name, t.Percent))
+		}
+		// Inclusive and exclusive rates cannot be stacked on one order.
+		if seen, ok := inclusive[t.Country]; ok && seen != t.Inclusive {
+			errs = append(errs, fmt.Errorf("%s: the rates of %s must all be inclusive or all exclusive", name, t.Country))
+		}
+		inclusive[t.Country] = t.Inclusive
+	}
+	return errs
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
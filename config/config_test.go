@@ -0,0 +1,166 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable the tests read, so the caller's environment
+// does not leak in.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"APP_CONFIG", "APP_PORT", "APP_ENV", "DATABASE_URL", "DB_QUERY_TIMEOUT", "JWT_SECRET", "JWT_TTL", "JWT_REFRESH_TTL", "CORS_ALLOWED_ORIGINS", "PAYMENT_PROVIDER", "INVENTORY_HOLD_TTL", "GUEST_CART_MERGE"} {
+		t.Setenv(name, "")
+	}
+}
+
+const yamlConfig = `
+server:
+  port: "9000"
+  environment: development
+database:
+  url: postgres://file/db
+  query_timeout: 2s
+jwt:
+  ttl: 10m
+cors:
+  allowed_origins: [https://shop.example.com]
+guest_cart:
+  merge: max
+`
+
+const tomlConfig = `
+[server]
+port = "9000"
+environment = "development"
+
+[database]
+url = "postgres://file/db"
+query_timeout = "2s"
+
+[jwt]
+ttl = "10m"
+
+[cors]
+allowed_origins = ["https://shop.example.com"]
+
+[guest_cart]
+merge = "max"
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	for name, content := range map[string]string{"config.yaml": yamlConfig, "config.toml": tomlConfig} {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("APP_CONFIG", path)
+			t.Setenv("DATABASE_URL", "postgres://env/db")
+			t.Setenv("GUEST_CART_MERGE", "user")
+
+			cfg, err := load()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// from the file
+			if cfg.Server.Port != "9000" || cfg.Server.Environment != "development" {
+				t.Errorf("server = %+v, want the file's", cfg.Server)
+			}
+			if cfg.Database.QueryTimeout != 2*time.Second || cfg.JWT.TTL != 10*time.Minute {
+				t.Errorf("query_timeout = %v, jwt.ttl = %v, want the file's 2s and 10m", cfg.Database.QueryTimeout, cfg.JWT.TTL)
+			}
+			if len(cfg.CORS.AllowedOrigins) != 1 || cfg.CORS.AllowedOrigins[0] != "https://shop.example.com" {
+				t.Errorf("allowed_origins = %v, want the file's", cfg.CORS.AllowedOrigins)
+			}
+			// the environment over the file
+			if cfg.Database.URL != "postgres://env/db" || cfg.GuestCart.Merge != "user" {
+				t.Errorf("database.url = %q, guest_cart.merge = %q, want the environment's", cfg.Database.URL, cfg.GuestCart.Merge)
+			}
+			// defaults where neither says otherwise
+			if cfg.JWT.RefreshTTL != 30*24*time.Hour || cfg.Inventory.HoldTTL != 15*time.Minute || cfg.Payments.Currency != "USD" {
+				t.Errorf("refresh_ttl = %v, hold_ttl = %v, currency = %q, want the defaults", cfg.JWT.RefreshTTL, cfg.Inventory.HoldTTL, cfg.Payments.Currency)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_CONFIG", path)
+	if _, err := load(); err == nil || !strings.Contains(err.Error(), "unsupported config file type") {
+		t.Fatalf("json file: err = %v", err)
+	}
+
+	t.Setenv("APP_CONFIG", filepath.Join(dir, "missing.yaml"))
+	if _, err := load(); err == nil {
+		t.Fatal("missing file loaded")
+	}
+
+	t.Setenv("APP_CONFIG", "")
+	t.Setenv("JWT_TTL", "fifteen minutes")
+	if _, err := load(); err == nil || !strings.Contains(err.Error(), "JWT_TTL") {
+		t.Fatalf("bad JWT_TTL: err = %v", err)
+	}
+}
+
+// validConfig is Default with everything Validate requires filled in.
+func validConfig() Config {
+	cfg := Default()
+	cfg.Server.Environment = "development"
+	cfg.Database.URL = "postgres://localhost/shop"
+	cfg.JWT.Secret = "0123456789abcdef"
+	cfg.Payments.Provider = "fake"
+	cfg.Payments.VaultKey = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = "http"
+	cfg.JWT.RefreshTTL = time.Minute
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("defaults without secrets validated")
+	}
+	for _, want := range []string{"server.port", "database.url", "jwt.secret", "jwt.refresh_ttl", "payments.provider", "payments.vault_key"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateFakeProvider(t *testing.T) {
+	for _, env := range []string{"development", "test"} {
+		cfg := validConfig()
+		cfg.Server.Environment = env
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("fake provider in %s: %v", env, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Server.Environment = "production"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "payments.provider fake") {
+		t.Fatalf("fake provider in production: err = %v", err)
+	}
+}
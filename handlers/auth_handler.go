@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"net/http"
+	"time"
+)
+
+// writeTokenPair answers a login or refresh. "token" keeps its name from when
+// login returned only the access token.
+func writeTokenPair(w http.ResponseWriter, pair models.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":         pair.Token,
+		"refresh_token": pair.RefreshToken,
+		"expires_in":    int(pair.ExpiresIn.Seconds()),
+	})
+}
+
+// ************************refresh*****************************
+func (h *UserHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Refresh_token string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	if body.Refresh_token == "" {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Refresh_token is required", nil)
+		return
+	}
+
+	pair, err := h.users.RefreshSession(r.Context(), body.Refresh_token)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		writeError(w, r, http.StatusUnauthorized, "refresh_token_reused", "Refresh token was already used; please log in again", nil)
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidRefreshToken) {
+		writeError(w, r, http.StatusUnauthorized, "invalid_refresh_token", "Invalid or expired refresh token", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to refresh session")
+		return
+	}
+
+	writeTokenPair(w, pair)
+}
+
+// ************************logout*****************************
+func (h *UserHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+	jti, _ := r.Context().Value("tokenID").(string)
+	expiresAt, _ := r.Context().Value("tokenExpiresAt").(time.Time)
+
+	// the body is optional; with a refresh token its session ends too
+	var body struct {
+		Refresh_token string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if err := h.users.Logout(r.Context(), userID, jti, expiresAt, body.Refresh_token); err != nil {
+		writeRepoError(w, r, err, "Failed to log out")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Logged out successfully"))
+}
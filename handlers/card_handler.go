@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"my-go-project/models"
+	"my-go-project/payments"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// *********************add credit card *******************************
+// The card number is validated and swapped for a vault token here; only the
+// token, brand and last four digits reach the repository.
+func (h *UserHandler) AddCreditCardHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	var body struct {
+		Card_id     int
+		User_id     int
+		Card_num    string
+		Exp_month   int
+		Exp_year    int
+		Holder_name string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if body.Card_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Card_id is assigned by the server", nil)
+		return
+	}
+
+	// the card always goes on the caller's account
+	if body.User_id != 0 && body.User_id != userID {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "User_id is taken from the token", nil)
+		return
+	}
+
+	details := payments.CardDetails{
+		Number:     body.Card_num,
+		ExpMonth:   body.Exp_month,
+		ExpYear:    body.Exp_year,
+		HolderName: body.Holder_name,
+	}
+	if err := details.Validate(time.Now()); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_card", err.Error(), nil)
+		return
+	}
+
+	token, err := h.vault.Tokenize(r.Context(), details)
+	if err != nil {
+		log.Println("Error tokenizing card:", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Failed to add credit card", nil)
+		return
+	}
+
+	created, err := h.cards.AddCreditCard(r.Context(), userID, models.CreditCard{
+		Token: token,
+		Brand: details.Brand(),
+		Last4: details.Last4(),
+	})
+	if err != nil {
+		h.dropToken(r, token)
+		writeRepoError(w, r, err, "Failed to add credit card")
+		return
+	}
+
+	writeCreated(w, fmt.Sprintf("/credit/%d", created.Card_id), created)
+}
+
+// dropToken removes a card from the vault once nothing refers to it any more.
+// Failures are only logged: the card is already gone from the caller's view.
+func (h *UserHandler) dropToken(r *http.Request, token string) {
+	if token == "" {
+		return
+	}
+	if err := h.vault.Delete(r.Context(), token); err != nil && !errors.Is(err, payments.ErrUnknownToken) {
+		log.Println("Error deleting card from vault:", err)
+	}
+}
+
+// *********************list credit cards *******************************
+func (h *UserHandler) ListCreditCardsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	cards, err := h.cards.ListCreditCards(r.Context(), userID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve credit cards")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cards)
+}
+
+// *********************set default credit card *******************************
+func (h *UserHandler) SetDefaultCreditCardHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	cardID, err := strconv.Atoi(mux.Vars(r)["card_id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid card ID", nil)
+		return
+	}
+
+	card, err := h.cards.SetDefaultCreditCard(r.Context(), userID, cardID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to set default credit card")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// *****************************delete credit card ********************************
+func (h *UserHandler) DeleteCreditCardHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	vars := mux.Vars(r)
+	cardID, err := strconv.Atoi(vars["card_id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid card ID", nil)
+		return
+	}
+
+	card, err := h.cards.DeleteCreditCard(r.Context(), userID, cardID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to delete credit card")
+		return
+	}
+	h.dropToken(r, card.Token)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Credit card deleted successfully"))
+}
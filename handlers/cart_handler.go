@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"io"
+	"my-go-project/models"
+	"net/http"
+	"strconv"
+)
+
+// ************************add product in cart ***************************************
+// AddCartProductHandler puts a product in the caller's cart. Adding a product
+// that is already there adds to the quantity of its line.
+func (h *UserHandler) AddCartProductHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	// decode
+	var cartProduct models.CartProduct
+	if err := json.NewDecoder(r.Body).Decode(&cartProduct); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if cartProduct.CP_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "CP_id is assigned by the server", nil)
+		return
+	}
+
+	if cartProduct.Product_id == 0 || cartProduct.Quantity <= 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Product_id and a positive Quantity are required", nil)
+		return
+	}
+
+	created, err := h.carts.AddCartProduct(r.Context(), userID, cartProduct)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to add product to cart")
+		return
+	}
+
+	writeCreated(w, "/users/cart", created)
+}
+
+//***************add cart ***************************************
+
+// AddCartHandler returns the caller's cart, which is created the first time
+// it is needed.
+func (h *UserHandler) AddCartHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	// the body is optional; an empty one just returns the cart
+	var cart models.Cart
+	if err := json.NewDecoder(r.Body).Decode(&cart); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if cart.Cart_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Cart_id is assigned by the server", nil)
+		return
+	}
+
+	created, err := h.carts.AddCart(r.Context(), userID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to add cart")
+		return
+	}
+
+	writeCreated(w, "/users/cart", created)
+}
+
+// *********************get cart *****************************************
+func (h *UserHandler) GetCartHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	cart, err := h.carts.GetCart(r.Context(), userID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve cart")
+		return
+	}
+	for _, l := range cart.Items {
+		if l.Image != nil {
+			withImageURL(h.blobs, l.Image)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cart)
+}
+
+// *********************update cart line *****************************************
+func (h *UserHandler) UpdateCartProductHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	cpID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid cart line ID", nil)
+		return
+	}
+
+	var body struct {
+		Quantity int
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	if body.Quantity <= 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Quantity must be positive; remove the line instead", nil)
+		return
+	}
+
+	line, err := h.carts.UpdateCartProduct(r.Context(), userID, cpID, body.Quantity)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update cart line")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(line)
+}
+
+// *********************remove cart line *****************************************
+func (h *UserHandler) RemoveCartProductHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	cpID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid cart line ID", nil)
+		return
+	}
+
+	err = h.carts.RemoveCartProduct(r.Context(), userID, cpID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to remove cart line")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// *********************clear cart *****************************************
+func (h *UserHandler) ClearCartHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	if err := h.carts.ClearCart(r.Context(), userID); err != nil {
+		writeRepoError(w, r, err, "Failed to clear cart")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CatalogHandler struct {
+	catalog  repository.CatalogStore
+	products repository.ProductStore
+}
+
+func NewCatalogHandler(catalog repository.CatalogStore, products repository.ProductStore) *CatalogHandler {
+	return &CatalogHandler{catalog: catalog, products: products}
+}
+
+// ***********************category tree*********************************************
+func (h *CatalogHandler) ListCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.catalog.ListCategories(r.Context())
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve categories")
+		return
+	}
+
+	tree := repository.CategoryTree(categories, 0)
+	if tree == nil {
+		tree = []models.Category{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
+// ***********************category with its subtree*********************************************
+func (h *CatalogHandler) GetCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	category, ok := h.category(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := h.catalog.ListCategories(r.Context())
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve categories")
+		return
+	}
+	category.Children = repository.CategoryTree(categories, category.Category_id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// ***********************products of a category*********************************************
+// CategoryProductsHandler lists the products of a category and of all its
+// descendants, with the same filters, sorting and paging as GET /products.
+func (h *CatalogHandler) CategoryProductsHandler(w http.ResponseWriter, r *http.Request) {
+	category, ok := h.category(w, r)
+	if !ok {
+		return
+	}
+	filter, ok := productFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Category = category.Slug
+
+	products, err := h.products.GetAllProducts(r.Context(), filter)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve products")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// category loads the category named by the slug path variable, answering 404
+// when there is none.
+func (h *CatalogHandler) category(w http.ResponseWriter, r *http.Request) (models.Category, bool) {
+	category, err := h.catalog.GetCategoryBySlug(r.Context(), mux.Vars(r)["slug"])
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve category")
+		return models.Category{}, false
+	}
+	return category, true
+}
+
+// ***********************add category (admin)*********************************************
+func (h *CatalogHandler) CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var c models.Category
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if c.Category_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Category_id is assigned by the server", nil)
+		return
+	}
+
+	if !validNameAndSlug(w, r, &c.Name, &c.Slug) {
+		return
+	}
+
+	created, err := h.catalog.CreateCategory(r.Context(), c)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to create category")
+		return
+	}
+
+	writeCreated(w, "/categories/"+created.Slug, created)
+}
+
+// ***********************update category (admin)*********************************************
+func (h *CatalogHandler) UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid category ID", nil)
+		return
+	}
+
+	var c models.Category
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	c.Category_id = id
+
+	if !validNameAndSlug(w, r, &c.Name, &c.Slug) {
+		return
+	}
+
+	updated, err := h.catalog.UpdateCategory(r.Context(), c)
+	if errors.Is(err, repository.ErrCategoryCycle) {
+		writeError(w, r, http.StatusConflict, "category_cycle", "A category cannot be moved under itself or its descendants", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// ***********************delete category (admin)*********************************************
+func (h *CatalogHandler) DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid category ID", nil)
+		return
+	}
+
+	err = h.catalog.DeleteCategory(r.Context(), id)
+	if errors.Is(err, repository.ErrForeignKeyViolation) {
+		writeError(w, r, http.StatusConflict, "category_not_empty", "Move or delete the subcategories first", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to delete category")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ***********************list tags*********************************************
+func (h *CatalogHandler) ListTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.catalog.ListTags(r.Context())
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve tags")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// ***********************add tag (admin)*********************************************
+func (h *CatalogHandler) CreateTagHandler(w http.ResponseWriter, r *http.Request) {
+	var t models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if t.Tag_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Tag_id is assigned by the server", nil)
+		return
+	}
+
+	if !validNameAndSlug(w, r, &t.Name, &t.Slug) {
+		return
+	}
+
+	created, err := h.catalog.CreateTag(r.Context(), t)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to create tag")
+		return
+	}
+
+	writeCreated(w, "/products?tag="+created.Slug, created)
+}
+
+// ***********************update tag (admin)*********************************************
+func (h *CatalogHandler) UpdateTagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid tag ID", nil)
+		return
+	}
+
+	var t models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	t.Tag_id = id
+
+	if !validNameAndSlug(w, r, &t.Name, &t.Slug) {
+		return
+	}
+
+	updated, err := h.catalog.UpdateTag(r.Context(), t)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update tag")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// ***********************delete tag (admin)*********************************************
+func (h *CatalogHandler) DeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid tag ID", nil)
+		return
+	}
+
+	err = h.catalog.DeleteTag(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to delete tag")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ***********************set product categories (staff)*********************************************
+func (h *CatalogHandler) SetProductCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	var body struct {
+		Categories []string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	slugs, err := h.catalog.SetProductCategories(r.Context(), id, body.Categories)
+	if errors.Is(err, repository.ErrUnknownCategory) {
+		writeError(w, r, http.StatusBadRequest, "unknown_category", "One or more categories do not exist", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to set product categories")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"Categories": slugs})
+}
+
+// ***********************set product tags (staff)*********************************************
+func (h *CatalogHandler) SetProductTagsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	var body struct {
+		Tags []string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	slugs, err := h.catalog.SetProductTags(r.Context(), id, body.Tags)
+	if errors.Is(err, repository.ErrUnknownTag) {
+		writeError(w, r, http.StatusBadRequest, "unknown_tag", "One or more tags do not exist", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to set product tags")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"Tags": slugs})
+}
+
+// validNameAndSlug trims name, derives slug from it when empty and checks
+// both. On a problem it answers 400 and returns false.
+func validNameAndSlug(w http.ResponseWriter, r *http.Request, name, slug *string) bool {
+	*name = strings.TrimSpace(*name)
+	if *name == "" {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Name is required", nil)
+		return false
+	}
+	if *slug == "" {
+		*slug = repository.Slugify(*name)
+	}
+	if !repository.ValidSlug(*slug) {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Slug must be lowercase letters and digits separated by single dashes", nil)
+		return false
+	}
+	return true
+}
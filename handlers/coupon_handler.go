@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+)
+
+type CouponHandler struct {
+	coupons repository.CouponStore
+}
+
+func NewCouponHandler(coupons repository.CouponStore) *CouponHandler {
+	return &CouponHandler{coupons: coupons}
+}
+
+// ***********************list coupons (admin)*********************************************
+func (h *CouponHandler) ListCouponsHandler(w http.ResponseWriter, r *http.Request) {
+	page, ok := pageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	coupons, err := h.coupons.ListCoupons(r.Context(), page)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve coupons")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupons)
+}
+
+// ***********************get coupon (admin)*********************************************
+func (h *CouponHandler) GetCouponHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid coupon ID", nil)
+		return
+	}
+
+	coupon, err := h.coupons.GetCoupon(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve coupon")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// ***********************add coupon (admin)*********************************************
+func (h *CouponHandler) CreateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	var c models.Coupon
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	if c.Coupon_id != 0 || c.Times_used != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Coupon_id and Times_used are set by the server", nil)
+		return
+	}
+	if !validCoupon(w, r, &c) {
+		return
+	}
+
+	created, err := h.coupons.CreateCoupon(r.Context(), c)
+	if err != nil {
+		writeCouponError(w, r, err, "Failed to add coupon")
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/coupons/%d", created.Coupon_id), created)
+}
+
+// ***********************update coupon (admin)*********************************************
+func (h *CouponHandler) UpdateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid coupon ID", nil)
+		return
+	}
+
+	var c models.Coupon
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	c.Coupon_id = id
+	if !validCoupon(w, r, &c) {
+		return
+	}
+
+	updated, err := h.coupons.UpdateCoupon(r.Context(), c)
+	if err != nil {
+		writeCouponError(w, r, err, "Failed to update coupon")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// ***********************delete coupon (admin)*********************************************
+func (h *CouponHandler) DeleteCouponHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid coupon ID", nil)
+		return
+	}
+
+	err = h.coupons.DeleteCoupon(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to delete coupon")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ***********************apply coupon to cart*********************************************
+// ApplyCouponHandler puts a coupon on the user's cart and answers with the cart
+// priced with its discounts. The coupon is checked again at checkout.
+func (h *CouponHandler) ApplyCouponHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	var body struct {
+		Code string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	// a code that cannot exist is answered like an unknown one
+	var summary models.CartSummary
+	code, valid := repository.NormalizeCouponCode(body.Code)
+	err := repository.ErrNotFound
+	if valid {
+		summary, err = h.coupons.ApplyCartCoupon(r.Context(), userID, code)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "not_found", "Coupon not found", nil)
+		return
+	}
+	if errors.Is(err, repository.ErrEmptyCart) {
+		writeError(w, r, http.StatusBadRequest, "cart_empty", "Cart is empty", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to apply coupon")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// ***********************remove coupon from cart*********************************************
+func (h *CouponHandler) RemoveCouponHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	if err := h.coupons.RemoveCartCoupon(r.Context(), userID); err != nil {
+		writeRepoError(w, r, err, "Failed to remove coupon")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeCouponError answers a failed coupon write, which can also fail on its
+// product and category links.
+func writeCouponError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, repository.ErrUnknownProduct):
+		writeError(w, r, http.StatusBadRequest, "unknown_product", "One or more products do not exist", nil)
+	case errors.Is(err, repository.ErrUnknownCategory):
+		writeError(w, r, http.StatusBadRequest, "unknown_category", "One or more categories do not exist", nil)
+	default:
+		writeRepoError(w, r, err, msg)
+	}
+}
+
+// validCoupon checks a coupon from a request body and normalizes its code in
+// place. Only the fields of the coupon's kind may be set.
+func validCoupon(w http.ResponseWriter, r *http.Request, c *models.Coupon) bool {
+	fail := func(message string) bool {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", message, nil)
+		return false
+	}
+
+	code, ok := repository.NormalizeCouponCode(c.Code)
+	if !ok {
+		return fail("Code must be 3 to 32 letters, digits, dashes or underscores")
+	}
+	c.Code = code
+
+	switch c.Kind {
+	case models.CouponPercentage:
+		if c.Percent < 1 || c.Percent > 100 {
+			return fail("Percent must be between 1 and 100")
+		}
+		if c.Amount != nil || c.Buy_quantity != 0 || c.Get_quantity != 0 {
+			return fail("A percentage coupon only takes Percent")
+		}
+	case models.CouponFixed:
+		if c.Amount == nil || c.Amount.Amount <= 0 {
+			return fail("Amount must be positive")
+		}
+		if c.Percent != 0 || c.Buy_quantity != 0 || c.Get_quantity != 0 {
+			return fail("A fixed coupon only takes Amount")
+		}
+	case models.CouponFreeShipping:
+		if c.Percent != 0 || c.Amount != nil || c.Buy_quantity != 0 || c.Get_quantity != 0 {
+			return fail("A free_shipping coupon takes no Percent, Amount or quantities")
+		}
+	case models.CouponBuyXGetY:
+		if c.Buy_quantity < 1 || c.Get_quantity < 1 {
+			return fail("Buy_quantity and Get_quantity must be at least 1")
+		}
+		if c.Percent == 0 {
+			c.Percent = 100
+		}
+		if c.Percent < 1 || c.Percent > 100 {
+			return fail("Percent must be between 1 and 100")
+		}
+		if c.Amount != nil {
+			return fail("A buy_x_get_y coupon takes no Amount")
+		}
+	default:
+		return fail("Kind must be percentage, fixed, free_shipping or buy_x_get_y")
+	}
+
+	if c.Min_order != nil {
+		if c.Min_order.Amount <= 0 {
+			return fail("Min_order must be positive; omit it for no minimum")
+		}
+		if c.Amount != nil && c.Amount.Currency != c.Min_order.Currency {
+			writeError(w, r, http.StatusBadRequest, "currency_mismatch", "Amount and Min_order must be in the same currency", nil)
+			return false
+		}
+	}
+	if c.Starts_at != nil && c.Ends_at != nil && !c.Starts_at.Before(*c.Ends_at) {
+		return fail("Starts_at must be before Ends_at")
+	}
+	if c.Max_uses < 0 || c.Max_uses_per_user < 0 {
+		return fail("Max_uses and Max_uses_per_user cannot be negative; 0 means no limit")
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"net/http"
+	"strings"
+)
+
+const addressMessage = "Address needs Line1, City and a two-letter Country; fields are at most 200 characters"
+
+// ***********************set own address*********************************************
+func (h *UserHandler) SetAddressHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	var a models.Address
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	a, valid := repository.NormalizeAddress(a)
+	if !valid {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", addressMessage, nil)
+		return
+	}
+
+	user, err := h.users.SetUserAddress(r.Context(), userID, a)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update address")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ***********************quote cart*********************************************
+// QuoteHandler prices the user's cart for delivery: subtotal, discounts,
+// shipping, tax and total, exactly as checking out would.
+func (h *UserHandler) QuoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	d, ok := deliveryRequest(w, r)
+	if !ok {
+		return
+	}
+
+	quote, err := h.carts.QuoteCart(r.Context(), userID, d)
+	if errors.Is(err, repository.ErrEmptyCart) {
+		writeError(w, r, http.StatusBadRequest, "cart_empty", "Cart is empty", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to quote cart")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// deliveryRequest reads the optional delivery body of a quote or checkout. An
+// empty body ships to the user's own address by the cheapest method.
+func deliveryRequest(w http.ResponseWriter, r *http.Request) (models.Delivery, bool) {
+	var d models.Delivery
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return models.Delivery{}, false
+	}
+	if d.Ship_to != nil {
+		a, valid := repository.NormalizeAddress(*d.Ship_to)
+		if !valid {
+			writeError(w, r, http.StatusBadRequest, "validation_failed", addressMessage, nil)
+			return models.Delivery{}, false
+		}
+		d.Ship_to = &a
+	}
+	d.Shipping_method = strings.TrimSpace(d.Shipping_method)
+	return d, true
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"my-go-project/apierror"
+	"my-go-project/money"
+	"my-go-project/pricing"
+	"my-go-project/repository"
+	"net/http"
+)
+
+// writeError answers with status and the JSON error envelope. code is the
+// stable identifier clients branch on; details may be nil.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	apierror.Write(w, r, status, code, message, details)
+}
+
+// writeRepoError answers a failed repository call: 504 when the query ran past
+// its deadline, 404, 409 or 400 for the typed repository errors, otherwise 500
+// with msg.
+func writeRepoError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var details interface{}
+	var serr *repository.InsufficientStockError
+	if errors.As(err, &serr) {
+		d := map[string]int{"product_id": serr.Product_id, "requested": serr.Requested, "available": serr.Available}
+		if serr.Variant_id != 0 {
+			d["variant_id"] = serr.Variant_id
+		}
+		details = d
+	}
+	var couponErr *pricing.CouponError
+	if errors.As(err, &couponErr) {
+		details = map[string]string{"code": couponErr.Code, "reason": couponErr.Reason}
+	}
+	var cerr *repository.ConstraintError
+	if errors.As(err, &cerr) && (cerr.Constraint != "" || cerr.Column != "") {
+		d := map[string]string{}
+		if cerr.Constraint != "" {
+			d["constraint"] = cerr.Constraint
+		}
+		if cerr.Column != "" {
+			d["column"] = cerr.Column
+		}
+		details = d
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrTimeout):
+		writeError(w, r, http.StatusGatewayTimeout, "timeout", "Request timed out", nil)
+	case errors.Is(err, repository.ErrInvalidCursor):
+		writeError(w, r, http.StatusBadRequest, "invalid_cursor", "Cursor is invalid or belongs to another sort order", nil)
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "not_found", "Resource not found", nil)
+	case errors.Is(err, repository.ErrVariantRequired):
+		writeError(w, r, http.StatusBadRequest, "variant_required", "This product has variants; choose one with Variant_id", nil)
+	case errors.Is(err, repository.ErrUnknownVariant):
+		writeError(w, r, http.StatusBadRequest, "unknown_variant", "Variant does not exist for this product", nil)
+	case errors.Is(err, repository.ErrInsufficientStock):
+		writeError(w, r, http.StatusConflict, "insufficient_stock", "Not enough stock", details)
+	case errors.Is(err, repository.ErrTooManyImages):
+		writeError(w, r, http.StatusConflict, "too_many_images", fmt.Sprintf("A product can have at most %d images", repository.MaxProductImages), nil)
+	case errors.Is(err, repository.ErrAddressRequired):
+		writeError(w, r, http.StatusBadRequest, "address_required", "A delivery address with Line1, City and Country is required", nil)
+	case errors.Is(err, pricing.ErrNoShippingRate):
+		writeError(w, r, http.StatusBadRequest, "shipping_unavailable", "No shipping method delivers this cart to the address", nil)
+	case errors.Is(err, pricing.ErrCouponNotApplicable):
+		writeError(w, r, http.StatusBadRequest, "coupon_not_applicable", "Coupon cannot be used on this cart", details)
+	case errors.Is(err, money.ErrCurrencyMismatch):
+		writeError(w, r, http.StatusBadRequest, "currency_mismatch", "Amounts are in different currencies", details)
+	case errors.Is(err, repository.ErrConflict):
+		writeError(w, r, http.StatusConflict, "conflict", "Resource already exists", details)
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		writeError(w, r, http.StatusConflict, "foreign_key_violation", "Resource is referenced by, or references, another resource", details)
+	case errors.Is(err, repository.ErrValidation):
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Invalid value", details)
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal_error", msg, nil)
+	}
+}
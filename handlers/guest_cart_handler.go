@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+)
+
+// ************************start guest cart ***************************************
+// StartGuestCartHandler opens a new cart for an anonymous visitor and hands
+// out its guest token, in the body and as the guest_cart cookie.
+func (h *UserHandler) StartGuestCartHandler(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.guests.StartGuestCart(r.Context())
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to start guest cart")
+		return
+	}
+
+	setGuestCookie(w, r, cart)
+	writeCreated(w, "/guest/cart", cart)
+}
+
+// ************************add product in guest cart ***************************************
+// AddGuestCartProductHandler is AddCartProductHandler for a guest cart. A
+// request without a valid guest token starts a new guest cart, whose token
+// comes back in the X-Guest-Token header and the guest_cart cookie.
+func (h *UserHandler) AddGuestCartProductHandler(w http.ResponseWriter, r *http.Request) {
+	var cartProduct models.CartProduct
+	if err := json.NewDecoder(r.Body).Decode(&cartProduct); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if cartProduct.CP_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "CP_id is assigned by the server", nil)
+		return
+	}
+
+	if cartProduct.Product_id == 0 || cartProduct.Quantity <= 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Product_id and a positive Quantity are required", nil)
+		return
+	}
+
+	guestID, ok := r.Context().Value("guestID").(string)
+	if !ok {
+		cart, err := h.guests.StartGuestCart(r.Context())
+		if err != nil {
+			writeRepoError(w, r, err, "Failed to start guest cart")
+			return
+		}
+		setGuestCookie(w, r, cart)
+		w.Header().Set(models.GuestTokenHeader, cart.Guest_token)
+		guestID = cart.Guest_id
+	}
+
+	created, err := h.guests.AddGuestCartProduct(r.Context(), guestID, cartProduct)
+	if err != nil {
+		writeGuestCartError(w, r, err, "Failed to add product to cart")
+		return
+	}
+
+	writeCreated(w, "/guest/cart", created)
+}
+
+// *********************get guest cart *****************************************
+func (h *UserHandler) GetGuestCartHandler(w http.ResponseWriter, r *http.Request) {
+	guestID, ok := guestFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	cart, err := h.guests.GetGuestCart(r.Context(), guestID)
+	if err != nil {
+		writeGuestCartError(w, r, err, "Failed to retrieve cart")
+		return
+	}
+	for _, l := range cart.Items {
+		if l.Image != nil {
+			withImageURL(h.blobs, l.Image)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cart)
+}
+
+// *********************update guest cart line *****************************************
+func (h *UserHandler) UpdateGuestCartProductHandler(w http.ResponseWriter, r *http.Request) {
+	guestID, ok := guestFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	cpID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid cart line ID", nil)
+		return
+	}
+
+	var body struct {
+		Quantity int
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	if body.Quantity <= 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Quantity must be positive; remove the line instead", nil)
+		return
+	}
+
+	line, err := h.guests.UpdateGuestCartProduct(r.Context(), guestID, cpID, body.Quantity)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update cart line")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(line)
+}
+
+// *********************remove guest cart line *****************************************
+func (h *UserHandler) RemoveGuestCartProductHandler(w http.ResponseWriter, r *http.Request) {
+	guestID, ok := guestFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	cpID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid cart line ID", nil)
+		return
+	}
+
+	err = h.guests.RemoveGuestCartProduct(r.Context(), guestID, cpID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to remove cart line")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// *********************clear guest cart *****************************************
+func (h *UserHandler) ClearGuestCartHandler(w http.ResponseWriter, r *http.Request) {
+	guestID, ok := guestFromContext(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.guests.ClearGuestCart(r.Context(), guestID)
+	if err != nil {
+		writeGuestCartError(w, r, err, "Failed to clear cart")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// mergeGuestCart moves the caller's guest cart, if the request carries a
+// guest token, into the cart of userID after a login or registration, and
+// drops the guest_cart cookie. The login itself succeeds even when the merge
+// fails.
+func (h *UserHandler) mergeGuestCart(w http.ResponseWriter, r *http.Request, userID int) {
+	guestID, ok := r.Context().Value("guestID").(string)
+	if !ok {
+		return
+	}
+
+	err := h.guests.MergeGuestCart(r.Context(), guestID, userID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Println("Error merging guest cart:", err)
+		return
+	}
+	cookie := guestCookie(r, "")
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+// writeGuestCartError is writeRepoError for a guest cart. A valid token whose
+// cart is gone means the cart expired, and the client should start a new one.
+func writeGuestCartError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "not_found", "Guest cart not found", nil)
+		return
+	}
+	writeRepoError(w, r, err, msg)
+}
+
+// guestFromContext returns the guest id GuestToken put in the request
+// context, answering 401 when the request has no valid guest token.
+func guestFromContext(w http.ResponseWriter, r *http.Request) (string, bool) {
+	guestID, ok := r.Context().Value("guestID").(string)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "guest_token_required", "A valid guest token is required", nil)
+		return "", false
+	}
+	return guestID, true
+}
+
+// setGuestCookie hands the guest token out as an HTTP-only cookie that lasts
+// as long as the guest cart.
+func setGuestCookie(w http.ResponseWriter, r *http.Request, cart models.GuestCart) {
+	cookie := guestCookie(r, cart.Guest_token)
+	cookie.Expires = cart.Expires_at
+	http.SetCookie(w, cookie)
+}
+
+// guestCookie is the guest_cart cookie with value. Setting and clearing it go
+// through here so both carry the same attributes, and browsers treat them as
+// the same cookie.
+func guestCookie(r *http.Request, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     models.GuestCookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
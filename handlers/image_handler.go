@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"my-go-project/media"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/storage"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAltTextLen caps an image's alt text, in characters.
+const maxAltTextLen = 300
+
+type ImageHandler struct {
+	images    repository.ImageStore
+	blobs     storage.BlobStore
+	maxBytes  int64
+	maxPixels int
+}
+
+// NewImageHandler serves product galleries. Uploads larger than maxBytes or
+// with more than maxPixels pixels are refused.
+func NewImageHandler(images repository.ImageStore, blobs storage.BlobStore, maxBytes int64, maxPixels int) *ImageHandler {
+	return &ImageHandler{images: images, blobs: blobs, maxBytes: maxBytes, maxPixels: maxPixels}
+}
+
+// withImageURLs fills in where each image's files can be fetched.
+func withImageURLs(blobs storage.BlobStore, images []models.ProductImage) {
+	for i := range images {
+		withImageURL(blobs, &images[i])
+	}
+}
+
+func withImageURL(blobs storage.BlobStore, img *models.ProductImage) {
+	img.Url = blobs.URL(img.Original_key)
+	img.Thumbnail_url = blobs.URL(img.Thumb_key)
+	img.Medium_url = blobs.URL(img.Medium_key)
+}
+
+// ***********************list images*********************************************
+func (h *ImageHandler) ListImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	images, err := h.images.ListProductImages(r.Context(), productID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve images")
+		return
+	}
+	withImageURLs(h.blobs, images)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images)
+}
+
+// ***********************upload image (staff)*********************************************
+// UploadImageHandler takes a multipart/form-data body with the file in the
+// "image" field and optional "alt_text". The type is sniffed from the file's
+// bytes; the content type the client declares is ignored.
+func (h *ImageHandler) UploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	// leave room for the multipart framing and the alt text around the file
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes+64<<10)
+	data, altText, ok := h.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	processed, err := media.Process(data, h.maxPixels)
+	var tooLarge *media.TooLargeError
+	switch {
+	case errors.Is(err, media.ErrUnsupportedType):
+		writeError(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", "Image must be JPEG, PNG, GIF or WebP", nil)
+		return
+	case errors.As(err, &tooLarge):
+		writeError(w, r, http.StatusRequestEntityTooLarge, "image_too_large", "Image has too many pixels",
+			map[string]int{"width": tooLarge.Width, "height": tooLarge.Height, "max_pixels": tooLarge.MaxPixels})
+		return
+	case errors.Is(err, media.ErrInvalidImage):
+		writeError(w, r, http.StatusBadRequest, "invalid_image", "Image could not be decoded", nil)
+		return
+	case err != nil:
+		log.Println("Error processing image:", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Failed to process image", nil)
+		return
+	}
+
+	prefix, err := imageKeyPrefix(productID)
+	if err != nil {
+		log.Println("Error generating image key:", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Failed to store image", nil)
+		return
+	}
+	img := models.ProductImage{
+		Product_id:   productID,
+		Alt_text:     altText,
+		Content_type: processed.Original.ContentType,
+		Width:        processed.Original.Width,
+		Height:       processed.Original.Height,
+		Size:         len(data),
+		Original_key: prefix + "original." + processed.Original.Ext,
+		Thumb_key:    prefix + "thumb." + processed.Thumb.Ext,
+		Medium_key:   prefix + "medium." + processed.Medium.Ext,
+	}
+	renditions := map[string]media.Rendition{
+		img.Original_key: processed.Original,
+		img.Thumb_key:    processed.Thumb,
+		img.Medium_key:   processed.Medium,
+	}
+
+	var stored []string
+	for key, rendition := range renditions {
+		if err := h.blobs.Put(r.Context(), key, rendition.Data, rendition.ContentType); err != nil {
+			log.Println("Error storing image:", err)
+			h.deleteBlobs(stored...)
+			writeError(w, r, http.StatusBadGateway, "storage_error", "Failed to store image", nil)
+			return
+		}
+		stored = append(stored, key)
+	}
+
+	created, err := h.images.AddProductImage(r.Context(), img)
+	if err != nil {
+		h.deleteBlobs(stored...)
+		writeRepoError(w, r, err, "Failed to add image")
+		return
+	}
+	images := []models.ProductImage{created}
+	withImageURLs(h.blobs, images)
+	writeCreated(w, fmt.Sprintf("/products/%d/images/%d", productID, created.Image_id), images[0])
+}
+
+// readUpload reads the "image" and "alt_text" fields of a multipart upload,
+// answering the request itself when they are missing or too big.
+func (h *ImageHandler) readUpload(w http.ResponseWriter, r *http.Request) ([]byte, string, bool) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Body must be multipart/form-data", nil)
+		return nil, "", false
+	}
+
+	var data []byte
+	var altText string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.writeReadError(w, r, err)
+			return nil, "", false
+		}
+
+		switch part.FormName() {
+		case "image":
+			if data != nil {
+				writeError(w, r, http.StatusBadRequest, "invalid_body", "Upload one image at a time", nil)
+				return nil, "", false
+			}
+			data, err = io.ReadAll(io.LimitReader(part, h.maxBytes+1))
+		case "alt_text":
+			var b []byte
+			b, err = io.ReadAll(io.LimitReader(part, 4*maxAltTextLen+1))
+			altText = string(b)
+		}
+		part.Close()
+		if err != nil {
+			h.writeReadError(w, r, err)
+			return nil, "", false
+		}
+		if int64(len(data)) > h.maxBytes {
+			h.writeReadError(w, r, &http.MaxBytesError{Limit: h.maxBytes})
+			return nil, "", false
+		}
+	}
+
+	if len(data) == 0 {
+		writeError(w, r, http.StatusBadRequest, "missing_file", "The image field is required", nil)
+		return nil, "", false
+	}
+	altText = strings.TrimSpace(altText)
+	if !utf8.ValidString(altText) || utf8.RuneCountInString(altText) > maxAltTextLen {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", fmt.Sprintf("Alt_text must be at most %d characters", maxAltTextLen), nil)
+		return nil, "", false
+	}
+	return data, altText, true
+}
+
+// writeReadError answers a failure to read an upload: 413 when it ran past the
+// size limit, 400 otherwise.
+func (h *ImageHandler) writeReadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "file_too_large", "Image file is too large",
+			map[string]int64{"max_bytes": h.maxBytes})
+		return
+	}
+	writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid multipart body", nil)
+}
+
+// ***********************update image (staff)*********************************************
+func (h *ImageHandler) UpdateImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, ok := imagePath(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Alt_text string
+		Position int
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	body.Alt_text = strings.TrimSpace(body.Alt_text)
+	if utf8.RuneCountInString(body.Alt_text) > maxAltTextLen {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", fmt.Sprintf("Alt_text must be at most %d characters", maxAltTextLen), nil)
+		return
+	}
+	if body.Position < 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Position cannot be negative", nil)
+		return
+	}
+
+	updated, err := h.images.UpdateProductImage(r.Context(), productID, imageID, body.Alt_text, body.Position)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update image")
+		return
+	}
+	images := []models.ProductImage{updated}
+	withImageURLs(h.blobs, images)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images[0])
+}
+
+// ***********************delete image (staff)*********************************************
+func (h *ImageHandler) DeleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, ok := imagePath(w, r)
+	if !ok {
+		return
+	}
+
+	img, err := h.images.DeleteProductImage(r.Context(), productID, imageID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to delete image")
+		return
+	}
+	// the row is gone, so a file left behind is only wasted space
+	h.deleteBlobs(img.Original_key, img.Thumb_key, img.Medium_key)
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteBlobs removes files of an image, logging rather than failing, and
+// keeps going after the client has gone away.
+func (h *ImageHandler) deleteBlobs(keys ...string) {
+	ctx := context.Background()
+	for _, key := range keys {
+		if err := h.blobs.Delete(ctx, key); err != nil {
+			log.Println("Error deleting image file:", key, err)
+		}
+	}
+}
+
+// imageKeyPrefix returns a fresh "products/{id}/{random}/" prefix, so an
+// uploaded file is never overwritten and can be cached forever.
+func imageKeyPrefix(productID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("products/%d/%s/", productID, hex.EncodeToString(b)), nil
+}
+
+// imagePath reads the {id} and {image_id} path variables.
+func imagePath(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return 0, 0, false
+	}
+	imageID, err := strconv.Atoi(vars["image_id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid image ID", nil)
+		return 0, 0, false
+	}
+	return productID, imageID, true
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxReasonLen bounds the reason recorded with a stock adjustment.
+const maxReasonLen = 200
+
+type InventoryHandler struct {
+	inventory repository.InventoryStore
+}
+
+func NewInventoryHandler(inventory repository.InventoryStore) *InventoryHandler {
+	return &InventoryHandler{inventory: inventory}
+}
+
+// ***********************stock level*********************************************
+func (h *InventoryHandler) GetStockHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	level, err := h.inventory.GetStock(r.Context(), id)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve stock")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(level)
+}
+
+// ***********************stock adjustment*********************************************
+// AdjustStockHandler adds Delta (negative to remove) to a product's stock, or
+// to one of its variants' when Variant_id is set. Every adjustment needs a
+// Reason, which is kept in the inventory ledger.
+func (h *InventoryHandler) AdjustStockHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	var body struct {
+		Variant_id int
+		Delta      int
+		Reason     string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Delta == 0 || body.Reason == "" || len(body.Reason) > maxReasonLen {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Delta must be non-zero and Reason is required", nil)
+		return
+	}
+
+	entry, err := h.inventory.AdjustStock(r.Context(), id, body.Variant_id, body.Delta, body.Reason, userID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to adjust stock")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// ***********************inventory ledger*********************************************
+func (h *InventoryHandler) LedgerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+	page, ok := pageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.inventory.ListInventoryLedger(r.Context(), id, page)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve inventory ledger")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
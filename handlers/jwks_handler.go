@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"encoding/json"
+	"my-go-project/auth"
+	"net/http"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeyManager
+}
+
+func NewJWKSHandler(keys *auth.KeyManager) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// ************************public signing keys*****************************
+// Verifiers cache the set; a key is published from the moment it is loaded,
+// before it becomes active, so a short max-age is enough for rotation.
+func (h *JWKSHandler) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.keys.JWKS())
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+)
+
+// ownedOrder loads the caller's order in the {id} path variable. Someone else's
+// order is reported as not found. It writes the error response itself and
+// returns false when the handler should stop.
+func ownedOrder(w http.ResponseWriter, r *http.Request, orders repository.OrderStore, userID int) (models.Orders, bool) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid order ID", nil)
+		return models.Orders{}, false
+	}
+
+	order, err := orders.GetOrder(r.Context(), userID, orderID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve order")
+		return models.Orders{}, false
+	}
+	return order, true
+}
+
+// writeTransitionResult answers a TransitionOrder call.
+func writeTransitionResult(w http.ResponseWriter, r *http.Request, order models.Orders, err error) {
+	if errors.Is(err, repository.ErrInvalidTransition) {
+		writeError(w, r, http.StatusConflict, "invalid_transition", "Order cannot move to that status", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update order status")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// ********************advance order (fulfilment)***************************************
+// Paid and refunded are reached only through payments, and cancelled through
+// the cancel endpoint, so this only accepts the fulfilment steps.
+func (h *UserHandler) AdvanceOrderHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid order ID", nil)
+		return
+	}
+
+	var body struct {
+		Status string
+		Note   string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	switch body.Status {
+	case models.OrderFulfilled, models.OrderShipped, models.OrderDelivered:
+	default:
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Status must be one of fulfilled, shipped or delivered", nil)
+		return
+	}
+
+	order, err := h.orders.TransitionOrder(r.Context(), orderID, body.Status, userID, body.Note)
+	writeTransitionResult(w, r, order, err)
+}
+
+// ********************cancel order***************************************
+func (h *UserHandler) CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	order, ok := ownedOrder(w, r, h.orders, userID)
+	if !ok {
+		return
+	}
+
+	order, err := h.orders.TransitionOrder(r.Context(), order.Order_id, models.OrderCancelled, userID, "cancelled by customer")
+	writeTransitionResult(w, r, order, err)
+}
+
+// ********************order timeline***************************************
+func (h *UserHandler) OrderTimelineHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	order, ok := ownedOrder(w, r, h.orders, userID)
+	if !ok {
+		return
+	}
+
+	timeline, err := h.orders.GetOrderTimeline(r.Context(), order.Order_id)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve order timeline")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
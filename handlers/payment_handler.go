@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"my-go-project/models"
+	"my-go-project/payments"
+	"my-go-project/pricing"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+)
+
+// PaymentHandler charges orders through provider. currency is the provider's
+// settlement currency; orders priced in any other currency cannot be paid.
+type PaymentHandler struct {
+	payments repository.PaymentStore
+	orders   repository.OrderStore
+	cards    repository.CreditCardStore
+	provider payments.PaymentProvider
+	currency string
+}
+
+func NewPaymentHandler(paymentStore repository.PaymentStore, orders repository.OrderStore, cards repository.CreditCardStore, provider payments.PaymentProvider, currency string) *PaymentHandler {
+	return &PaymentHandler{payments: paymentStore, orders: orders, cards: cards, provider: provider, currency: currency}
+}
+
+// ************************pay for an order*****************************
+func (h *PaymentHandler) PayOrderHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	order, ok := ownedOrder(w, r, h.orders, userID)
+	if !ok {
+		return
+	}
+
+	// the body is optional; without a Card_id the default card is charged
+	var body struct {
+		Card_id int
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if order.Status != models.OrderPending {
+		writeError(w, r, http.StatusConflict, "invalid_order_state", "Order is not awaiting payment", nil)
+		return
+	}
+	if order.TotalPrice.Currency != h.currency {
+		writeError(w, r, http.StatusBadRequest, "currency_mismatch",
+			fmt.Sprintf("Payments are taken in %s, the order is priced in %s", h.currency, order.TotalPrice.Currency), nil)
+		return
+	}
+
+	// only checkout prices an order on the server; orders without its delivery
+	// details were priced by the client and are never charged
+	if order.Ship_to == nil {
+		writeError(w, r, http.StatusConflict, "not_checked_out", "Only orders placed through checkout can be paid", nil)
+		return
+	}
+	items, err := h.orders.GetOrderItems(r.Context(), order.Order_id)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve order")
+		return
+	}
+	total, err := pricing.OrderTotal(order, items)
+	if err != nil || total != order.TotalPrice {
+		log.Println("Order total does not match its lines:", order.Order_id, order.TotalPrice, total, err)
+		writeError(w, r, http.StatusConflict, "total_mismatch", "Order total does not match its lines", nil)
+		return
+	}
+
+	var card models.CreditCard
+	if body.Card_id == 0 {
+		card, err = h.cards.GetDefaultCreditCard(r.Context(), userID)
+	} else {
+		card, err = h.cards.GetCreditCard(r.Context(), userID, body.Card_id)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "not_found", "Credit card not found", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve credit card")
+		return
+	}
+
+	// cards saved before tokenization have no token and cannot be charged
+	if card.Token == "" {
+		writeError(w, r, http.StatusConflict, "card_not_tokenized", "Credit card must be added again before it can be charged", nil)
+		return
+	}
+
+	payment, err := h.payments.CreatePayment(r.Context(), models.Payment{
+		Order_id: order.Order_id,
+		Card_id:  card.Card_id,
+		Method:   "card",
+		Amount:   total,
+		Status:   models.PaymentPending,
+	})
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to create payment")
+		return
+	}
+
+	auth, err := h.provider.Authorize(r.Context(), payments.AuthorizeRequest{
+		OrderID: order.Order_id,
+		Amount:  payment.Amount,
+		Card:    payments.Card{Token: card.Token, Last4: card.Last4},
+	})
+	if err != nil {
+		h.failPayment(r, payment.Payment_id, err)
+		if errors.Is(err, payments.ErrDeclined) {
+			writeError(w, r, http.StatusPaymentRequired, "payment_declined", "Payment declined", nil)
+			return
+		}
+		writeError(w, r, http.StatusBadGateway, "provider_error", "Payment provider error", nil)
+		return
+	}
+
+	if err := h.payments.SetPaymentStatus(r.Context(), payment.Payment_id, models.PaymentAuthorized, auth.Reference); err != nil {
+		writeRepoError(w, r, err, "Failed to update payment")
+		return
+	}
+
+	if _, err := h.provider.Capture(r.Context(), auth.Reference, payment.Amount); err != nil {
+		h.failPayment(r, payment.Payment_id, err)
+		writeError(w, r, http.StatusBadGateway, "provider_error", "Payment provider error", nil)
+		return
+	}
+
+	paid, err := h.payments.MarkPaymentCaptured(r.Context(), payment.Payment_id, auth.Reference, userID)
+	if errors.Is(err, repository.ErrInvalidTransition) {
+		// the order changed while we were charging it; give the money back
+		if _, rerr := h.provider.Refund(r.Context(), auth.Reference, payment.Amount); rerr != nil {
+			log.Println("Error refunding payment for order that is no longer pending:", payment.Payment_id, rerr)
+		} else if serr := h.payments.SetPaymentStatus(r.Context(), payment.Payment_id, models.PaymentRefunded, ""); serr != nil {
+			log.Println("Error recording refund:", payment.Payment_id, serr)
+		}
+		writeError(w, r, http.StatusConflict, "invalid_order_state", "Order is not awaiting payment", nil)
+		return
+	}
+	if err != nil {
+		log.Println("Error recording captured payment:", payment.Payment_id, auth.Reference, err)
+		writeRepoError(w, r, err, "Failed to record payment")
+		return
+	}
+
+	writeCreated(w, fmt.Sprintf("/users/orders/%d/payments", order.Order_id), paid)
+}
+
+func (h *PaymentHandler) failPayment(r *http.Request, paymentID int, cause error) {
+	log.Println("Payment failed:", paymentID, cause)
+	if err := h.payments.SetPaymentStatus(r.Context(), paymentID, models.PaymentFailed, ""); err != nil {
+		log.Println("Error marking payment failed:", paymentID, err)
+	}
+}
+
+// ************************payments of an order*****************************
+func (h *PaymentHandler) ListOrderPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	order, ok := ownedOrder(w, r, h.orders, userID)
+	if !ok {
+		return
+	}
+
+	list, err := h.payments.ListOrderPayments(r.Context(), order.Order_id)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve payments")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ************************refund a payment*****************************
+// RefundPaymentHandler is for staff: it refunds any captured payment, and the
+// caller is recorded as the actor on the order's timeline.
+func (h *PaymentHandler) RefundPaymentHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	paymentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid payment ID", nil)
+		return
+	}
+
+	// claim the payment first, so a second refund of it never reaches the provider
+	payment, err := h.payments.ClaimRefund(r.Context(), paymentID)
+	if errors.Is(err, repository.ErrNotRefundable) {
+		writeError(w, r, http.StatusConflict, "not_refundable", "Payment cannot be refunded", nil)
+		return
+	}
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to claim payment")
+		return
+	}
+
+	if _, err := h.provider.Refund(r.Context(), payment.Provider_ref, payment.Amount); err != nil {
+		log.Println("Error refunding payment:", payment.Payment_id, err)
+		if serr := h.payments.SetPaymentStatus(r.Context(), payment.Payment_id, models.PaymentCaptured, ""); serr != nil {
+			log.Println("Error releasing refund claim:", payment.Payment_id, serr)
+		}
+		writeError(w, r, http.StatusBadGateway, "provider_error", "Payment provider error", nil)
+		return
+	}
+
+	refunded, err := h.payments.MarkPaymentRefunded(r.Context(), payment.Payment_id, userID)
+	if err != nil {
+		// the provider has refunded it; the payment stays refund_pending so it is not refunded again
+		log.Println("Error recording refund:", payment.Payment_id, err)
+		writeRepoError(w, r, err, "Failed to record refund")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refunded)
+}
@@ -2,34 +2,54 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"my-go-project/models"
+	"my-go-project/payments"
 	"my-go-project/repository"
+	"my-go-project/storage"
 	"net/http"
 	"strconv"
 )
 
 type ProductHandler struct {
-	repo *repository.ProductRepository
+	repo  repository.ProductStore
+	blobs storage.BlobStore
 }
 
 type UserHandler struct {
-	repo *repository.UserRepository
+	users  repository.UserStore
+	carts  repository.CartStore
+	guests repository.GuestCartStore
+	orders repository.OrderStore
+	cards  repository.CreditCardStore
+	vault  payments.Vault
+	blobs  storage.BlobStore
 }
 
-func NewProductHandler(repo *repository.ProductRepository) *ProductHandler {
-	return &ProductHandler{repo: repo}
+// NewProductHandler serves the catalog; blobs resolves the URLs of product
+// images.
+func NewProductHandler(repo repository.ProductStore, blobs storage.BlobStore) *ProductHandler {
+	return &ProductHandler{repo: repo, blobs: blobs}
 }
 
-func NewUserHandler(repo *repository.UserRepository) *UserHandler {
-	return &UserHandler{repo: repo}
+// NewUserHandler serves accounts, carts, guest carts and orders; blobs
+// resolves the URLs of the product images shown in carts.
+func NewUserHandler(users repository.UserStore, carts repository.CartStore, guests repository.GuestCartStore, orders repository.OrderStore, cards repository.CreditCardStore, vault payments.Vault, blobs storage.BlobStore) *UserHandler {
+	return &UserHandler{users: users, carts: carts, guests: guests, orders: orders, cards: cards, vault: vault, blobs: blobs}
 }
 
 // ***********************get products*********************************************
 func (h *ProductHandler) GetProductsHandler(w http.ResponseWriter, r *http.Request) {
-	products, err := h.repo.GetAllProducts()
+	filter, ok := productFilter(w, r)
+	if !ok {
+		return
+	}
+
+	products, err := h.repo.GetAllProducts(r.Context(), filter)
 	if err != nil {
-		http.Error(w, "Failed to retrieve products", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to retrieve products")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -40,21 +60,47 @@ func (h *ProductHandler) GetProductsHandler(w http.ResponseWriter, r *http.Reque
 func (h *ProductHandler) CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 	var p models.Products
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if p.Product_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Product_id is assigned by the server", nil)
+		return
+	}
+	if p.Stock != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Stock is set through inventory adjustments", nil)
+		return
+	}
+
+	if p.Product_name == "" || p.Price.Amount <= 0 || p.Weight_grams < 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Invalid product data", nil)
 		return
 	}
 
-	if p.Product_name == "" || p.Price <= 0 {
-		http.Error(w, "Invalid product data", http.StatusBadRequest)
+	created, err := h.repo.CreateProduct(r.Context(), p)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to add product")
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/products/%d", created.Product_id), created)
+}
+
+// **********************get product by id **********************************************
+func (h *ProductHandler) GetProductHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
 		return
 	}
 
-	err := h.repo.CreateProduct(p)
+	p, err := h.repo.GetProduct(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Failed to add product", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to retrieve product")
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	withImageURLs(h.blobs, p.Images)
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(p)
 }
 
@@ -63,33 +109,47 @@ func (h *ProductHandler) DeleteProductHandler(w http.ResponseWriter, r *http.Req
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
 		return
 	}
-	err = h.repo.DeleteProduct(id)
+	err = h.repo.DeleteProduct(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Failed to delete product", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to delete product")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
 // **********************update product ***************************************
+// UpdateProductHandler updates the product named by the path. The body may
+// leave Product_id out, but may not name another product.
 func (h *ProductHandler) UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
 	var p models.Products
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+
+	if p.Product_id != 0 && p.Product_id != id {
+		writeError(w, r, http.StatusBadRequest, "id_mismatch", "Product_id does not match the product in the path", nil)
 		return
 	}
+	p.Product_id = id
 
-	if p.Product_id == 0 || p.Product_name == "" || p.Price <= 0 {
-		http.Error(w, "Invalid product data", http.StatusBadRequest)
+	if p.Product_name == "" || p.Price.Amount <= 0 || p.Weight_grams < 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Invalid product data", nil)
 		return
 	}
 
-	err := h.repo.UpdateProduct(p)
+	err = h.repo.UpdateProduct(r.Context(), p)
 	if err != nil {
-		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to update product")
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -99,9 +159,14 @@ func (h *ProductHandler) UpdateProductHandler(w http.ResponseWriter, r *http.Req
 func (h *ProductHandler) GetProductSalesHandler(w http.ResponseWriter, r *http.Request) {
 	username := mux.Vars(r)["username"]
 
-	sales, err := h.repo.GetProductSales(username)
+	page, ok := pageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	sales, err := h.repo.GetProductSales(r.Context(), username, page)
 	if err != nil {
-		http.Error(w, "Failed to retrieve sales", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to retrieve sales")
 		return
 	}
 
@@ -112,9 +177,14 @@ func (h *ProductHandler) GetProductSalesHandler(w http.ResponseWriter, r *http.R
 // *************************************************************************************************
 // *******************get all users **********************************
 func (h *UserHandler) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
-	users, err := h.repo.GetAllUsers()
+	page, ok := pageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := h.users.GetAllUsers(r.Context(), page)
 	if err != nil {
-		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to retrieve users")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -126,222 +196,197 @@ func (h *UserHandler) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	var user models.Users
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
 		return
 	}
 
-	if user.User_name == "" || user.Password == "" || user.Email == "" || user.Address == "" {
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	if user.User_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "User_id is assigned by the server", nil)
 		return
 	}
 
-	err := h.repo.CreateUser(user)
-	if err != nil {
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+	if user.Role != "" && user.Role != models.RoleCustomer {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Role is assigned by an admin", nil)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully", "username": user.User_name})
-}
-
-// ************************login*****************************
-func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	var loginData struct {
-		Email    string
-		Password string
+	if user.User_name == "" || user.Password == "" || user.Email == "" {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Missing required fields", nil)
+		return
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&loginData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	address, ok := repository.NormalizeAddress(user.Address)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", addressMessage, nil)
 		return
 	}
+	user.Address = address
 
-	if loginData.Email == "" || loginData.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+	created, err := h.users.CreateUser(r.Context(), user)
+	if errors.Is(err, repository.ErrConflict) {
+		writeError(w, r, http.StatusConflict, "email_taken", "Email is already registered", nil)
 		return
 	}
-
-	token, err := h.repo.LoginUser(loginData.Email, loginData.Password)
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		writeRepoError(w, r, err, "Failed to create user")
 		return
 	}
+	h.mergeGuestCart(w, r, created.User_id)
 
-	// give me token
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	writeCreated(w, fmt.Sprintf("/users/%d", created.User_id), map[string]interface{}{
+		"message":  "User registered successfully",
+		"user_id":  created.User_id,
+		"username": created.User_name,
+	})
 }
 
-// *********************add credit card *******************************
-func (h *UserHandler) AddCreditCardHandler(w http.ResponseWriter, r *http.Request) {
-
+// ************************get user by id*****************************
+// GetUserHandler returns a user's record to that user or to an admin; anyone
+// else gets the same 404 as for a user that does not exist.
+func (h *UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(int)
 	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
 		return
 	}
 
-	var card models.CreditCard
-	if err := json.NewDecoder(r.Body).Decode(&card); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid user ID", nil)
 		return
 	}
 
-	if card.Card_id == 0 || card.User_id == 0 || card.Card_num == "" {
-		http.Error(w, "All fields are required", http.StatusBadRequest)
+	if role, _ := r.Context().Value("role").(string); id != userID && role != models.RoleAdmin {
+		writeError(w, r, http.StatusNotFound, "not_found", "User not found", nil)
 		return
 	}
 
-	err := h.repo.AddCreditCard(userID, card)
+	user, err := h.users.GetUser(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Failed to add credit card", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to retrieve user")
 		return
 	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Credit card added successfully"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
 }
 
-// *****************************delete credit card ********************************
-func (h *UserHandler) DeleteCreditCardHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cardID, err := strconv.Atoi(vars["card_id"])
-	if err != nil {
-		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+// ************************change user role (admin)*****************************
+func (h *UserHandler) SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
 		return
 	}
 
-	err = h.repo.DeleteCreditCard(cardID)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Failed to delete credit card", http.StatusInternalServerError)
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid user ID", nil)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Credit card deleted successfully"))
-}
+	if id == adminID {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "You cannot change your own role", nil)
+		return
+	}
 
-// ************************add product in cart ***************************************
-func (h *UserHandler) AddCartProductHandler(w http.ResponseWriter, r *http.Request) {
-	// decode
-	var cartProduct models.CartProduct
-	if err := json.NewDecoder(r.Body).Decode(&cartProduct); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var body struct {
+		Role string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
 		return
 	}
 
-	if cartProduct.CP_id == 0 || cartProduct.Cart_id == 0 || cartProduct.Product_id == 0 || cartProduct.Quantity <= 0 {
-		http.Error(w, "All fields are required", http.StatusBadRequest)
+	switch body.Role {
+	case models.RoleCustomer, models.RoleStaff, models.RoleAdmin:
+	default:
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Role must be one of customer, staff or admin", nil)
 		return
 	}
 
-	err := h.repo.AddCartProduct(cartProduct)
+	user, err := h.users.SetUserRole(r.Context(), id, body.Role)
 	if err != nil {
-		http.Error(w, "Failed to add product to cart", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to update user role")
 		return
 	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": " cartadded successfully"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
 }
 
-//***************add cart ***************************************
-
-func (h *UserHandler) AddCartHandler(w http.ResponseWriter, r *http.Request) {
+// ************************login*****************************
+func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var loginData struct {
+		Email    string
+		Password string
+	}
 
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+	if err := json.NewDecoder(r.Body).Decode(&loginData); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
 		return
 	}
 
-	var cart models.Cart
-	if err := json.NewDecoder(r.Body).Decode(&cart); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if loginData.Email == "" || loginData.Password == "" {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Email and password are required", nil)
 		return
 	}
 
-	if cart.Cart_id == 0 {
-		http.Error(w, "Cart ID cannot be zero", http.StatusBadRequest)
+	pair, err := h.users.LoginUser(r.Context(), loginData.Email, loginData.Password)
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		writeError(w, r, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password", nil)
 		return
 	}
-
-	err := h.repo.AddCart(userID, cart)
 	if err != nil {
-		http.Error(w, "Failed to add cart", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to log in")
 		return
 	}
+	h.mergeGuestCart(w, r, pair.User_id)
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Cart added successfully"})
+	// give me token
+	writeTokenPair(w, pair)
 }
 
-// *********************get cart *****************************************
-func (h *UserHandler) GetCartHandler(w http.ResponseWriter, r *http.Request) {
+// ********************get order***************************************
+func (h *UserHandler) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	userID, ok := r.Context().Value("userID").(int)
 	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
 		return
 	}
 
-	carts, err := h.repo.GetAllCart(userID)
-	if err != nil {
-		http.Error(w, "Failed to retrieve cart products", http.StatusInternalServerError)
+	order, ok := ownedOrder(w, r, h.orders, userID)
+	if !ok {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(carts)
+	json.NewEncoder(w).Encode(order)
 }
 
-// ********************add order***************************************
-func (h *UserHandler) AddOrderHandler(w http.ResponseWriter, r *http.Request) {
-
-	var order models.Orders
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	if order.Order_id == 0 || order.TotalPrice == 0 || order.Status == "" {
-		http.Error(w, "All fields are required", http.StatusBadRequest)
-		return
-	}
+// ********************************checkout********************************
+func (h *UserHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
 
-	err := h.repo.AddOrder(order)
-	if err != nil {
-		http.Error(w, "Failed to add order ", http.StatusInternalServerError)
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": " ordered successfully"})
-}
-
-// ************************details of order****************************
-func (h *UserHandler) AddOrderProductHandler(w http.ResponseWriter, r *http.Request) {
-
-	var orderProduct models.OrderProduct
-	if err := json.NewDecoder(r.Body).Decode(&orderProduct); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	d, ok := deliveryRequest(w, r)
+	if !ok {
 		return
 	}
 
-	if orderProduct.OP_id == 0 || orderProduct.Order_id == 0 || orderProduct.Product_id == 0 || orderProduct.Quantity <= 0 || orderProduct.Price_update == 0 {
-		http.Error(w, "All fields are required", http.StatusBadRequest)
+	checkout, err := h.orders.Checkout(r.Context(), userID, d)
+	if errors.Is(err, repository.ErrEmptyCart) {
+		writeError(w, r, http.StatusBadRequest, "cart_empty", "Cart is empty", nil)
 		return
 	}
-
-	err := h.repo.AddOrderProduct(orderProduct)
 	if err != nil {
-		http.Error(w, "Failed to add order to product", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to check out")
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": " ordered product successfully"})
+	writeCreated(w, fmt.Sprintf("/users/orders/%d", checkout.Order.Order_id), checkout)
 }
 
 // ********************************get all orders********************************
@@ -349,13 +394,18 @@ func (h *UserHandler) GetHistoryOrder(w http.ResponseWriter, r *http.Request) {
 
 	userID, ok := r.Context().Value("userID").(int)
 	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", "User ID not found in token", nil)
+		return
+	}
+
+	page, ok := pageRequest(w, r)
+	if !ok {
 		return
 	}
 
-	orders, err := h.repo.GetHistory(userID)
+	orders, err := h.orders.GetHistory(r.Context(), userID, page)
 	if err != nil {
-		http.Error(w, "Failed to retrieve cart products", http.StatusInternalServerError)
+		writeRepoError(w, r, err, "Failed to retrieve cart products")
 		return
 	}
 
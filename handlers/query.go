@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"my-go-project/money"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxSearchQueryLen caps the q parameter of the search endpoints, in bytes.
+const maxSearchQueryLen = 200
+
+// pageRequest reads the limit and cursor query parameters of a paginated list.
+// On a malformed limit it answers 400 and returns false.
+func pageRequest(w http.ResponseWriter, r *http.Request) (repository.PageRequest, bool) {
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return repository.PageRequest{}, false
+	}
+	return repository.PageRequest{Limit: limit, Cursor: r.URL.Query().Get("cursor")}, true
+}
+
+// queryLimit reads the limit query parameter, 0 when it is absent. The store
+// clamps it to its own maximum. On a malformed limit it answers 400 and
+// returns false.
+func queryLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "limit must be a positive integer", nil)
+		return 0, false
+	}
+	return limit, true
+}
+
+// searchQuery reads the q query parameter of the search endpoints. On a
+// missing or overlong q it answers 400 and returns false.
+func searchQuery(w http.ResponseWriter, r *http.Request) (string, bool) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "q is required", nil)
+		return "", false
+	}
+	if len(q) > maxSearchQueryLen {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "q is too long", nil)
+		return "", false
+	}
+	return q, true
+}
+
+// productFilter reads the filter, sort and page query parameters of
+// GET /products. On a malformed parameter it answers 400 and returns false.
+func productFilter(w http.ResponseWriter, r *http.Request) (repository.ProductFilter, bool) {
+	page, ok := pageRequest(w, r)
+	if !ok {
+		return repository.ProductFilter{}, false
+	}
+
+	q := r.URL.Query()
+	f := repository.ProductFilter{
+		Currency:    strings.ToUpper(q.Get("currency")),
+		Name:        q.Get("name"),
+		Category:    q.Get("category"),
+		Tag:         q.Get("tag"),
+		Sort:        q.Get("sort"),
+		PageRequest: page,
+	}
+	if !repository.ValidProductSort(f.Sort) {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "sort must be one of newest, price, -price, name or -name", nil)
+		return repository.ProductFilter{}, false
+	}
+
+	var err error
+	if f.MinPrice, err = optionalPrice(q.Get("min_price")); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "min_price must be a non-negative integer", nil)
+		return repository.ProductFilter{}, false
+	}
+	if f.MaxPrice, err = optionalPrice(q.Get("max_price")); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "max_price must be a non-negative integer", nil)
+		return repository.ProductFilter{}, false
+	}
+	if f.Currency != "" && !money.KnownCurrency(f.Currency) {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "currency must be an ISO 4217 code", nil)
+		return repository.ProductFilter{}, false
+	}
+	// price bounds are minor units, which only mean something in one currency
+	if f.Currency == "" && (f.MinPrice != nil || f.MaxPrice != nil) {
+		writeError(w, r, http.StatusBadRequest, "invalid_query", "min_price and max_price need a currency", nil)
+		return repository.ProductFilter{}, false
+	}
+	return f, true
+}
+
+// optionalPrice parses a price bound in minor units; an empty value means no
+// bound.
+func optionalPrice(v string) (*int64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return nil, strconv.ErrSyntax
+	}
+	return &n, nil
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeCreated answers a successful create with 201, a Location header
+// pointing at the new resource and the resource itself as JSON.
+func writeCreated(w http.ResponseWriter, location string, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ***********************search products*********************************************
+func (h *ProductHandler) SearchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := searchQuery(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := h.repo.SearchProducts(r.Context(), q, limit)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to search products")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// ***********************suggest products*********************************************
+func (h *ProductHandler) SuggestProductsHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := searchQuery(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(w, r)
+	if !ok {
+		return
+	}
+
+	suggestions, err := h.repo.SuggestProducts(r.Context(), q, limit)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to suggest products")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type VariantHandler struct {
+	variants repository.VariantStore
+}
+
+func NewVariantHandler(variants repository.VariantStore) *VariantHandler {
+	return &VariantHandler{variants: variants}
+}
+
+// ***********************list variants*********************************************
+func (h *VariantHandler) ListVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	variants, err := h.variants.ListVariants(r.Context(), productID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to retrieve variants")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(variants)
+}
+
+// ***********************add variant (staff)*********************************************
+func (h *VariantHandler) CreateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return
+	}
+
+	var v models.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	if v.Variant_id != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Variant_id is assigned by the server", nil)
+		return
+	}
+	v.Product_id = productID
+	if !validVariant(w, r, &v) {
+		return
+	}
+
+	created, err := h.variants.CreateVariant(r.Context(), v)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to add variant")
+		return
+	}
+	writeCreated(w, fmt.Sprintf("/products/%d/variants/%d", productID, created.Variant_id), created)
+}
+
+// ***********************update variant (staff)*********************************************
+func (h *VariantHandler) UpdateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, variantID, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	var v models.ProductVariant
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body", "Invalid request body", nil)
+		return
+	}
+	v.Product_id, v.Variant_id = productID, variantID
+	if !validVariant(w, r, &v) {
+		return
+	}
+
+	updated, err := h.variants.UpdateVariant(r.Context(), v)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to update variant")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// ***********************delete variant (staff)*********************************************
+func (h *VariantHandler) DeleteVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, variantID, ok := variantPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.variants.DeleteVariant(r.Context(), productID, variantID)
+	if err != nil {
+		writeRepoError(w, r, err, "Failed to delete variant")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// variantPath reads the {id} and {variant_id} path variables.
+func variantPath(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid product ID", nil)
+		return 0, 0, false
+	}
+	variantID, err := strconv.Atoi(vars["variant_id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Invalid variant ID", nil)
+		return 0, 0, false
+	}
+	return productID, variantID, true
+}
+
+// validVariant checks a variant from a request body and normalizes its SKU
+// and options in place. Stock is not writable here; it changes through
+// inventory adjustments.
+func validVariant(w http.ResponseWriter, r *http.Request, v *models.ProductVariant) bool {
+	if v.Stock != 0 {
+		writeError(w, r, http.StatusBadRequest, "read_only_field", "Stock is set through inventory adjustments", nil)
+		return false
+	}
+	v.Sku = strings.TrimSpace(v.Sku)
+	if !repository.ValidSku(v.Sku) {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Sku must be letters, digits, dots, dashes or underscores", nil)
+		return false
+	}
+	options, ok := repository.NormalizeOptions(v.Options)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Options must be up to 5 distinct, non-empty name/value pairs", nil)
+		return false
+	}
+	v.Options = options
+	if v.Price != nil && v.Price.Amount <= 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Price must be positive; omit it to sell at the product price", nil)
+		return false
+	}
+	return true
+}
@@ -1,46 +1,165 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"my-go-project/auth"
+	"my-go-project/config"
 	"my-go-project/db"
 	"my-go-project/handlers"
+	"my-go-project/middlewares"
+	"my-go-project/payments"
+	"my-go-project/pricing"
 	"my-go-project/repository"
 	"my-go-project/routes"
+	"my-go-project/storage"
 	"net/http"
+	"time"
 	"github.com/rs/cors"
 )
 
 func main() {
+	//****************************config**********************
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("failed to load config: ", err)
+	}
+
 	//****************************connection**********************
-	dbPool, err := db.ConnectDB()
+	dbPool, err := db.ConnectDB(cfg.Database)
 	if err != nil {
 		log.Fatal("failed to connect with db", err)
 	}
 	defer dbPool.Close()
 
+	//****************************signing keys**********************
+	var keys *auth.KeyManager
+	if cfg.JWT.KeysDir != "" {
+		keys, err = auth.LoadKeyManager(cfg.JWT.KeysDir, cfg.JWT.Keys)
+		if err != nil {
+			log.Fatal("failed to load signing keys: ", err)
+		}
+	} else {
+		log.Println("jwt.keys_dir is not set; signing tokens with the HS256 secret")
+		keys = auth.NewHMACKeyManager([]byte(cfg.JWT.Secret))
+	}
+
 	//****************************repository**********************
-	productRepo := repository.NewProductRepository(dbPool)
-	userRepo := repository.NewUserRepository(dbPool)
+	productRepo := repository.NewProductRepository(dbPool, cfg.Database.QueryTimeout)
+	calc := pricing.NewCalculator(cfg.Shipping, cfg.Tax)
+	userRepo := repository.NewUserRepository(dbPool, cfg.JWT, cfg.Inventory, cfg.GuestCart, keys, calc, cfg.Database.QueryTimeout)
+	paymentRepo := repository.NewPaymentRepository(dbPool, cfg.Database.QueryTimeout)
+
+	//****************************payment provider**********************
+	// config validation only lets the fake provider through outside production
+	var paymentProvider payments.PaymentProvider
+	switch cfg.Payments.Provider {
+	case "fake":
+		log.Printf("%s: using the fake payment provider; no card is really charged", cfg.Server.Environment)
+		paymentProvider = payments.NewFakeProvider()
+	default:
+		log.Fatal("unsupported payment provider: ", cfg.Payments.Provider)
+	}
+
+	vaultKey, err := cfg.Payments.VaultKeyBytes()
+	if err != nil {
+		log.Fatal("invalid card vault key: ", err)
+	}
+	cardVault, err := payments.NewLocalVault(vaultKey, cfg.Payments.VaultPath)
+	if err != nil {
+		log.Fatal("failed to open card vault: ", err)
+	}
+
+	//****************************file storage**********************
+	var blobs storage.BlobStore
+	var media http.Handler
+	switch cfg.Storage.Backend {
+	case "s3":
+		blobs, err = storage.NewS3Store(storage.S3Options{
+			Endpoint:        cfg.Storage.S3.Endpoint,
+			Region:          cfg.Storage.S3.Region,
+			Bucket:          cfg.Storage.S3.Bucket,
+			AccessKeyID:     cfg.Storage.S3.AccessKeyID,
+			SecretAccessKey: cfg.Storage.S3.SecretAccessKey,
+			PathStyle:       cfg.Storage.S3.PathStyle,
+			PublicURL:       cfg.Storage.PublicURL,
+		})
+		if err != nil {
+			log.Fatal("invalid s3 storage settings: ", err)
+		}
+	default:
+		publicURL := cfg.Storage.PublicURL
+		if publicURL == "" {
+			publicURL = "/media"
+		}
+		local, err := storage.NewLocalStore(cfg.Storage.LocalDir, publicURL)
+		if err != nil {
+			log.Fatal("failed to open local storage: ", err)
+		}
+		blobs, media = local, local.Handler()
+	}
 
 	//****************************handlers**********************
-	productHandler := handlers.NewProductHandler(productRepo)
-	userHandler := handlers.NewUserHandler(userRepo)
+	productHandler := handlers.NewProductHandler(productRepo, blobs)
+	userHandler := handlers.NewUserHandler(userRepo, userRepo, userRepo, userRepo, userRepo, cardVault, blobs)
+	catalogHandler := handlers.NewCatalogHandler(productRepo, productRepo)
+	inventoryHandler := handlers.NewInventoryHandler(productRepo)
+	variantHandler := handlers.NewVariantHandler(productRepo)
+	imageHandler := handlers.NewImageHandler(productRepo, blobs, cfg.Images.MaxUploadBytes, cfg.Images.MaxPixels)
+	couponHandler := handlers.NewCouponHandler(userRepo)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+	paymentHandler := handlers.NewPaymentHandler(paymentRepo, userRepo, userRepo, paymentProvider, cfg.Payments.Currency)
+
+	//****************************stock holds**********************
+	// pending orders give their stock back once their hold runs out
+	go func() {
+		ticker := time.NewTicker(cfg.Inventory.SweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := userRepo.ExpireReservations(context.Background())
+			if err != nil {
+				log.Println("failed to expire stock reservations:", err)
+				continue
+			}
+			if n > 0 {
+				log.Println("cancelled orders with expired stock reservations:", n)
+			}
+		}
+	}()
+
+	//****************************guest carts**********************
+	// guest carts nobody came back for are deleted once they expire
+	go func() {
+		ticker := time.NewTicker(cfg.GuestCart.SweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := userRepo.ExpireGuestCarts(context.Background())
+			if err != nil {
+				log.Println("failed to expire guest carts:", err)
+				continue
+			}
+			if n > 0 {
+				log.Println("deleted expired guest carts:", n)
+			}
+		}
+	}()
 
 	//****************************routes**********************
-	r := routes.SetupRoutes(productHandler, userHandler)
+	r := routes.SetupRoutes(productHandler, userHandler, paymentHandler, catalogHandler, inventoryHandler, variantHandler, imageHandler, couponHandler, jwksHandler, media, middlewares.JWTMiddleware(keys, userRepo), middlewares.GuestToken(keys))
 	//****************************allows**********************
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173"}, 
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-		AllowedHeaders:   []string{"Content-Type"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Guest-Token"},
+		ExposedHeaders:   []string{"X-Request-ID", "X-Guest-Token"},
 		AllowCredentials: true,
 	})
 
 	handler := c.Handler(r)
 
 	//****************************run server**********************
-	port := "8080"
+	port := cfg.Server.Port
 	fmt.Printf("✅ Server running on port %s\n", port)
 	log.Fatal(http.ListenAndServe(":"+port, handler))
 }
@@ -0,0 +1,136 @@
+// Package media validates uploaded product images and renders the resized
+// copies served alongside the original.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	// registered decoders for the accepted upload formats
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+// TooLargeError is returned for an image with more pixels than allowed.
+type TooLargeError struct {
+	Width, Height, MaxPixels int
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("image is %dx%d, more than %d pixels", e.Width, e.Height, e.MaxPixels)
+}
+
+// Accepted upload formats, keyed by sniffed content type.
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Longest edge of each rendition in pixels.
+const (
+	ThumbSize  = 200
+	MediumSize = 800
+)
+
+// Rendition is one encoded copy of an image.
+type Rendition struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// Processed is an accepted upload: the original bytes as received plus the
+// thumbnail and medium renditions.
+type Processed struct {
+	Original Rendition
+	Thumb    Rendition
+	Medium   Rendition
+}
+
+// Process sniffs data's type from its content, never from the client's
+// claim, checks the dimensions before decoding, and renders the resized
+// copies. Images are never scaled up.
+func Process(data []byte, maxPixels int) (*Processed, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, &TooLargeError{Width: cfg.Width, Height: cfg.Height, MaxPixels: maxPixels}
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	thumb, err := render(src, ThumbSize)
+	if err != nil {
+		return nil, err
+	}
+	medium, err := render(src, MediumSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Processed{
+		Original: Rendition{Data: data, ContentType: contentType, Ext: ext, Width: cfg.Width, Height: cfg.Height},
+		Thumb:    thumb,
+		Medium:   medium,
+	}, nil
+}
+
+// render scales src to fit within size x size and encodes it as JPEG, or as
+// PNG when the image has transparency.
+func render(src image.Image, size int) (Rendition, error) {
+	b := src.Bounds()
+	w, h := fit(b.Dx(), b.Dy(), size)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if dst.Opaque() {
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+			return Rendition{}, err
+		}
+		return Rendition{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: "jpg", Width: w, Height: h}, nil
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return Rendition{}, err
+	}
+	return Rendition{Data: buf.Bytes(), ContentType: "image/png", Ext: "png", Width: w, Height: h}, nil
+}
+
+// fit scales w x h down to fit within size x size, keeping the aspect ratio.
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
@@ -0,0 +1,76 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	p, err := Process(encodePNG(t, 1000, 500), 4_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Original.ContentType != "image/png" || p.Original.Ext != "png" || p.Original.Width != 1000 {
+		t.Fatalf("original = %s %s %dx%d", p.Original.ContentType, p.Original.Ext, p.Original.Width, p.Original.Height)
+	}
+	if p.Thumb.Width != ThumbSize || p.Thumb.Height != ThumbSize/2 {
+		t.Fatalf("thumb is %dx%d, want %dx%d", p.Thumb.Width, p.Thumb.Height, ThumbSize, ThumbSize/2)
+	}
+	if p.Medium.Width != MediumSize || p.Medium.Height != MediumSize/2 {
+		t.Fatalf("medium is %dx%d, want %dx%d", p.Medium.Width, p.Medium.Height, MediumSize, MediumSize/2)
+	}
+
+	// never scaled up
+	p, err = Process(encodePNG(t, 100, 50), 4_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Medium.Width != 100 || p.Medium.Height != 50 {
+		t.Fatalf("medium of a small image is %dx%d, want 100x50", p.Medium.Width, p.Medium.Height)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	if _, err := Process([]byte("%PDF-1.4 not an image"), 4_000_000); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("pdf: err = %v, want ErrUnsupportedType", err)
+	}
+	if _, err := Process([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"), 4_000_000); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("svg: err = %v, want ErrUnsupportedType", err)
+	}
+
+	data := encodePNG(t, 100, 50)
+	if _, err := Process(data[:len(data)/2], 4_000_000); !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("truncated png: err = %v, want ErrInvalidImage", err)
+	}
+
+	_, err := Process(data, 4_999)
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("over the pixel limit: err = %v, want TooLargeError", err)
+	}
+	if tooLarge.Width != 100 || tooLarge.Height != 50 || tooLarge.MaxPixels != 4_999 {
+		t.Fatalf("TooLargeError = %+v", tooLarge)
+	}
+	if _, err := Process(data, 5_000); err != nil {
+		t.Fatalf("at the pixel limit: %v", err)
+	}
+}
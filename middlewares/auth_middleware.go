@@ -2,7 +2,9 @@ package middlewares
 
 import (
 	"context"
+	"log"
 
+	"my-go-project/apierror"
 	"my-go-project/models"
 	"net/http"
 	"strings"
@@ -10,33 +12,65 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var secretKey = []byte("mysecretkey")
+// RevocationChecker reports whether an access token was revoked (by logout)
+// before its expiry.
+type RevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// TokenVerifier checks a token's signature, algorithm and expiry and decodes
+// its claims; auth.KeyManager implements it.
+type TokenVerifier interface {
+	Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error)
+}
+
+// JWTMiddleware returns a middleware that accepts tokens verifier vouches for
+// and rejects those revoked in revocations.
+func JWTMiddleware(verifier TokenVerifier, revocations RevocationChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return jwtHandler(verifier, revocations, next)
+	}
+}
 
-func JWTMiddleware(next http.Handler) http.Handler {
+func jwtHandler(verifier TokenVerifier, revocations RevocationChecker, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+			apierror.Write(w, r, http.StatusUnauthorized, "missing_token", "Authorization header is required", nil)
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return secretKey, nil
-		})
+		token, err := verifier.Parse(tokenString, &models.JWTClaims{})
 
 		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			apierror.Write(w, r, http.StatusUnauthorized, "invalid_token", "Invalid or expired token", nil)
 			return
 		}
 
+		// tokens without a jti cannot be revoked, so they are not accepted;
+		// neither are guest tokens, which name no user
 		claims, ok := token.Claims.(*models.JWTClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		if !ok || claims.ID == "" || claims.ExpiresAt == nil || claims.UserID == 0 {
+			apierror.Write(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token claims", nil)
+			return
+		}
+
+		revoked, err := revocations.IsTokenRevoked(r.Context(), claims.ID)
+		if err != nil {
+			log.Println("Error checking token revocation:", err)
+			apierror.Write(w, r, http.StatusInternalServerError, "internal_error", "Failed to verify token", nil)
+			return
+		}
+		if revoked {
+			apierror.Write(w, r, http.StatusUnauthorized, "token_revoked", "Token has been revoked", nil)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), "userID", claims.UserID)
+		ctx = context.WithValue(ctx, "role", claims.Role)
+		ctx = context.WithValue(ctx, "tokenID", claims.ID)
+		ctx = context.WithValue(ctx, "tokenExpiresAt", claims.ExpiresAt.Time)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"context"
+	"my-go-project/models"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GuestToken returns a middleware that puts the guest id of a valid guest
+// token, sent in the X-Guest-Token header or the guest_cart cookie, in the
+// request context as "guestID". A missing, invalid or expired guest token
+// leaves the request without one; the handlers decide what that means.
+func GuestToken(verifier TokenVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := r.Header.Get(models.GuestTokenHeader)
+			if tokenString == "" {
+				if cookie, err := r.Cookie(models.GuestCookie); err == nil {
+					tokenString = cookie.Value
+				}
+			}
+			if tokenString == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims := &jwt.RegisteredClaims{}
+			token, err := verifier.Parse(tokenString, claims)
+			if err != nil || !token.Valid || claims.Subject == "" || claims.ExpiresAt == nil || !isGuestAudience(claims.Audience) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "guestID", claims.Subject)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func isGuestAudience(audience jwt.ClaimStrings) bool {
+	for _, aud := range audience {
+		if aud == models.GuestAudience {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"my-go-project/apierror"
+	"net/http"
+)
+
+// RequireRole returns a middleware that only lets through users whose token
+// carries one of roles. It reads the role JWTMiddleware put in the request
+// context, so it must be wrapped by it:
+//
+//	jwtAuth(RequireRole(models.RoleAdmin)(handler))
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		allowed[role] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := r.Context().Value("role").(string)
+			if !ok {
+				apierror.Write(w, r, http.StatusUnauthorized, "missing_token", "Authorization header is required", nil)
+				return
+			}
+
+			if !allowed[role] {
+				apierror.Write(w, r, http.StatusForbidden, "forbidden", "You do not have permission to access this resource", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
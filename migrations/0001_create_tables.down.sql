@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS credit_card;
+DROP TABLE IF EXISTS order_product;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS cart_product;
+DROP TABLE IF EXISTS cart;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS products;
@@ -0,0 +1,61 @@
+-- Baseline schema matching the queries in repository/product_repo.go.
+
+CREATE TABLE products (
+    product_id   INTEGER PRIMARY KEY,
+    product_name TEXT    NOT NULL,
+    description  TEXT    NOT NULL DEFAULT '',
+    price        INTEGER NOT NULL CHECK (price > 0),
+    img_url      TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE TABLE users (
+    user_id   INTEGER PRIMARY KEY,
+    user_name TEXT        NOT NULL,
+    password  TEXT        NOT NULL,
+    email     TEXT        NOT NULL UNIQUE,
+    phone     TEXT        NOT NULL DEFAULT '',
+    address   TEXT        NOT NULL DEFAULT '',
+    create_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE cart (
+    cart_id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE cart_product (
+    cp_id      INTEGER PRIMARY KEY,
+    cart_id    INTEGER NOT NULL REFERENCES cart (cart_id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    quantity   INTEGER NOT NULL CHECK (quantity > 0)
+);
+
+CREATE TABLE orders (
+    order_id    INTEGER PRIMARY KEY,
+    total_price INTEGER     NOT NULL,
+    status      TEXT        NOT NULL,
+    create_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- user_id is read by GetHistory and GetProductSales but AddOrderProduct does
+-- not write it yet, so it stays nullable until orders carry their owner.
+CREATE TABLE order_product (
+    op_id        INTEGER PRIMARY KEY,
+    order_id     INTEGER NOT NULL REFERENCES orders (order_id) ON DELETE CASCADE,
+    product_id   INTEGER NOT NULL REFERENCES products (product_id),
+    quantity     INTEGER NOT NULL CHECK (quantity > 0),
+    price_update INTEGER NOT NULL,
+    user_id      INTEGER REFERENCES users (user_id) ON DELETE SET NULL
+);
+
+CREATE TABLE credit_card (
+    card_id  INTEGER PRIMARY KEY,
+    user_id  INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    card_num TEXT    NOT NULL
+);
+
+CREATE INDEX cart_user_id_idx ON cart (user_id);
+CREATE INDEX cart_product_cart_id_idx ON cart_product (cart_id);
+CREATE INDEX order_product_order_id_idx ON order_product (order_id);
+CREATE INDEX order_product_user_id_idx ON order_product (user_id);
+CREATE INDEX credit_card_user_id_idx ON credit_card (user_id);
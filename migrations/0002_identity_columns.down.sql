@@ -0,0 +1,7 @@
+ALTER TABLE credit_card   ALTER COLUMN card_id    DROP IDENTITY;
+ALTER TABLE order_product ALTER COLUMN op_id      DROP IDENTITY;
+ALTER TABLE orders        ALTER COLUMN order_id   DROP IDENTITY;
+ALTER TABLE cart_product  ALTER COLUMN cp_id      DROP IDENTITY;
+ALTER TABLE cart          ALTER COLUMN cart_id    DROP IDENTITY;
+ALTER TABLE users         ALTER COLUMN user_id    DROP IDENTITY;
+ALTER TABLE products      ALTER COLUMN product_id DROP IDENTITY;
@@ -0,0 +1,18 @@
+-- Identifiers are generated by the database from here on. Each sequence starts
+-- after the highest id already in use.
+
+ALTER TABLE products      ALTER COLUMN product_id ADD GENERATED ALWAYS AS IDENTITY;
+ALTER TABLE users         ALTER COLUMN user_id    ADD GENERATED ALWAYS AS IDENTITY;
+ALTER TABLE cart          ALTER COLUMN cart_id    ADD GENERATED ALWAYS AS IDENTITY;
+ALTER TABLE cart_product  ALTER COLUMN cp_id      ADD GENERATED ALWAYS AS IDENTITY;
+ALTER TABLE orders        ALTER COLUMN order_id   ADD GENERATED ALWAYS AS IDENTITY;
+ALTER TABLE order_product ALTER COLUMN op_id      ADD GENERATED ALWAYS AS IDENTITY;
+ALTER TABLE credit_card   ALTER COLUMN card_id    ADD GENERATED ALWAYS AS IDENTITY;
+
+SELECT setval(pg_get_serial_sequence('products', 'product_id'), COALESCE(MAX(product_id), 0) + 1, false) FROM products;
+SELECT setval(pg_get_serial_sequence('users', 'user_id'), COALESCE(MAX(user_id), 0) + 1, false) FROM users;
+SELECT setval(pg_get_serial_sequence('cart', 'cart_id'), COALESCE(MAX(cart_id), 0) + 1, false) FROM cart;
+SELECT setval(pg_get_serial_sequence('cart_product', 'cp_id'), COALESCE(MAX(cp_id), 0) + 1, false) FROM cart_product;
+SELECT setval(pg_get_serial_sequence('orders', 'order_id'), COALESCE(MAX(order_id), 0) + 1, false) FROM orders;
+SELECT setval(pg_get_serial_sequence('order_product', 'op_id'), COALESCE(MAX(op_id), 0) + 1, false) FROM order_product;
+SELECT setval(pg_get_serial_sequence('credit_card', 'card_id'), COALESCE(MAX(card_id), 0) + 1, false) FROM credit_card;
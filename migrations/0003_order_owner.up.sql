@@ -0,0 +1,11 @@
+-- Orders belong to the user who placed them.
+
+ALTER TABLE orders ADD COLUMN user_id INTEGER REFERENCES users (user_id) ON DELETE SET NULL;
+
+UPDATE orders o
+SET user_id = op.user_id
+FROM order_product op
+WHERE op.order_id = o.order_id
+  AND op.user_id IS NOT NULL;
+
+CREATE INDEX orders_user_id_idx ON orders (user_id);
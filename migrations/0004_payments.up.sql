@@ -0,0 +1,13 @@
+CREATE TABLE payments (
+    payment_id   INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    order_id     INTEGER     NOT NULL REFERENCES orders (order_id) ON DELETE CASCADE,
+    card_id      INTEGER     REFERENCES credit_card (card_id) ON DELETE SET NULL,
+    method       TEXT        NOT NULL,
+    amount       INTEGER     NOT NULL CHECK (amount > 0),
+    currency     TEXT        NOT NULL,
+    status       TEXT        NOT NULL CHECK (status IN ('pending', 'authorized', 'captured', 'failed', 'refunded')),
+    provider_ref TEXT        NOT NULL DEFAULT '',
+    create_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX payments_order_id_idx ON payments (order_id);
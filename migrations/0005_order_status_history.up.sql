@@ -0,0 +1,25 @@
+-- Orders move through a fixed set of states, and every change is recorded.
+
+UPDATE orders SET status = 'delivered' WHERE status = 'completed';
+UPDATE orders SET status = 'pending'
+WHERE status NOT IN ('pending', 'paid', 'fulfilled', 'shipped', 'delivered', 'cancelled', 'refunded');
+
+ALTER TABLE orders ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'fulfilled', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+CREATE TABLE order_status_history (
+    history_id  INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    order_id    INTEGER     NOT NULL REFERENCES orders (order_id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status   TEXT        NOT NULL,
+    actor_id    INTEGER     REFERENCES users (user_id) ON DELETE SET NULL,
+    note        TEXT        NOT NULL DEFAULT '',
+    create_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX order_status_history_order_id_idx ON order_status_history (order_id);
+
+-- seed each existing order's timeline with its current status
+INSERT INTO order_status_history (order_id, to_status, actor_id, note, create_at)
+SELECT order_id, status, user_id, 'imported', create_at FROM orders;
@@ -0,0 +1,5 @@
+-- Every user has a role; admin endpoints check it through the JWT.
+
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'customer'
+        CONSTRAINT users_role_check CHECK (role IN ('customer', 'staff', 'admin'));
@@ -0,0 +1,16 @@
+-- The card numbers are in the vault, not here; rolling back restores the
+-- column with only the last four digits in it.
+
+DROP INDEX credit_card_default_idx;
+DROP INDEX credit_card_token_idx;
+
+ALTER TABLE credit_card ADD COLUMN card_num TEXT NOT NULL DEFAULT '';
+UPDATE credit_card SET card_num = last4;
+ALTER TABLE credit_card ALTER COLUMN card_num DROP DEFAULT;
+
+ALTER TABLE credit_card
+    DROP COLUMN token,
+    DROP COLUMN brand,
+    DROP COLUMN last4,
+    DROP COLUMN is_default,
+    DROP COLUMN create_at;
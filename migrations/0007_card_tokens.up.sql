@@ -0,0 +1,30 @@
+-- Card numbers move to the card vault; the table keeps only the vault token,
+-- the brand and the last four digits.
+--
+-- Existing rows cannot be tokenized from SQL (the vault key is not available
+-- here), so they keep their brand and last4 but get no token and must be added
+-- again before they can be charged.
+
+ALTER TABLE credit_card
+    ADD COLUMN token      TEXT,
+    ADD COLUMN brand      TEXT        NOT NULL DEFAULT 'unknown',
+    ADD COLUMN last4      TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN is_default BOOLEAN     NOT NULL DEFAULT false,
+    ADD COLUMN create_at  TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE credit_card
+SET last4 = right(regexp_replace(card_num, '[^0-9]', '', 'g'), 4),
+    brand = CASE
+        WHEN card_num LIKE '4%' THEN 'visa'
+        WHEN card_num ~ '^(5[1-5]|2[2-7])' THEN 'mastercard'
+        WHEN card_num ~ '^3[47]' THEN 'amex'
+        WHEN card_num ~ '^(6011|65|64[4-9])' THEN 'discover'
+        ELSE 'unknown'
+    END;
+
+ALTER TABLE credit_card DROP COLUMN card_num;
+
+CREATE UNIQUE INDEX credit_card_token_idx ON credit_card (token);
+
+-- at most one default card per user
+CREATE UNIQUE INDEX credit_card_default_idx ON credit_card (user_id) WHERE is_default;
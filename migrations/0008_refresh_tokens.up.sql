@@ -0,0 +1,27 @@
+-- Server-side refresh tokens and revoked access tokens.
+--
+-- Refresh tokens are stored as SHA-256 hashes. Each login starts a family;
+-- every refresh revokes the presented token and issues the next one in the
+-- same family, so presenting a token that was already used revokes the whole
+-- family.
+
+CREATE TABLE refresh_tokens (
+    token_id    INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id     INTEGER     NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    family_id   TEXT        NOT NULL,
+    token_hash  TEXT        NOT NULL UNIQUE,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ,
+    replaced_by INTEGER     REFERENCES refresh_tokens (token_id) ON DELETE SET NULL,
+    create_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- Access tokens revoked before they expire, by jti. Rows past expires_at can
+-- be deleted: the token would be rejected as expired anyway.
+CREATE TABLE revoked_tokens (
+    jti        TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
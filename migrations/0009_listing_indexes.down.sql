@@ -0,0 +1,3 @@
+DROP INDEX order_product_user_op_idx;
+DROP INDEX products_name_idx;
+DROP INDEX products_price_idx;
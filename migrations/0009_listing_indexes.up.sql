@@ -0,0 +1,6 @@
+-- Indexes backing keyset pagination. Each matches an ORDER BY used by a list
+-- endpoint, with the primary key last to break ties.
+
+CREATE INDEX products_price_idx ON products (price, product_id);
+CREATE INDEX products_name_idx ON products (product_name, product_id);
+CREATE INDEX order_product_user_op_idx ON order_product (user_id, op_id);
@@ -0,0 +1,4 @@
+-- pg_trgm is left installed: other database objects may have come to rely on it.
+DROP INDEX products_name_trgm_idx;
+DROP INDEX products_search_vector_idx;
+ALTER TABLE products DROP COLUMN search_vector;
@@ -0,0 +1,17 @@
+-- Full-text search and typeahead over products.
+--
+-- search_vector is kept up to date by Postgres itself: names weigh A and
+-- descriptions B, so ts_rank puts name matches first. The trigram index backs
+-- the word_similarity (<%) lookups of /products/suggest and the ILIKE name
+-- filter of /products.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE products
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', product_name), 'A') ||
+        setweight(to_tsvector('english', description), 'B')
+    ) STORED;
+
+CREATE INDEX products_search_vector_idx ON products USING GIN (search_vector);
+CREATE INDEX products_name_trgm_idx ON products USING GIN (product_name gin_trgm_ops);
@@ -0,0 +1,4 @@
+DROP TABLE product_tags;
+DROP TABLE product_categories;
+DROP TABLE tags;
+DROP TABLE categories;
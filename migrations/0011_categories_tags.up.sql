@@ -0,0 +1,37 @@
+-- Category tree and free-form tags, each linked to products many-to-many.
+--
+-- A category with children cannot be deleted (parent_id is RESTRICT); deleting
+-- a category, tag or product drops its links.
+
+CREATE TABLE categories (
+    category_id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    parent_id   INTEGER     REFERENCES categories (category_id) ON DELETE RESTRICT,
+    name        TEXT        NOT NULL,
+    slug        TEXT        NOT NULL UNIQUE CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    create_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (parent_id <> category_id)
+);
+
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+
+CREATE TABLE tags (
+    tag_id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    name   TEXT NOT NULL,
+    slug   TEXT NOT NULL UNIQUE CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$')
+);
+
+CREATE TABLE product_categories (
+    product_id  INTEGER NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (category_id) ON DELETE CASCADE,
+    PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX product_categories_category_id_idx ON product_categories (category_id);
+
+CREATE TABLE product_tags (
+    product_id INTEGER NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    tag_id     INTEGER NOT NULL REFERENCES tags (tag_id) ON DELETE CASCADE,
+    PRIMARY KEY (product_id, tag_id)
+);
+
+CREATE INDEX product_tags_tag_id_idx ON product_tags (tag_id);
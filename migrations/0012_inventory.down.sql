@@ -0,0 +1,3 @@
+DROP TABLE inventory_ledger;
+DROP TABLE stock_reservations;
+ALTER TABLE products DROP COLUMN stock;
@@ -0,0 +1,36 @@
+-- Per-product stock, the holds pending orders place on it, and a ledger of
+-- every change.
+--
+-- Existing products start with no stock; set it through an inventory
+-- adjustment before they can be ordered again.
+
+ALTER TABLE products ADD COLUMN stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0);
+
+-- Stock taken by a pending order. The stock itself has already been moved out
+-- of products.stock; the row only records what to give back if the order is
+-- cancelled or its hold expires. Paying for the order deletes it.
+CREATE TABLE stock_reservations (
+    reservation_id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    order_id       INTEGER     NOT NULL REFERENCES orders (order_id) ON DELETE CASCADE,
+    product_id     INTEGER     NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    quantity       INTEGER     NOT NULL CHECK (quantity > 0),
+    expires_at     TIMESTAMPTZ NOT NULL,
+    create_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX stock_reservations_order_id_idx ON stock_reservations (order_id);
+CREATE INDEX stock_reservations_product_id_idx ON stock_reservations (product_id);
+CREATE INDEX stock_reservations_expires_at_idx ON stock_reservations (expires_at);
+
+CREATE TABLE inventory_ledger (
+    entry_id    INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    product_id  INTEGER     NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    delta       INTEGER     NOT NULL CHECK (delta <> 0),
+    stock_after INTEGER     NOT NULL CHECK (stock_after >= 0),
+    reason      TEXT        NOT NULL,
+    order_id    INTEGER     REFERENCES orders (order_id) ON DELETE SET NULL,
+    actor_id    INTEGER     REFERENCES users (user_id) ON DELETE SET NULL,
+    create_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX inventory_ledger_product_id_idx ON inventory_ledger (product_id, entry_id);
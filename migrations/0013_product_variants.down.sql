@@ -0,0 +1,5 @@
+ALTER TABLE inventory_ledger DROP COLUMN variant_id;
+ALTER TABLE stock_reservations DROP COLUMN variant_id;
+ALTER TABLE order_product DROP COLUMN variant_id;
+ALTER TABLE cart_product DROP COLUMN variant_id;
+DROP TABLE product_variants;
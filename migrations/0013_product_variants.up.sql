@@ -0,0 +1,25 @@
+-- Variants: sellable versions of a product (size, colour, ...) with their own
+-- SKU, optional price and image overrides, and stock.
+--
+-- Cart lines, order lines, stock holds and ledger entries gain a variant_id,
+-- NULL for products without variants, which keep using products.stock.
+
+CREATE TABLE product_variants (
+    variant_id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    product_id INTEGER     NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    sku        TEXT        NOT NULL UNIQUE,
+    options    JSONB       NOT NULL DEFAULT '{}' CHECK (jsonb_typeof(options) = 'object'),
+    price      INTEGER     CHECK (price > 0),
+    stock      INTEGER     NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    img_url    TEXT        NOT NULL DEFAULT '',
+    create_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (product_id, options)
+);
+
+ALTER TABLE cart_product ADD COLUMN variant_id INTEGER REFERENCES product_variants (variant_id) ON DELETE CASCADE;
+ALTER TABLE order_product ADD COLUMN variant_id INTEGER REFERENCES product_variants (variant_id) ON DELETE RESTRICT;
+ALTER TABLE stock_reservations ADD COLUMN variant_id INTEGER REFERENCES product_variants (variant_id) ON DELETE CASCADE;
+ALTER TABLE inventory_ledger ADD COLUMN variant_id INTEGER REFERENCES product_variants (variant_id) ON DELETE CASCADE;
+
+CREATE INDEX stock_reservations_variant_id_idx ON stock_reservations (variant_id);
+CREATE INDEX order_product_variant_id_idx ON order_product (variant_id);
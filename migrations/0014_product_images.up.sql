@@ -0,0 +1,20 @@
+-- Product images: an ordered gallery per product. Each row points at three
+-- blobs in the configured BlobStore: the original upload and the thumbnail
+-- and medium renditions. Positions are kept dense from 0; the unique
+-- constraint is deferred so a reorder can shift several rows in one statement.
+
+CREATE TABLE product_images (
+    image_id     INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    product_id   INTEGER     NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    position     INTEGER     NOT NULL CHECK (position >= 0),
+    alt_text     TEXT        NOT NULL DEFAULT '',
+    content_type TEXT        NOT NULL,
+    width        INTEGER     NOT NULL CHECK (width > 0),
+    height       INTEGER     NOT NULL CHECK (height > 0),
+    size_bytes   INTEGER     NOT NULL CHECK (size_bytes > 0),
+    original_key TEXT        NOT NULL,
+    thumb_key    TEXT        NOT NULL,
+    medium_key   TEXT        NOT NULL,
+    create_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT product_images_position_key UNIQUE (product_id, position) DEFERRABLE INITIALLY DEFERRED
+);
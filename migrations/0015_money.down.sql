@@ -0,0 +1,22 @@
+DROP INDEX products_price_idx;
+CREATE INDEX products_price_idx ON products (price, product_id);
+
+ALTER TABLE payments DROP CONSTRAINT payments_currency_fkey;
+ALTER TABLE payments ALTER COLUMN currency TYPE TEXT;
+ALTER TABLE payments ALTER COLUMN amount TYPE INTEGER;
+
+ALTER TABLE order_product DROP CONSTRAINT order_product_currency_fkey;
+ALTER TABLE order_product ALTER COLUMN price_update TYPE INTEGER;
+ALTER TABLE order_product DROP COLUMN currency;
+
+ALTER TABLE orders DROP CONSTRAINT orders_order_id_currency_key;
+ALTER TABLE orders ALTER COLUMN total_price TYPE INTEGER;
+ALTER TABLE orders DROP COLUMN currency;
+
+ALTER TABLE product_variants DROP CONSTRAINT product_variants_currency_fkey;
+ALTER TABLE product_variants DROP COLUMN currency;
+ALTER TABLE product_variants ALTER COLUMN price TYPE INTEGER;
+
+ALTER TABLE products DROP CONSTRAINT products_product_id_currency_key;
+ALTER TABLE products ALTER COLUMN price TYPE INTEGER;
+ALTER TABLE products DROP COLUMN currency;
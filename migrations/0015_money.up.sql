@@ -0,0 +1,55 @@
+-- Money: every price and amount becomes a BIGINT count of minor units next to
+-- the ISO 4217 code of its currency.
+--
+-- Existing amounts were already minor units of the single currency the shop
+-- ran in, the one its payments were recorded in, so they keep their values
+-- and take that currency; a shop with no payments yet is taken to be in USD.
+--
+-- Composite foreign keys keep related amounts in one currency: a variant's
+-- price override is in its product's currency, and an order's lines and
+-- payments are in the order's currency.
+
+UPDATE payments SET currency = upper(currency);
+
+DO $$
+DECLARE
+    shop_currency CHAR(3) := COALESCE((SELECT currency FROM payments ORDER BY payment_id DESC LIMIT 1), 'USD');
+BEGIN
+    EXECUTE format('ALTER TABLE products ADD COLUMN currency CHAR(3) NOT NULL DEFAULT %L', shop_currency);
+    EXECUTE format('ALTER TABLE orders ADD COLUMN currency CHAR(3) NOT NULL DEFAULT %L', shop_currency);
+    EXECUTE format('ALTER TABLE order_product ADD COLUMN currency CHAR(3) NOT NULL DEFAULT %L', shop_currency);
+END
+$$;
+
+ALTER TABLE products ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE order_product ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE products ALTER COLUMN price TYPE BIGINT;
+ALTER TABLE products ADD CONSTRAINT products_currency_check CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE products ADD CONSTRAINT products_product_id_currency_key UNIQUE (product_id, currency);
+
+ALTER TABLE product_variants ALTER COLUMN price TYPE BIGINT;
+ALTER TABLE product_variants ADD COLUMN currency CHAR(3);
+UPDATE product_variants v SET currency = p.currency
+FROM products p WHERE p.product_id = v.product_id AND v.price IS NOT NULL;
+ALTER TABLE product_variants ADD CONSTRAINT product_variants_price_currency_check CHECK ((price IS NULL) = (currency IS NULL));
+ALTER TABLE product_variants ADD CONSTRAINT product_variants_currency_fkey
+    FOREIGN KEY (product_id, currency) REFERENCES products (product_id, currency);
+
+ALTER TABLE orders ALTER COLUMN total_price TYPE BIGINT;
+ALTER TABLE orders ADD CONSTRAINT orders_currency_check CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE orders ADD CONSTRAINT orders_order_id_currency_key UNIQUE (order_id, currency);
+
+ALTER TABLE order_product ALTER COLUMN price_update TYPE BIGINT;
+ALTER TABLE order_product ADD CONSTRAINT order_product_currency_fkey
+    FOREIGN KEY (order_id, currency) REFERENCES orders (order_id, currency) ON DELETE CASCADE;
+
+ALTER TABLE payments ALTER COLUMN amount TYPE BIGINT;
+ALTER TABLE payments ALTER COLUMN currency TYPE CHAR(3);
+ALTER TABLE payments ADD CONSTRAINT payments_currency_fkey
+    FOREIGN KEY (order_id, currency) REFERENCES orders (order_id, currency) ON DELETE CASCADE;
+
+-- price listings are ordered within a currency
+DROP INDEX products_price_idx;
+CREATE INDEX products_price_idx ON products (currency, price, product_id);
@@ -0,0 +1,6 @@
+DROP TABLE order_discounts;
+ALTER TABLE orders DROP COLUMN coupon_id;
+ALTER TABLE cart DROP COLUMN coupon_id;
+DROP TABLE coupon_categories;
+DROP TABLE coupon_products;
+DROP TABLE coupons;
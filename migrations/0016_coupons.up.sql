@@ -0,0 +1,64 @@
+-- Discount codes. A coupon takes a percentage or a fixed amount off the
+-- eligible lines, waives shipping, or makes some units free when enough are
+-- bought. Its eligible products are the ones linked directly plus the ones in
+-- its categories and their subcategories; a coupon with no links covers every
+-- product. amount and min_order_amount are minor units of currency.
+--
+-- A cart holds at most one coupon until checkout. The order then records the
+-- coupon it used, which is what usage limits count, and the exact discount
+-- lines it got, which keep the code even if the coupon is deleted later.
+
+CREATE TABLE coupons (
+    coupon_id         INTEGER     GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    code              TEXT        NOT NULL UNIQUE CHECK (code ~ '^[A-Z0-9_-]{3,32}$'),
+    kind              TEXT        NOT NULL CHECK (kind IN ('percentage', 'fixed', 'free_shipping', 'buy_x_get_y')),
+    percent           INTEGER     NOT NULL DEFAULT 0 CHECK (percent BETWEEN 0 AND 100),
+    amount            BIGINT      CHECK (amount > 0),
+    buy_quantity      INTEGER     NOT NULL DEFAULT 0 CHECK (buy_quantity >= 0),
+    get_quantity      INTEGER     NOT NULL DEFAULT 0 CHECK (get_quantity >= 0),
+    min_order_amount  BIGINT      CHECK (min_order_amount > 0),
+    currency          CHAR(3)     CHECK (currency ~ '^[A-Z]{3}$'),
+    starts_at         TIMESTAMPTZ,
+    ends_at           TIMESTAMPTZ,
+    max_uses          INTEGER     NOT NULL DEFAULT 0 CHECK (max_uses >= 0),
+    max_uses_per_user INTEGER     NOT NULL DEFAULT 0 CHECK (max_uses_per_user >= 0),
+    create_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (kind <> 'percentage' OR percent > 0),
+    CHECK (kind <> 'fixed' OR amount IS NOT NULL),
+    CHECK (kind <> 'buy_x_get_y' OR (buy_quantity > 0 AND get_quantity > 0 AND percent > 0)),
+    CHECK ((amount IS NULL AND min_order_amount IS NULL) = (currency IS NULL)),
+    CHECK (starts_at IS NULL OR ends_at IS NULL OR starts_at < ends_at)
+);
+
+CREATE TABLE coupon_products (
+    coupon_id  INTEGER NOT NULL REFERENCES coupons (coupon_id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products (product_id) ON DELETE CASCADE,
+    PRIMARY KEY (coupon_id, product_id)
+);
+
+CREATE TABLE coupon_categories (
+    coupon_id   INTEGER NOT NULL REFERENCES coupons (coupon_id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories (category_id) ON DELETE CASCADE,
+    PRIMARY KEY (coupon_id, category_id)
+);
+
+ALTER TABLE cart ADD COLUMN coupon_id INTEGER REFERENCES coupons (coupon_id) ON DELETE SET NULL;
+
+ALTER TABLE orders ADD COLUMN coupon_id INTEGER REFERENCES coupons (coupon_id) ON DELETE SET NULL;
+CREATE INDEX orders_coupon_id_idx ON orders (coupon_id, user_id) WHERE coupon_id IS NOT NULL;
+
+CREATE TABLE order_discounts (
+    discount_id INTEGER     GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    order_id    INTEGER     NOT NULL,
+    coupon_id   INTEGER     REFERENCES coupons (coupon_id) ON DELETE SET NULL,
+    code        TEXT        NOT NULL,
+    kind        TEXT        NOT NULL,
+    product_id  INTEGER     REFERENCES products (product_id) ON DELETE SET NULL,
+    description TEXT        NOT NULL,
+    amount      BIGINT      NOT NULL CHECK (amount >= 0),
+    currency    CHAR(3)     NOT NULL,
+    CONSTRAINT order_discounts_currency_fkey
+        FOREIGN KEY (order_id, currency) REFERENCES orders (order_id, currency) ON DELETE CASCADE
+);
+
+CREATE INDEX order_discounts_order_id_idx ON order_discounts (order_id);
@@ -0,0 +1,23 @@
+ALTER TABLE orders DROP COLUMN tax_included;
+ALTER TABLE orders DROP COLUMN tax_amount;
+ALTER TABLE orders DROP COLUMN shipping_amount;
+ALTER TABLE orders DROP COLUMN shipping_name;
+ALTER TABLE orders DROP COLUMN shipping_method;
+ALTER TABLE orders DROP COLUMN ship_country;
+ALTER TABLE orders DROP COLUMN ship_postal_code;
+ALTER TABLE orders DROP COLUMN ship_region;
+ALTER TABLE orders DROP COLUMN ship_city;
+ALTER TABLE orders DROP COLUMN ship_line2;
+ALTER TABLE orders DROP COLUMN ship_line1;
+
+ALTER TABLE products DROP COLUMN weight_grams;
+
+ALTER TABLE users ADD COLUMN address TEXT NOT NULL DEFAULT '';
+UPDATE users SET address = concat_ws(', ', NULLIF(address_line1, ''), NULLIF(address_line2, ''), NULLIF(city, ''),
+                                     NULLIF(region, ''), NULLIF(postal_code, ''), NULLIF(country, ''));
+ALTER TABLE users DROP COLUMN country;
+ALTER TABLE users DROP COLUMN postal_code;
+ALTER TABLE users DROP COLUMN region;
+ALTER TABLE users DROP COLUMN city;
+ALTER TABLE users DROP COLUMN address_line2;
+ALTER TABLE users DROP COLUMN address_line1;
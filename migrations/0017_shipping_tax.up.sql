@@ -0,0 +1,31 @@
+-- Structured addresses, product weights, and the shipping and tax an order
+-- was charged.
+--
+-- The free-form users.address moves to address_line1 as it is; users have to
+-- fill in their city and country before they can check out again.
+
+ALTER TABLE users ADD COLUMN address_line1 TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN address_line2 TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN city          TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN region        TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN postal_code   TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN country       TEXT NOT NULL DEFAULT '' CHECK (country = '' OR country ~ '^[A-Z]{2}$');
+UPDATE users SET address_line1 = address;
+ALTER TABLE users DROP COLUMN address;
+
+ALTER TABLE products ADD COLUMN weight_grams INTEGER NOT NULL DEFAULT 0 CHECK (weight_grams >= 0);
+
+-- Amounts are in the order's currency. The columns are NULL for orders placed
+-- before checkout charged shipping and tax, and for orders not created by
+-- checkout.
+ALTER TABLE orders ADD COLUMN ship_line1       TEXT;
+ALTER TABLE orders ADD COLUMN ship_line2       TEXT;
+ALTER TABLE orders ADD COLUMN ship_city        TEXT;
+ALTER TABLE orders ADD COLUMN ship_region      TEXT;
+ALTER TABLE orders ADD COLUMN ship_postal_code TEXT;
+ALTER TABLE orders ADD COLUMN ship_country     TEXT CHECK (ship_country ~ '^[A-Z]{2}$');
+ALTER TABLE orders ADD COLUMN shipping_method  TEXT;
+ALTER TABLE orders ADD COLUMN shipping_name    TEXT;
+ALTER TABLE orders ADD COLUMN shipping_amount  BIGINT CHECK (shipping_amount >= 0);
+ALTER TABLE orders ADD COLUMN tax_amount       BIGINT CHECK (tax_amount >= 0);
+ALTER TABLE orders ADD COLUMN tax_included     BOOLEAN NOT NULL DEFAULT false;
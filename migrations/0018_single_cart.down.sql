@@ -0,0 +1,3 @@
+DROP INDEX cart_product_line_key;
+ALTER TABLE cart DROP CONSTRAINT cart_user_id_key;
+CREATE INDEX cart_user_id_idx ON cart (user_id);
@@ -0,0 +1,40 @@
+-- Every user has a single cart, holding at most one line per product and
+-- variant. A user's other carts are folded into their oldest one: its lines
+-- move over, lines for the same product and variant are merged by adding up
+-- their quantities, and the oldest cart keeps its coupon or takes the first
+-- one found on the others.
+
+CREATE TEMPORARY TABLE kept_cart ON COMMIT DROP AS
+    SELECT user_id, min(cart_id) AS cart_id FROM cart GROUP BY user_id;
+
+UPDATE cart c
+SET coupon_id = (SELECT o.coupon_id FROM cart o
+                 WHERE o.user_id = c.user_id AND o.coupon_id IS NOT NULL
+                 ORDER BY o.cart_id LIMIT 1)
+FROM kept_cart k
+WHERE c.cart_id = k.cart_id AND c.coupon_id IS NULL;
+
+UPDATE cart_product cp
+SET cart_id = k.cart_id
+FROM cart c JOIN kept_cart k ON k.user_id = c.user_id
+WHERE cp.cart_id = c.cart_id AND cp.cart_id <> k.cart_id;
+
+DELETE FROM cart c USING kept_cart k WHERE c.user_id = k.user_id AND c.cart_id <> k.cart_id;
+
+UPDATE cart_product cp
+SET quantity = d.quantity
+FROM (SELECT min(cp_id) AS cp_id, sum(quantity) AS quantity
+      FROM cart_product
+      GROUP BY cart_id, product_id, COALESCE(variant_id, 0)
+      HAVING count(*) > 1) d
+WHERE cp.cp_id = d.cp_id;
+
+DELETE FROM cart_product cp USING cart_product first
+WHERE first.cart_id = cp.cart_id
+  AND first.product_id = cp.product_id
+  AND COALESCE(first.variant_id, 0) = COALESCE(cp.variant_id, 0)
+  AND first.cp_id < cp.cp_id;
+
+DROP INDEX cart_user_id_idx;
+ALTER TABLE cart ADD CONSTRAINT cart_user_id_key UNIQUE (user_id);
+CREATE UNIQUE INDEX cart_product_line_key ON cart_product (cart_id, product_id, COALESCE(variant_id, 0));
@@ -0,0 +1,7 @@
+DELETE FROM cart WHERE guest_id IS NOT NULL;
+
+DROP INDEX cart_expires_at_idx;
+ALTER TABLE cart DROP CONSTRAINT cart_owner_check;
+ALTER TABLE cart DROP COLUMN expires_at;
+ALTER TABLE cart DROP COLUMN guest_id;
+ALTER TABLE cart ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,12 @@
+-- A cart belongs either to a user or to an anonymous visitor. A guest cart is
+-- identified by the random guest_id its signed guest token names, and is
+-- deleted once expires_at has passed or when it is merged into a user's cart
+-- at login.
+
+ALTER TABLE cart ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE cart ADD COLUMN guest_id TEXT UNIQUE;
+ALTER TABLE cart ADD COLUMN expires_at TIMESTAMPTZ;
+ALTER TABLE cart ADD CONSTRAINT cart_owner_check
+    CHECK ((user_id IS NULL) <> (guest_id IS NULL) AND (guest_id IS NULL) = (expires_at IS NULL));
+
+CREATE INDEX cart_expires_at_idx ON cart (expires_at) WHERE guest_id IS NOT NULL;
@@ -0,0 +1,5 @@
+UPDATE payments SET status = 'captured' WHERE status = 'refund_pending';
+
+ALTER TABLE payments DROP CONSTRAINT payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'authorized', 'captured', 'failed', 'refunded'));
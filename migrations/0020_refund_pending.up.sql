@@ -0,0 +1,5 @@
+-- A refund first claims its payment by moving it to refund_pending, so two
+-- refunds of the same payment cannot both reach the provider.
+ALTER TABLE payments DROP CONSTRAINT payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'authorized', 'captured', 'failed', 'refund_pending', 'refunded'));
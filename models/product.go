@@ -2,13 +2,127 @@ package models
 
 import "time"
 import "github.com/golang-jwt/jwt/v5"
+import "my-go-project/money"
 
+// Products is a catalog entry. Stock is the quantity on sale, net of what
+// pending orders hold; a product with variants is stocked per variant instead.
+// Categories and Tags hold slugs and, like Images, are only filled in when a
+// single product is fetched. Variants and Variant_options, the values each option takes
+// across the variants, are filled in by the product list and by a single
+// fetch.
 type Products struct {
+	Product_id      int
+	Product_name    string
+	Description     string
+	Price           money.Money
+	Img_url         string
+	Stock           int
+	Weight_grams    int
+	Categories      []string            `json:",omitempty"`
+	Tags            []string            `json:",omitempty"`
+	Variants        []ProductVariant    `json:",omitempty"`
+	Variant_options map[string][]string `json:",omitempty"`
+	Images          []ProductImage      `json:",omitempty"`
+}
+
+// ProductVariant is one sellable version of a product, such as a size and
+// colour, with its own SKU and stock. Options maps option names to values,
+// e.g. {"size": "M", "colour": "red"}. Price and Img_url override the
+// product's when set; Price is nil when the variant sells at the product price
+// and otherwise in the product's currency.
+type ProductVariant struct {
+	Variant_id int
+	Product_id int
+	Sku        string
+	Options    map[string]string
+	Price      *money.Money `json:",omitempty"`
+	Stock      int
+	Img_url    string
+}
+
+// ProductImage is one picture in a product's gallery, shown in Position
+// order from 0. Url is the original upload; Thumbnail_url and Medium_url are
+// resized copies. The keys locate the three files in the blob store.
+type ProductImage struct {
+	Image_id      int
+	Product_id    int
+	Position      int
+	Alt_text      string
+	Content_type  string
+	Width         int
+	Height        int
+	Size          int
+	Url           string
+	Thumbnail_url string
+	Medium_url    string
+	CreatedAt     time.Time
+
+	Original_key string `json:"-"`
+	Thumb_key    string `json:"-"`
+	Medium_key   string `json:"-"`
+}
+
+// Category is a node of the category tree. Parent_id is 0 for top-level
+// categories. Children is only filled in when the tree is requested.
+type Category struct {
+	Category_id int
+	Parent_id   int
+	Name        string
+	Slug        string
+	CreatedAt   time.Time
+	Children    []Category `json:",omitempty"`
+}
+
+// StockLevel is a product's or variant's inventory: Stock is on sale, Reserved
+// is held by pending orders until they are paid or their hold runs out.
+// Variant_id is 0 for the product itself, which lists its variants' levels in
+// Variants.
+type StockLevel struct {
+	Product_id int
+	Variant_id int
+	Stock      int
+	Reserved   int
+	Variants   []StockLevel `json:",omitempty"`
+}
+
+// InventoryEntry is one line of a product's inventory ledger. Delta is the
+// change in stock and Stock_after the level it left. Variant_id is 0 for the
+// product's own stock; Order_id and Actor_id are 0 when the change had no
+// order or no user behind it.
+type InventoryEntry struct {
+	Entry_id    int
+	Product_id  int
+	Variant_id  int
+	Delta       int
+	Stock_after int
+	Reason      string
+	Order_id    int
+	Actor_id    int
+	CreatedAt   time.Time
+}
+
+// Tag is a free-form product label.
+type Tag struct {
+	Tag_id int
+	Name   string
+	Slug   string
+}
+
+// ProductSearchResult is a product matched by full-text search. Rank orders
+// results, higher first. Snippet is an HTML-escaped excerpt with the matched
+// words wrapped in <b></b>.
+type ProductSearchResult struct {
+	Products
+	Rank    float64
+	Snippet string
+}
+
+// ProductSuggestion is a typeahead match on a product name. Score is the
+// trigram word similarity between the query and the name, from 0 to 1.
+type ProductSuggestion struct {
 	Product_id   int
 	Product_name string
-	Description  string
-	Price        int
-	Img_url      string
+	Score        float64
 }
 
 type Cart struct {
@@ -16,48 +130,261 @@ type Cart struct {
 	User_id int
 }
 
+// CartProduct is a cart line. Variant_id names the variant for products that
+// have them and is 0 otherwise.
 type CartProduct struct {
 	CP_id      int
 	Cart_id    int
 	Product_id int
+	Variant_id int
 	Quantity   int
 }
 
+// CreditCard is a saved card. The number itself lives only in the card vault;
+// Token is the vault's handle for it and is never sent to clients.
 type CreditCard struct {
-	Card_id  int
-	User_id  int
-	Card_num string
+	Card_id    int
+	User_id    int
+	Token      string `json:"-"`
+	Brand      string
+	Last4      string
+	Is_default bool
+	CreatedAt  time.Time
 }
 
+// OrderProduct is an order line. Price_update is the unit price when the
+// line was ordered, in the order's currency.
 type OrderProduct struct {
 	OP_id        int
 	Order_id     int
 	Product_id   int
+	Variant_id   int
 	Quantity     int
-	Price_update int
+	Price_update money.Money
 
 	ProductName string
 }
 
+// Orders is an order. TotalPrice is what is owed, after Discounts and with
+// Shipping and any Tax not included in the prices. Discounts, Ship_to,
+// Shipping and Tax are only filled in when a single order is fetched or
+// created at checkout.
 type Orders struct {
 	Order_id   int
-	TotalPrice int
+	User_id    int
+	TotalPrice money.Money
 	Status     string
 	CreatedAt  time.Time
 	ProductName string
 	Username string
 	Quantity int
+	Discounts    []OrderDiscount `json:",omitempty"`
+	Ship_to      *Address        `json:",omitempty"`
+	Shipping     *ShippingCharge `json:",omitempty"`
+	Tax          *money.Money    `json:",omitempty"`
+	Tax_included bool            `json:",omitempty"`
+}
+
+// Order statuses.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderFulfilled = "fulfilled"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+// OrderStatusChange is one entry in an order's timeline. From_status is empty
+// for the entry that created the order; Actor_id is 0 when no user made the
+// change.
+type OrderStatusChange struct {
+	History_id  int
+	Order_id    int
+	From_status string
+	To_status   string
+	Actor_id    int
+	Note        string
+	CreatedAt   time.Time
+}
+
+// Address is a postal address. Country is an ISO 3166-1 alpha-2 code and
+// Region the state, province or county, as the tax tables name it.
+type Address struct {
+	Line1       string
+	Line2       string `json:",omitempty"`
+	City        string
+	Region      string `json:",omitempty"`
+	Postal_code string `json:",omitempty"`
+	Country     string
+}
+
+// Delivery is where and how a cart is to be shipped. A nil Ship_to means the
+// user's own address, and an empty Shipping_method the cheapest one.
+type Delivery struct {
+	Ship_to         *Address
+	Shipping_method string
+}
+
+// ShippingCharge is the shipping method chosen for a cart or order and its
+// price, before any free-shipping discount.
+type ShippingCharge struct {
+	Method       string
+	Name         string
+	Weight_grams int `json:",omitempty"`
+	Amount       money.Money
+}
+
+// TaxLine is one tax of a quote: Percent of Taxable. Inclusive taxes are
+// already part of the prices and are not added to the total.
+type TaxLine struct {
+	Name      string
+	Percent   float64
+	Inclusive bool
+	Taxable   money.Money
+	Amount    money.Money
 }
 
+// Quote prices a cart for delivery to Ship_to, the way checkout will:
+// Total is Subtotal less Discount_total, plus Shipping and the taxes that are
+// not inclusive. Shipping is nil when no shipping rates are set up.
+type Quote struct {
+	Ship_to        Address
+	Items          []CartLine
+	Subtotal       money.Money
+	Coupon_code    string          `json:",omitempty"`
+	Discounts      []OrderDiscount `json:",omitempty"`
+	Discount_total money.Money
+	Shipping       *ShippingCharge `json:",omitempty"`
+	Taxes          []TaxLine       `json:",omitempty"`
+	Tax_total      money.Money
+	Total          money.Money
+}
+
+// Checkout is the order created from a user's cart, with its lines.
+type Checkout struct {
+	Order Orders
+	Items []OrderProduct
+}
+
+// Coupon kinds.
+const (
+	CouponPercentage   = "percentage"
+	CouponFixed        = "fixed"
+	CouponFreeShipping = "free_shipping"
+	CouponBuyXGetY     = "buy_x_get_y"
+)
+
+// Coupon is a discount code. A percentage coupon takes Percent off the
+// eligible lines and a fixed one takes Amount off them; free_shipping waives
+// shipping; buy_x_get_y takes Percent off Get_quantity of every Buy_quantity +
+// Get_quantity eligible units, the cheapest ones, so 100 makes them free.
+// Product_ids and Categories (slugs, subcategories included) restrict the
+// eligible products; with neither, every product is eligible. Min_order is
+// checked against the whole cart subtotal. Nil times leave the window open,
+// and a Max_uses or Max_uses_per_user of 0 means no limit. Times_used counts
+// the orders that used the code, cancelled ones excepted.
+type Coupon struct {
+	Coupon_id         int
+	Code              string
+	Kind              string
+	Percent           int          `json:",omitempty"`
+	Amount            *money.Money `json:",omitempty"`
+	Buy_quantity      int          `json:",omitempty"`
+	Get_quantity      int          `json:",omitempty"`
+	Min_order         *money.Money `json:",omitempty"`
+	Starts_at         *time.Time   `json:",omitempty"`
+	Ends_at           *time.Time   `json:",omitempty"`
+	Max_uses          int
+	Max_uses_per_user int
+	Product_ids       []int    `json:",omitempty"`
+	Categories        []string `json:",omitempty"`
+	Times_used        int
+	CreatedAt         time.Time
+}
+
+// OrderDiscount is one discount line of an order or cart. Product_id is the
+// product it was taken from, or 0 when it applies to the whole order.
+// Coupon_id is 0 once the coupon has been deleted; Code keeps its name.
+type OrderDiscount struct {
+	Discount_id int `json:",omitempty"`
+	Order_id    int `json:",omitempty"`
+	Coupon_id   int
+	Code        string
+	Kind        string
+	Product_id  int `json:",omitempty"`
+	Description string
+	Amount      money.Money
+}
+
+// CartLine is a cart line priced at the current catalog price. Weight_grams
+// is the weight of one unit. Img_url is the variant's picture, or else the
+// product's; Image, the first picture of the product's gallery, is only
+// filled in for the cart itself.
+type CartLine struct {
+	CP_id        int
+	Product_id   int
+	Variant_id   int
+	Product_name string
+	Img_url      string        `json:",omitempty"`
+	Image        *ProductImage `json:",omitempty"`
+	Quantity     int
+	Weight_grams int `json:",omitempty"`
+	Unit_price   money.Money
+	Line_total   money.Money
+}
+
+// CartView is a user's cart as they see it. Subtotal is before the discounts
+// of Coupon_code, which POST /cart/quote works out along with shipping and
+// tax. An empty cart has a Subtotal with no currency.
+type CartView struct {
+	Cart_id     int
+	Items       []CartLine
+	Subtotal    money.Money
+	Coupon_code string `json:",omitempty"`
+}
+
+// GuestCart is an anonymous visitor's cart and the signed guest token that
+// opens it until Expires_at. Guest_id is the id the token carries.
+type GuestCart struct {
+	Cart_id     int
+	Guest_id    string `json:"-"`
+	Guest_token string
+	Expires_at  time.Time
+}
+
+// CartSummary prices a user's cart: Total is Subtotal less Discount_total.
+// Coupon_code is the code applied to the cart, if any.
+type CartSummary struct {
+	Items          []CartLine
+	Subtotal       money.Money
+	Coupon_code    string          `json:",omitempty"`
+	Discounts      []OrderDiscount `json:",omitempty"`
+	Discount_total money.Money
+	Total          money.Money
+}
+
+// Payment statuses.
+const (
+	PaymentPending       = "pending"
+	PaymentAuthorized    = "authorized"
+	PaymentCaptured      = "captured"
+	PaymentFailed        = "failed"
+	PaymentRefundPending = "refund_pending"
+	PaymentRefunded      = "refunded"
+)
+
+// Payment is a charge against an order, in the order's currency.
 type Payment struct {
-	Payment_id int
-	Order_id   int
-	Card_id    int
-	Method     string
-	Amount     int
-	Currency   string
-	Status     string
-	CreatedAt  time.Time
+	Payment_id   int
+	Order_id     int
+	Card_id      int
+	Method       string
+	Amount       money.Money
+	Status       string
+	Provider_ref string
+	CreatedAt    time.Time
 }
 
 type Users struct {
@@ -66,12 +393,51 @@ type Users struct {
 	Email     string
 	Password  string
 	Phone     string
-	Address   string
+	Address   Address
+	Role      string
 	CreatedAt time.Time
 }
 
+// User roles. New accounts are customers; staff run fulfilment and the
+// catalog, admins additionally manage users.
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+// TokenPair is what a login or refresh hands out: a short-lived access token
+// and the refresh token that can be exchanged, once, for the next pair.
+// User_id is whom they were issued to.
+type TokenPair struct {
+	Token        string
+	RefreshToken string
+	ExpiresIn    time.Duration
+	User_id      int `json:"-"`
+}
+
 type JWTClaims struct {
 	UserID   int
 	UserName string
+	Role     string
 	jwt.RegisteredClaims
 }
+
+// GuestAudience is the audience of guest tokens. Their subject is the guest
+// id of the cart they open; they carry no user and are never access tokens.
+const GuestAudience = "guest_cart"
+
+// A guest token travels in the GuestTokenHeader request header or in the
+// GuestCookie cookie.
+const (
+	GuestTokenHeader = "X-Guest-Token"
+	GuestCookie      = "guest_cart"
+)
+
+// Page is one page of a keyset-paginated list. Next_cursor is empty on the
+// last page; Total counts every row matching the filters, across all pages.
+type Page[T any] struct {
+	Items       []T    `json:"items"`
+	Next_cursor string `json:"next_cursor,omitempty"`
+	Total       int    `json:"total"`
+}
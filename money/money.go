@@ -0,0 +1,155 @@
+// Package money is the shop's representation of prices and payment amounts:
+// an integer count of a currency's minor units together with its ISO 4217
+// code, so an amount is never mistaken for dollars when it is cents, nor added
+// to an amount in another currency.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	// ErrCurrencyMismatch is returned when amounts in different currencies are
+	// combined or compared.
+	ErrCurrencyMismatch = errors.New("currencies do not match")
+	// ErrOverflow is returned when a sum does not fit in an int64.
+	ErrOverflow = errors.New("amount out of range")
+)
+
+// Money is Amount minor units of Currency: {1999, "USD"} is $19.99 and
+// {500, "JPY"} is ¥500. In JSON it is {"Amount": 1999, "Currency": "USD"};
+// the amount is always an integer.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns amount minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Zero returns no money in currency, the starting point of a sum.
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Valid reports whether m's currency is known.
+func (m Money) Valid() bool {
+	return KnownCurrency(m.Currency)
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return nil
+}
+
+// Add returns m + o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o. Both must be in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Mul returns m times a quantity.
+func (m Money) Mul(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+// MulFrac returns m * num / den rounded to the nearest minor unit, halves
+// away from zero, which is how prices, discounts and taxes are rounded: 10%
+// of 1.25 is 0.13 and of -1.25 is -0.13. den must not be zero.
+func (m Money) MulFrac(num, den int64) Money {
+	n := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	d := big.NewInt(den)
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+
+	twice := new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	if twice.Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Money{Amount: q.Int64(), Currency: m.Currency}
+}
+
+// Cmp compares m and o, which must be in the same currency: -1 if m is less,
+// 0 if equal and +1 if more.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// String formats m in major units for logs and messages, e.g. "19.99 USD",
+// "-0.05 EUR" or "500 JPY".
+func (m Money) String() string {
+	digits, ok := MinorUnits(m.Currency)
+	if !ok || digits == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	sign, abs := "", new(big.Int).Abs(big.NewInt(m.Amount)).String()
+	if m.Amount < 0 {
+		sign = "-"
+	}
+	if len(abs) <= digits {
+		abs = strings.Repeat("0", digits-len(abs)+1) + abs
+	}
+	cut := len(abs) - digits
+	return fmt.Sprintf("%s%s.%s %s", sign, abs[:cut], abs[cut:], m.Currency)
+}
+
+// UnmarshalJSON accepts only {"Amount": <integer>, "Currency": <known code>},
+// so a decimal amount or a missing currency is rejected rather than guessed.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Amount   *int64
+		Currency *string
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("money must be {\"Amount\": <minor units>, \"Currency\": <ISO 4217 code>}: %w", err)
+	}
+	if v.Amount == nil || v.Currency == nil {
+		return errors.New("money needs both Amount and Currency")
+	}
+	if !KnownCurrency(*v.Currency) {
+		return fmt.Errorf("unknown currency %q", *v.Currency)
+	}
+	*m = Money{Amount: *v.Amount, Currency: *v.Currency}
+	return nil
+}
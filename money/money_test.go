@@ -0,0 +1,136 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMulFrac(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{"exact", 1000, 1, 10, 100},
+		{"half rounds up", 125, 1, 10, 13},
+		{"half rounds away from zero", -125, 1, 10, -13},
+		{"below half rounds down", 124, 1, 10, 12},
+		{"above half rounds up", 126, 1, 10, 13},
+		{"negative below half", -124, 1, 10, -12},
+		{"negative denominator", 125, 1, -10, -13},
+		{"tax in basis points", 4000, 725, 10000, 290},
+		{"inclusive tax backed out", 11900, 1900, 11900, 1900},
+		{"no overflow in the product", math.MaxInt64, 3, 3, math.MaxInt64},
+		{"zero", 0, 7, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.amount, "USD").MulFrac(tt.num, tt.den)
+			if got != New(tt.want, "USD") {
+				t.Fatalf("%d * %d / %d = %v, want %d", tt.amount, tt.num, tt.den, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{"same currency", New(150, "USD"), New(250, "USD"), New(400, "USD"), nil},
+		{"negative", New(150, "USD"), New(-250, "USD"), New(-100, "USD"), nil},
+		{"currency mismatch", New(150, "USD"), New(250, "EUR"), Money{}, ErrCurrencyMismatch},
+		{"zero without currency", Money{}, New(1, "USD"), Money{}, ErrCurrencyMismatch},
+		{"overflow", New(math.MaxInt64, "USD"), New(1, "USD"), Money{}, ErrOverflow},
+		{"underflow", New(math.MinInt64, "USD"), New(-1, "USD"), Money{}, ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("%v + %v = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCmp(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Money
+		want    int
+		wantErr error
+	}{
+		{"less", New(1, "USD"), New(2, "USD"), -1, nil},
+		{"equal", New(2, "USD"), New(2, "USD"), 0, nil},
+		{"more", New(3, "USD"), New(2, "USD"), 1, nil},
+		{"currency mismatch", New(2, "USD"), New(2, "EUR"), 0, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Cmp(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Cmp(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    Money
+		wantErr bool
+	}{
+		{"valid", `{"Amount": 1999, "Currency": "USD"}`, New(1999, "USD"), false},
+		{"zero amount", `{"Amount": 0, "Currency": "JPY"}`, New(0, "JPY"), false},
+		{"missing currency", `{"Amount": 1999}`, Money{}, true},
+		{"missing amount", `{"Currency": "USD"}`, Money{}, true},
+		{"unknown currency", `{"Amount": 1999, "Currency": "XYZ"}`, Money{}, true},
+		{"lower case currency", `{"Amount": 1999, "Currency": "usd"}`, Money{}, true},
+		{"decimal amount", `{"Amount": 19.99, "Currency": "USD"}`, Money{}, true},
+		{"bare number", `1999`, Money{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1999, "USD"), "19.99 USD"},
+		{New(-5, "EUR"), "-0.05 EUR"},
+		{New(500, "JPY"), "500 JPY"},
+		{New(1234, "KWD"), "1.234 KWD"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package payments
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCardNumber = errors.New("invalid card number")
+	ErrInvalidExpiry     = errors.New("invalid card expiry")
+	ErrCardExpired       = errors.New("card has expired")
+	ErrMissingHolder     = errors.New("cardholder name is required")
+)
+
+// CardDetails is what a customer types in. It only ever lives in memory and in
+// the Vault; the database keeps the token, brand and last four digits.
+type CardDetails struct {
+	Number     string
+	ExpMonth   int
+	ExpYear    int
+	HolderName string
+}
+
+// Validate normalizes the number (spaces and dashes removed, two-digit years
+// widened) and checks it with Luhn, then checks the expiry against now and the
+// holder name.
+func (c *CardDetails) Validate(now time.Time) error {
+	c.Number = NormalizeCardNumber(c.Number)
+	if len(c.Number) < 12 || len(c.Number) > 19 || !ValidLuhn(c.Number) {
+		return ErrInvalidCardNumber
+	}
+
+	if c.ExpYear >= 0 && c.ExpYear < 100 {
+		c.ExpYear += 2000
+	}
+	if c.ExpMonth < 1 || c.ExpMonth > 12 || c.ExpYear < 2000 {
+		return ErrInvalidExpiry
+	}
+	// a card is valid through the last day of its expiry month
+	if c.ExpYear < now.Year() || (c.ExpYear == now.Year() && c.ExpMonth < int(now.Month())) {
+		return ErrCardExpired
+	}
+
+	c.HolderName = strings.TrimSpace(c.HolderName)
+	if c.HolderName == "" {
+		return ErrMissingHolder
+	}
+	return nil
+}
+
+// Brand is the card network of the number.
+func (c CardDetails) Brand() string {
+	return CardBrand(c.Number)
+}
+
+// Last4 is the part of the number that may be shown and stored.
+func (c CardDetails) Last4() string {
+	if len(c.Number) < 4 {
+		return c.Number
+	}
+	return c.Number[len(c.Number)-4:]
+}
+
+// NormalizeCardNumber drops the spaces and dashes people type between digit
+// groups. Anything else that is not a digit is kept so validation rejects it.
+func NormalizeCardNumber(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// ValidLuhn reports whether number is all digits and passes the Luhn check.
+func ValidLuhn(number string) bool {
+	if number == "" {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// CardBrand detects the network from the number's issuer prefix. Unrecognized
+// prefixes are "unknown" rather than an error; Luhn decides validity.
+func CardBrand(number string) string {
+	prefix := func(n int) int {
+		if len(number) < n {
+			return -1
+		}
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v*10 + int(number[i]-'0')
+		}
+		return v
+	}
+
+	switch {
+	case prefix(1) == 4:
+		return "visa"
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720:
+		return "mastercard"
+	case prefix(2) == 34, prefix(2) == 37:
+		return "amex"
+	case prefix(4) == 6011, prefix(2) == 65, prefix(3) >= 644 && prefix(3) <= 649:
+		return "discover"
+	case prefix(4) >= 3528 && prefix(4) <= 3589:
+		return "jcb"
+	case prefix(2) == 36, prefix(2) == 38, prefix(2) == 39, prefix(3) >= 300 && prefix(3) <= 305:
+		return "diners"
+	case prefix(2) == 62:
+		return "unionpay"
+	}
+	return "unknown"
+}
@@ -0,0 +1,87 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidLuhn(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4242424242424242", true},
+		{"4242424242424241", false},
+		{"378282246310005", true},
+		{"5555555555554444", true},
+		{"0", true},
+		{"", false},
+		{"4242 4242 4242 4242", false},
+		{"42424242424242a2", false},
+	}
+	for _, tt := range tests {
+		if got := ValidLuhn(tt.number); got != tt.want {
+			t.Errorf("ValidLuhn(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestCardBrand(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"4242424242424242", "visa"},
+		{"5555555555554444", "mastercard"},
+		{"2223003122003222", "mastercard"},
+		{"378282246310005", "amex"},
+		{"6011111111111117", "discover"},
+		{"6500000000000002", "discover"},
+		{"3530111333300000", "jcb"},
+		{"30569309025904", "diners"},
+		{"6200000000000005", "unionpay"},
+		{"9999999999999995", "unknown"},
+		{"", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := CardBrand(tt.number); got != tt.want {
+			t.Errorf("CardBrand(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		card     CardDetails
+		wantErr  error
+		wantYear int
+	}{
+		{"valid", CardDetails{Number: "4242 4242-4242 4242", ExpMonth: 12, ExpYear: 2030, HolderName: " Dave D "}, nil, 2030},
+		{"two-digit year", CardDetails{Number: "4242424242424242", ExpMonth: 1, ExpYear: 27, HolderName: "Dave D"}, nil, 2027},
+		{"expires this month", CardDetails{Number: "4242424242424242", ExpMonth: 10, ExpYear: 26, HolderName: "Dave D"}, nil, 2026},
+		{"expired last month", CardDetails{Number: "4242424242424242", ExpMonth: 9, ExpYear: 2026, HolderName: "Dave D"}, ErrCardExpired, 2026},
+		{"expired last year", CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 25, HolderName: "Dave D"}, ErrCardExpired, 2025},
+		{"bad month", CardDetails{Number: "4242424242424242", ExpMonth: 13, ExpYear: 2030, HolderName: "Dave D"}, ErrInvalidExpiry, 2030},
+		{"bad year", CardDetails{Number: "4242424242424242", ExpMonth: 1, ExpYear: 199, HolderName: "Dave D"}, ErrInvalidExpiry, 199},
+		{"fails Luhn", CardDetails{Number: "4242424242424241", ExpMonth: 12, ExpYear: 2030, HolderName: "Dave D"}, ErrInvalidCardNumber, 2030},
+		{"too short", CardDetails{Number: "42424242", ExpMonth: 12, ExpYear: 2030, HolderName: "Dave D"}, ErrInvalidCardNumber, 2030},
+		{"no holder", CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, HolderName: "  "}, ErrMissingHolder, 2030},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := tt.card
+			if err := card.Validate(now); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (card.Number != "4242424242424242" || card.HolderName != "Dave D") {
+				t.Fatalf("card = %+v, want number and holder normalized", card)
+			}
+			if tt.wantErr != ErrInvalidCardNumber && card.ExpYear != tt.wantYear {
+				t.Fatalf("ExpYear = %d, want %d", card.ExpYear, tt.wantYear)
+			}
+		})
+	}
+}
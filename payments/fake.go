@@ -0,0 +1,88 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"my-go-project/money"
+	"sync"
+)
+
+// DeclineLast4 is the card ending that FakeProvider always declines, in the
+// spirit of processor test cards.
+const DeclineLast4 = "0002"
+
+// FakeProvider is a deterministic in-process PaymentProvider for development
+// and tests. References are numbered in call order, every card is authorized
+// unless it ends in DeclineLast4, and captures and refunds are checked against
+// the amounts previously held.
+type FakeProvider struct {
+	mu       sync.Mutex
+	next     int
+	held     map[string]money.Money
+	captured map[string]money.Money
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{held: map[string]money.Money{}, captured: map[string]money.Money{}}
+}
+
+var _ PaymentProvider = (*FakeProvider)(nil)
+
+func (f *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if req.Amount.Amount <= 0 || !req.Amount.Valid() {
+		return Result{}, fmt.Errorf("invalid amount %v", req.Amount)
+	}
+	if req.Card.Last4 == DeclineLast4 {
+		return Result{Status: "declined"}, ErrDeclined
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	ref := fmt.Sprintf("fake_%d", f.next)
+	f.held[ref] = req.Amount
+	return Result{Reference: ref, Status: "authorized"}, nil
+}
+
+func (f *FakeProvider) Capture(ctx context.Context, reference string, amount money.Money) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	held, ok := f.held[reference]
+	if !ok {
+		return Result{}, ErrUnknownReference
+	}
+	if cmp, err := amount.Cmp(held); err != nil || amount.Amount <= 0 || cmp > 0 {
+		return Result{}, fmt.Errorf("capture of %v does not fit authorized %v", amount, held)
+	}
+	delete(f.held, reference)
+	f.captured[reference] = amount
+	return Result{Reference: reference, Status: "captured"}, nil
+}
+
+func (f *FakeProvider) Refund(ctx context.Context, reference string, amount money.Money) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	captured, ok := f.captured[reference]
+	if !ok {
+		return Result{}, ErrUnknownReference
+	}
+	if cmp, err := amount.Cmp(captured); err != nil || amount.Amount <= 0 || cmp > 0 {
+		return Result{}, fmt.Errorf("refund of %v does not fit captured %v", amount, captured)
+	}
+	f.captured[reference], _ = captured.Sub(amount)
+	return Result{Reference: reference, Status: "refunded"}, nil
+}
@@ -0,0 +1,171 @@
+package payments
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// LocalVault is a development Vault that keeps cards AES-256-GCM encrypted in a
+// JSON file (or only in memory when path is empty). Each entry is sealed with
+// its token as additional data, so ciphertexts cannot be swapped between
+// tokens. It is not a substitute for a PCI-certified vault in production.
+type LocalVault struct {
+	mu      sync.Mutex
+	aead    cipher.AEAD
+	path    string
+	entries map[string][]byte
+}
+
+// NewLocalVault opens the vault file at path, creating it on first write. key
+// must be 32 bytes.
+func NewLocalVault(key []byte, path string) (*LocalVault, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("vault key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &LocalVault{aead: aead, path: path, entries: map[string][]byte{}}
+	if path == "" {
+		return v, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read vault: %w", err)
+	}
+	if err := json.Unmarshal(data, &v.entries); err != nil {
+		return nil, fmt.Errorf("parse vault %s: %w", path, err)
+	}
+	return v, nil
+}
+
+var _ Vault = (*LocalVault)(nil)
+
+func (v *LocalVault) Tokenize(ctx context.Context, card CardDetails) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := "tok_" + hex.EncodeToString(raw)
+
+	plaintext, err := json.Marshal(card)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := v.aead.Seal(nonce, nonce, plaintext, []byte(token))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.entries[token] = sealed
+	if err := v.save(); err != nil {
+		delete(v.entries, token)
+		return "", err
+	}
+	return token, nil
+}
+
+func (v *LocalVault) Detokenize(ctx context.Context, token string) (CardDetails, error) {
+	if err := ctx.Err(); err != nil {
+		return CardDetails{}, err
+	}
+
+	v.mu.Lock()
+	sealed, ok := v.entries[token]
+	v.mu.Unlock()
+	if !ok {
+		return CardDetails{}, ErrUnknownToken
+	}
+
+	n := v.aead.NonceSize()
+	if len(sealed) < n {
+		return CardDetails{}, fmt.Errorf("vault entry for %s is corrupt", token)
+	}
+	plaintext, err := v.aead.Open(nil, sealed[:n], sealed[n:], []byte(token))
+	if err != nil {
+		return CardDetails{}, fmt.Errorf("decrypt vault entry: %w", err)
+	}
+
+	var card CardDetails
+	if err := json.Unmarshal(plaintext, &card); err != nil {
+		return CardDetails{}, err
+	}
+	return card, nil
+}
+
+func (v *LocalVault) Delete(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	sealed, ok := v.entries[token]
+	if !ok {
+		return ErrUnknownToken
+	}
+	delete(v.entries, token)
+	if err := v.save(); err != nil {
+		v.entries[token] = sealed
+		return err
+	}
+	return nil
+}
+
+// save rewrites the vault file atomically. Callers hold v.mu.
+func (v *LocalVault) save() error {
+	if v.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(v.entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("write vault: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write vault: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write vault: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return fmt.Errorf("write vault: %w", err)
+	}
+	return nil
+}
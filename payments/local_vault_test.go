@@ -0,0 +1,105 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func testKey() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func TestLocalVaultRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	v, err := NewLocalVault(testKey(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card := CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, HolderName: "Dave D"}
+	token, err := v.Tokenize(ctx, card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := v.Detokenize(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != card {
+		t.Fatalf("Detokenize = %+v, want %+v", got, card)
+	}
+
+	if err := v.Delete(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Detokenize(ctx, token); !errors.Is(err, ErrUnknownToken) {
+		t.Fatalf("deleted token: err = %v, want ErrUnknownToken", err)
+	}
+	if _, err := NewLocalVault(make([]byte, 16), ""); err == nil {
+		t.Fatal("16-byte key accepted")
+	}
+}
+
+func TestLocalVaultRejectsSwappedCiphertext(t *testing.T) {
+	ctx := context.Background()
+	v, err := NewLocalVault(testKey(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := v.Tokenize(ctx, CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, HolderName: "Dave D"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := v.Tokenize(ctx, CardDetails{Number: "5555555555554444", ExpMonth: 1, ExpYear: 2031, HolderName: "Erin E"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the token is the additional data, so a's entry does not open under b
+	v.entries[b] = v.entries[a]
+	if _, err := v.Detokenize(ctx, b); err == nil {
+		t.Fatal("ciphertext moved to another token decrypted")
+	}
+}
+
+func TestLocalVaultPersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := NewLocalVault(testKey(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card := CardDetails{Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030, HolderName: "Dave D"}
+	token, err := v.Tokenize(ctx, card)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewLocalVault(testKey(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Detokenize(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != card {
+		t.Fatalf("after reopening: %+v, want %+v", got, card)
+	}
+
+	otherKey := testKey()
+	otherKey[0] ^= 0xff
+	wrong, err := NewLocalVault(otherKey, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Detokenize(ctx, token); err == nil {
+		t.Fatal("entry decrypted under another key")
+	}
+}
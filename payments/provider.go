@@ -0,0 +1,44 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"my-go-project/money"
+)
+
+var (
+	// ErrDeclined is returned when the provider refuses to authorize a charge.
+	ErrDeclined = errors.New("payment declined")
+	// ErrUnknownReference is returned for a capture or refund of a payment the
+	// provider has no record of.
+	ErrUnknownReference = errors.New("unknown payment reference")
+)
+
+// Card identifies the stored card a charge is made against.
+type Card struct {
+	Token string
+	Last4 string
+}
+
+// AuthorizeRequest asks the provider to hold Amount on Card.
+type AuthorizeRequest struct {
+	OrderID int
+	Amount  money.Money
+	Card    Card
+}
+
+// Result is the provider's answer; Reference is what later captures and
+// refunds of the same payment must quote.
+type Result struct {
+	Reference string
+	Status    string
+}
+
+// PaymentProvider is a card processor. Authorize places a hold, Capture
+// collects a held amount and Refund returns a captured one, in the currency
+// the payment was authorized in.
+type PaymentProvider interface {
+	Authorize(ctx context.Context, req AuthorizeRequest) (Result, error)
+	Capture(ctx context.Context, reference string, amount money.Money) (Result, error)
+	Refund(ctx context.Context, reference string, amount money.Money) (Result, error)
+}
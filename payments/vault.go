@@ -0,0 +1,18 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnknownToken is returned for a token the vault has no card for.
+var ErrUnknownToken = errors.New("unknown card token")
+
+// Vault exchanges card details for an opaque token so the rest of the system
+// never stores a card number. Only the payment provider integration should
+// need Detokenize.
+type Vault interface {
+	Tokenize(ctx context.Context, card CardDetails) (string, error)
+	Detokenize(ctx context.Context, token string) (CardDetails, error)
+	Delete(ctx context.Context, token string) error
+}
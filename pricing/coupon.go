@@ -0,0 +1,179 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"my-go-project/models"
+	"my-go-project/money"
+	"sort"
+	"time"
+)
+
+// ErrCouponNotApplicable is matched by every CouponError.
+var ErrCouponNotApplicable = errors.New("coupon does not apply")
+
+// Reasons a coupon does not apply to a cart.
+const (
+	ReasonNotStarted      = "not_started"
+	ReasonExpired         = "expired"
+	ReasonUsageLimit      = "usage_limit"
+	ReasonUserLimit       = "user_limit"
+	ReasonMinOrder        = "min_order"
+	ReasonCurrency        = "currency"
+	ReasonNoEligibleItems = "no_eligible_items"
+	ReasonNotEnoughItems  = "not_enough_items"
+)
+
+// CouponError explains why the coupon Code cannot be used on a cart.
+type CouponError struct {
+	Code   string
+	Reason string
+}
+
+func (e *CouponError) Error() string {
+	return fmt.Sprintf("coupon %s does not apply: %s", e.Code, e.Reason)
+}
+
+func (e *CouponError) Unwrap() error {
+	return ErrCouponNotApplicable
+}
+
+// Usage counts the orders that have used a coupon, in all and by the user
+// about to use it again.
+type Usage struct {
+	Total  int
+	ByUser int
+}
+
+// CheckCoupon reports whether c can be used at now on a cart worth subtotal,
+// given how often it has been used. The error is a *CouponError.
+func CheckCoupon(c models.Coupon, now time.Time, subtotal money.Money, usage Usage) error {
+	fail := func(reason string) error {
+		return &CouponError{Code: c.Code, Reason: reason}
+	}
+	switch {
+	case c.Starts_at != nil && now.Before(*c.Starts_at):
+		return fail(ReasonNotStarted)
+	case c.Ends_at != nil && !now.Before(*c.Ends_at):
+		return fail(ReasonExpired)
+	case c.Max_uses > 0 && usage.Total >= c.Max_uses:
+		return fail(ReasonUsageLimit)
+	case c.Max_uses_per_user > 0 && usage.ByUser >= c.Max_uses_per_user:
+		return fail(ReasonUserLimit)
+	case c.Amount != nil && c.Amount.Currency != subtotal.Currency:
+		return fail(ReasonCurrency)
+	}
+	if c.Min_order != nil {
+		cmp, err := subtotal.Cmp(*c.Min_order)
+		if err != nil {
+			return fail(ReasonCurrency)
+		}
+		if cmp < 0 {
+			return fail(ReasonMinOrder)
+		}
+	}
+	return nil
+}
+
+// Discounts works out the discount lines c gives on lines. eligible reports
+// whether the coupon covers a product. Percentages are rounded per line, to
+// the nearest minor unit.
+func Discounts(c models.Coupon, lines []models.CartLine, eligible func(productID int) bool) ([]models.OrderDiscount, error) {
+	var covered []int
+	for i, l := range lines {
+		if eligible(l.Product_id) {
+			covered = append(covered, i)
+		}
+	}
+	if len(covered) == 0 {
+		return nil, &CouponError{Code: c.Code, Reason: ReasonNoEligibleItems}
+	}
+
+	discount := func(productID int, amount money.Money, description string) models.OrderDiscount {
+		return models.OrderDiscount{
+			Coupon_id:   c.Coupon_id,
+			Code:        c.Code,
+			Kind:        c.Kind,
+			Product_id:  productID,
+			Description: description,
+			Amount:      amount,
+		}
+	}
+	currency := lines[covered[0]].Unit_price.Currency
+
+	var discounts []models.OrderDiscount
+	switch c.Kind {
+	case models.CouponPercentage:
+		for _, i := range covered {
+			l := lines[i]
+			discounts = append(discounts, discount(l.Product_id, l.Unit_price.Mul(l.Quantity).MulFrac(int64(c.Percent), 100), fmt.Sprintf("%d%% off", c.Percent)))
+		}
+
+	case models.CouponFixed:
+		base := money.Zero(currency)
+		for _, i := range covered {
+			var err error
+			if base, err = base.Add(lines[i].Unit_price.Mul(lines[i].Quantity)); err != nil {
+				return nil, err
+			}
+		}
+		amount := *c.Amount
+		if cmp, err := amount.Cmp(base); err != nil {
+			return nil, &CouponError{Code: c.Code, Reason: ReasonCurrency}
+		} else if cmp > 0 {
+			amount = base
+		}
+		discounts = append(discounts, discount(0, amount, fmt.Sprintf("%s off", c.Amount)))
+
+	case models.CouponFreeShipping:
+		discounts = append(discounts, discount(0, money.Zero(currency), "Free shipping"))
+
+	case models.CouponBuyXGetY:
+		free := cheapestUnits(lines, covered, c.Buy_quantity, c.Get_quantity)
+		if free == nil {
+			return nil, &CouponError{Code: c.Code, Reason: ReasonNotEnoughItems}
+		}
+		description := fmt.Sprintf("Buy %d get %d free", c.Buy_quantity, c.Get_quantity)
+		if c.Percent < 100 {
+			description = fmt.Sprintf("Buy %d get %d at %d%% off", c.Buy_quantity, c.Get_quantity, c.Percent)
+		}
+		for _, i := range covered {
+			if free[i] > 0 {
+				l := lines[i]
+				discounts = append(discounts, discount(l.Product_id, l.Unit_price.Mul(free[i]).MulFrac(int64(c.Percent), 100), description))
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown coupon kind %q", c.Kind)
+	}
+	return discounts, nil
+}
+
+// cheapestUnits counts, per line, the units a buy-x-get-y offer discounts: get
+// units for every full set of buy + get eligible units, taken from the
+// cheapest. It returns nil when there is not one full set.
+func cheapestUnits(lines []models.CartLine, covered []int, buy, get int) map[int]int {
+	units := 0
+	for _, i := range covered {
+		units += lines[i].Quantity
+	}
+	n := units / (buy + get) * get
+	if n == 0 {
+		return nil
+	}
+
+	byPrice := append([]int{}, covered...)
+	sort.SliceStable(byPrice, func(a, b int) bool {
+		return lines[byPrice[a]].Unit_price.Amount < lines[byPrice[b]].Unit_price.Amount
+	})
+	free := map[int]int{}
+	for _, i := range byPrice {
+		take := min(n, lines[i].Quantity)
+		free[i] = take
+		if n -= take; n == 0 {
+			break
+		}
+	}
+	return free
+}
@@ -0,0 +1,182 @@
+package pricing
+
+import (
+	"errors"
+	"my-go-project/models"
+	"my-go-project/money"
+	"testing"
+	"time"
+)
+
+func usd(amount int64) money.Money {
+	return money.New(amount, "USD")
+}
+
+func usdPtr(amount int64) *money.Money {
+	m := usd(amount)
+	return &m
+}
+
+func line(productID int, cents int64, quantity int) models.CartLine {
+	return models.CartLine{Product_id: productID, Unit_price: usd(cents), Quantity: quantity}
+}
+
+func everyProduct(int) bool { return true }
+
+func TestCheckCoupon(t *testing.T) {
+	start := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	window := models.Coupon{Code: "SUMMER", Starts_at: &start, Ends_at: &end}
+
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		now      time.Time
+		subtotal money.Money
+		usage    Usage
+		reason   string
+	}{
+		{"before start", window, start.Add(-time.Nanosecond), usd(1000), Usage{}, ReasonNotStarted},
+		{"at start", window, start, usd(1000), Usage{}, ""},
+		{"just before end", window, end.Add(-time.Nanosecond), usd(1000), Usage{}, ""},
+		{"at end", window, end, usd(1000), Usage{}, ReasonExpired},
+		{"no window", models.Coupon{Code: "ANY"}, end, usd(1000), Usage{}, ""},
+		{"below usage limit", models.Coupon{Code: "TEN", Max_uses: 10}, start, usd(1000), Usage{Total: 9}, ""},
+		{"usage limit reached", models.Coupon{Code: "TEN", Max_uses: 10}, start, usd(1000), Usage{Total: 10}, ReasonUsageLimit},
+		{"below per-user limit", models.Coupon{Code: "ONCE", Max_uses_per_user: 1}, start, usd(1000), Usage{Total: 5}, ""},
+		{"per-user limit reached", models.Coupon{Code: "ONCE", Max_uses_per_user: 1}, start, usd(1000), Usage{Total: 5, ByUser: 1}, ReasonUserLimit},
+		{"at minimum order", models.Coupon{Code: "MIN", Min_order: usdPtr(5000)}, start, usd(5000), Usage{}, ""},
+		{"below minimum order", models.Coupon{Code: "MIN", Min_order: usdPtr(5000)}, start, usd(4999), Usage{}, ReasonMinOrder},
+		{"minimum in another currency", models.Coupon{Code: "MIN", Min_order: usdPtr(5000)}, start, money.New(9000, "EUR"), Usage{}, ReasonCurrency},
+		{"amount in another currency", models.Coupon{Code: "FIVE", Kind: models.CouponFixed, Amount: usdPtr(500)}, start, money.New(9000, "EUR"), Usage{}, ReasonCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCoupon(tt.coupon, tt.now, tt.subtotal, tt.usage)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			var ce *CouponError
+			if !errors.As(err, &ce) || ce.Reason != tt.reason {
+				t.Fatalf("err = %v, want reason %s", err, tt.reason)
+			}
+			if !errors.Is(err, ErrCouponNotApplicable) {
+				t.Fatalf("err = %v does not match ErrCouponNotApplicable", err)
+			}
+		})
+	}
+}
+
+func TestDiscounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		lines    []models.CartLine
+		eligible func(int) bool
+		want     []int64 // discount amounts, in order
+		products []int   // the product each discount is taken from
+		reason   string
+	}{
+		{
+			name:     "percentage rounded per line",
+			coupon:   models.Coupon{Code: "TEN", Kind: models.CouponPercentage, Percent: 10},
+			lines:    []models.CartLine{line(1, 125, 1), line(2, 135, 1)},
+			eligible: everyProduct,
+			// 12.5 and 13.5 round to 13 and 14; on the 260 subtotal it would be 26
+			want:     []int64{13, 14},
+			products: []int{1, 2},
+		},
+		{
+			name:     "percentage on eligible lines only",
+			coupon:   models.Coupon{Code: "TEN", Kind: models.CouponPercentage, Percent: 10},
+			lines:    []models.CartLine{line(1, 1000, 2), line(2, 5000, 1)},
+			eligible: func(id int) bool { return id == 1 },
+			want:     []int64{200},
+			products: []int{1},
+		},
+		{
+			name:     "fixed below the eligible base",
+			coupon:   models.Coupon{Code: "FIVE", Kind: models.CouponFixed, Amount: usdPtr(500)},
+			lines:    []models.CartLine{line(1, 1000, 1), line(2, 5000, 1)},
+			eligible: everyProduct,
+			want:     []int64{500},
+			products: []int{0},
+		},
+		{
+			name:     "fixed capped at the eligible base",
+			coupon:   models.Coupon{Code: "BIG", Kind: models.CouponFixed, Amount: usdPtr(5000)},
+			lines:    []models.CartLine{line(1, 1000, 2), line(2, 9000, 1)},
+			eligible: func(id int) bool { return id == 1 },
+			want:     []int64{2000},
+			products: []int{0},
+		},
+		{
+			name:     "buy two get one takes the cheapest unit",
+			coupon:   models.Coupon{Code: "B2G1", Kind: models.CouponBuyXGetY, Buy_quantity: 2, Get_quantity: 1, Percent: 100},
+			lines:    []models.CartLine{line(1, 3000, 1), line(2, 1000, 1), line(3, 2000, 1)},
+			eligible: everyProduct,
+			want:     []int64{1000},
+			products: []int{2},
+		},
+		{
+			name:     "buy one get one spans the cheapest lines",
+			coupon:   models.Coupon{Code: "BOGO", Kind: models.CouponBuyXGetY, Buy_quantity: 1, Get_quantity: 1, Percent: 100},
+			lines:    []models.CartLine{line(1, 3000, 2), line(2, 1000, 1), line(3, 2000, 3)},
+			eligible: everyProduct,
+			// six units make three sets: the 10.00 unit and two of the 20.00
+			want:     []int64{1000, 4000},
+			products: []int{2, 3},
+		},
+		{
+			name:     "buy x get y at a percentage off",
+			coupon:   models.Coupon{Code: "B1H", Kind: models.CouponBuyXGetY, Buy_quantity: 1, Get_quantity: 1, Percent: 50},
+			lines:    []models.CartLine{line(1, 999, 2)},
+			eligible: everyProduct,
+			want:     []int64{500},
+			products: []int{1},
+		},
+		{
+			name:     "buy x get y without a full set",
+			coupon:   models.Coupon{Code: "B2G1", Kind: models.CouponBuyXGetY, Buy_quantity: 2, Get_quantity: 1, Percent: 100},
+			lines:    []models.CartLine{line(1, 3000, 2)},
+			eligible: everyProduct,
+			reason:   ReasonNotEnoughItems,
+		},
+		{
+			name:     "nothing eligible",
+			coupon:   models.Coupon{Code: "TEN", Kind: models.CouponPercentage, Percent: 10},
+			lines:    []models.CartLine{line(1, 1000, 1)},
+			eligible: func(int) bool { return false },
+			reason:   ReasonNoEligibleItems,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Discounts(tt.coupon, tt.lines, tt.eligible)
+			if tt.reason != "" {
+				var ce *CouponError
+				if !errors.As(err, &ce) || ce.Reason != tt.reason {
+					t.Fatalf("err = %v, want reason %s", err, tt.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d discounts %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i, d := range got {
+				if d.Amount != usd(tt.want[i]) || d.Product_id != tt.products[i] {
+					t.Errorf("discount %d = %v on product %d, want %d on product %d", i, d.Amount, d.Product_id, tt.want[i], tt.products[i])
+				}
+				if d.Code != tt.coupon.Code || d.Kind != tt.coupon.Kind {
+					t.Errorf("discount %d is %s/%s, want %s/%s", i, d.Code, d.Kind, tt.coupon.Code, tt.coupon.Kind)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package pricing works out what a cart costs: its line totals, its subtotal
+// and the discounts a coupon takes off it. It only does arithmetic; loading
+// carts and coupons and recording their use is the repository's job.
+package pricing
+
+import (
+	"fmt"
+	"my-go-project/models"
+	"my-go-project/money"
+)
+
+// Subtotal adds up the line totals of lines, which must all be in one
+// currency. It is a zero amount with no currency when lines is empty.
+func Subtotal(lines []models.CartLine) (money.Money, error) {
+	var total money.Money
+	for i, l := range lines {
+		if i == 0 {
+			total = money.Zero(l.Unit_price.Currency)
+		}
+		var err error
+		if total, err = total.Add(l.Unit_price.Mul(l.Quantity)); err != nil {
+			return money.Money{}, fmt.Errorf("%w: %s", err, l.Product_name)
+		}
+	}
+	return total, nil
+}
+
+// Summarize prices lines and takes discounts off their subtotal. code is the
+// coupon the discounts came from, if any.
+func Summarize(lines []models.CartLine, code string, discounts []models.OrderDiscount) (models.CartSummary, error) {
+	subtotal, err := Subtotal(lines)
+	if err != nil {
+		return models.CartSummary{}, err
+	}
+
+	summary := models.CartSummary{
+		Items:          make([]models.CartLine, len(lines)),
+		Subtotal:       subtotal,
+		Coupon_code:    code,
+		Discounts:      discounts,
+		Discount_total: money.Zero(subtotal.Currency),
+	}
+	for i, l := range lines {
+		l.Line_total = l.Unit_price.Mul(l.Quantity)
+		summary.Items[i] = l
+	}
+	for _, d := range discounts {
+		if summary.Discount_total, err = summary.Discount_total.Add(d.Amount); err != nil {
+			return models.CartSummary{}, err
+		}
+	}
+	if summary.Total, err = subtotal.Sub(summary.Discount_total); err != nil {
+		return models.CartSummary{}, err
+	}
+	return summary, nil
+}
+
+// OrderTotal works out what a checked-out order costs from its lines and the
+// discounts, shipping charge and tax recorded on it, the way Quote did at
+// checkout. A free-shipping discount line already holds the shipping amount.
+func OrderTotal(order models.Orders, items []models.OrderProduct) (money.Money, error) {
+	total := money.Zero(order.TotalPrice.Currency)
+	var err error
+	for _, op := range items {
+		if total, err = total.Add(op.Price_update.Mul(op.Quantity)); err != nil {
+			return money.Money{}, err
+		}
+	}
+	for _, d := range order.Discounts {
+		if total, err = total.Sub(d.Amount); err != nil {
+			return money.Money{}, err
+		}
+	}
+	if order.Shipping != nil {
+		if total, err = total.Add(order.Shipping.Amount); err != nil {
+			return money.Money{}, err
+		}
+	}
+	if order.Tax != nil && !order.Tax_included {
+		if total, err = total.Add(*order.Tax); err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,166 @@
+package pricing
+
+import (
+	"errors"
+	"my-go-project/config"
+	"my-go-project/models"
+	"my-go-project/money"
+)
+
+// ErrNoShippingRate is returned when no shipping method ships to the
+// destination in the cart's currency, or the method asked for does not.
+var ErrNoShippingRate = errors.New("no shipping rate for destination")
+
+// Calculator prices carts for delivery with the configured shipping rates and
+// tax tables. Quotes and checkout both go through it, so a quote is what the
+// order will cost.
+type Calculator struct {
+	shipping config.ShippingConfig
+	tax      config.TaxConfig
+}
+
+func NewCalculator(shipping config.ShippingConfig, tax config.TaxConfig) *Calculator {
+	return &Calculator{shipping: shipping, tax: tax}
+}
+
+// Quote prices lines for delivery to dest by the shipping method named method,
+// or the cheapest one when it is empty, after the discounts of the coupon
+// code. A free-shipping discount line takes the shipping amount.
+func (c *Calculator) Quote(lines []models.CartLine, dest models.Address, method, code string, discounts []models.OrderDiscount) (models.Quote, error) {
+	summary, err := Summarize(lines, code, append([]models.OrderDiscount(nil), discounts...))
+	if err != nil {
+		return models.Quote{}, err
+	}
+	quote := models.Quote{
+		Ship_to:        dest,
+		Items:          summary.Items,
+		Subtotal:       summary.Subtotal,
+		Coupon_code:    summary.Coupon_code,
+		Discounts:      summary.Discounts,
+		Discount_total: summary.Discount_total,
+		Tax_total:      money.Zero(summary.Subtotal.Currency),
+	}
+	merchandise := summary.Total
+
+	quote.Shipping, err = c.shippingCharge(lines, dest, method, merchandise)
+	if err != nil {
+		return models.Quote{}, err
+	}
+	shipping := money.Zero(merchandise.Currency)
+	if quote.Shipping != nil {
+		shipping = quote.Shipping.Amount
+		for i, d := range quote.Discounts {
+			if d.Kind != models.CouponFreeShipping {
+				continue
+			}
+			quote.Discounts[i].Amount = shipping
+			if quote.Discount_total, err = quote.Discount_total.Add(shipping); err != nil {
+				return models.Quote{}, err
+			}
+			shipping = money.Zero(shipping.Currency)
+		}
+	}
+
+	taxable := merchandise
+	if c.tax.ShippingTaxable {
+		if taxable, err = taxable.Add(shipping); err != nil {
+			return models.Quote{}, err
+		}
+	}
+	if quote.Total, err = merchandise.Add(shipping); err != nil {
+		return models.Quote{}, err
+	}
+	for _, t := range c.taxLines(dest, taxable) {
+		quote.Taxes = append(quote.Taxes, t)
+		if quote.Tax_total, err = quote.Tax_total.Add(t.Amount); err != nil {
+			return models.Quote{}, err
+		}
+		if !t.Inclusive {
+			if quote.Total, err = quote.Total.Add(t.Amount); err != nil {
+				return models.Quote{}, err
+			}
+		}
+	}
+	return quote, nil
+}
+
+// shippingCharge picks the shipping method and prices it. It is nil when no
+// shipping rates are set up.
+func (c *Calculator) shippingCharge(lines []models.CartLine, dest models.Address, method string, merchandise money.Money) (*models.ShippingCharge, error) {
+	if len(c.shipping.Rates) == 0 {
+		return nil, nil
+	}
+	grams := 0
+	for _, l := range lines {
+		grams += l.Weight_grams * l.Quantity
+	}
+
+	var best *models.ShippingCharge
+	for _, r := range c.shipping.Rates {
+		if r.Currency != merchandise.Currency || !shipsTo(r, dest.Country) || (method != "" && r.Method != method) {
+			continue
+		}
+		charge := &models.ShippingCharge{Method: r.Method, Name: r.Name, Weight_grams: grams, Amount: ratePrice(r, grams, merchandise)}
+		if best == nil || charge.Amount.Amount < best.Amount.Amount {
+			best = charge
+		}
+	}
+	if best == nil {
+		return nil, ErrNoShippingRate
+	}
+	return best, nil
+}
+
+func shipsTo(r config.ShippingRate, country string) bool {
+	if len(r.Countries) == 0 {
+		return true
+	}
+	for _, c := range r.Countries {
+		if c == country {
+			return true
+		}
+	}
+	return false
+}
+
+// ratePrice prices a shipping rate for a parcel of grams holding merchandise.
+func ratePrice(r config.ShippingRate, grams int, merchandise money.Money) money.Money {
+	amount := r.Amount
+	switch r.Kind {
+	case "weight":
+		kilos := int64((grams + 999) / 1000)
+		amount += r.PerKg * kilos
+	case "free_over":
+		if merchandise.Amount >= r.Threshold {
+			amount = 0
+		}
+	}
+	return money.New(amount, r.Currency)
+}
+
+// taxLines works out the taxes of an order shipped to dest: every rate of its
+// country that is country-wide or for its region, each on the whole taxable
+// amount. Inclusive taxes are backed out of taxable, which already holds them.
+func (c *Calculator) taxLines(dest models.Address, taxable money.Money) []models.TaxLine {
+	var rates []config.TaxRate
+	var inclusive int64
+	for _, t := range c.tax.Rates {
+		if t.Country != dest.Country || (t.Region != "" && t.Region != dest.Region) {
+			continue
+		}
+		rates = append(rates, t)
+		if t.Inclusive {
+			inclusive += t.BasisPoints()
+		}
+	}
+
+	var lines []models.TaxLine
+	for _, t := range rates {
+		amount := taxable.MulFrac(t.BasisPoints(), 10000)
+		if t.Inclusive {
+			amount = taxable.MulFrac(t.BasisPoints(), 10000+inclusive)
+		}
+		lines = append(lines, models.TaxLine{Name: t.Name, Percent: t.Percent, Inclusive: t.Inclusive, Taxable: taxable, Amount: amount})
+	}
+	return lines
+}
@@ -0,0 +1,192 @@
+package pricing
+
+import (
+	"errors"
+	"my-go-project/config"
+	"my-go-project/models"
+	"my-go-project/money"
+	"testing"
+)
+
+var (
+	california = models.Address{Line1: "1 Main St", City: "Los Angeles", Region: "CA", Country: "US"}
+	berlin     = models.Address{Line1: "Hauptstr. 1", City: "Berlin", Country: "DE"}
+)
+
+func flatRate(method string, cents int64, countries ...string) config.ShippingRate {
+	return config.ShippingRate{Method: method, Name: method, Kind: "flat", Countries: countries, Currency: "USD", Amount: cents}
+}
+
+func weighed(productID int, cents int64, quantity, grams int) models.CartLine {
+	l := line(productID, cents, quantity)
+	l.Weight_grams = grams
+	return l
+}
+
+func freeShipping() []models.OrderDiscount {
+	return []models.OrderDiscount{{Code: "SHIP", Kind: models.CouponFreeShipping, Description: "Free shipping", Amount: usd(0)}}
+}
+
+func TestQuote(t *testing.T) {
+	salesTax := config.TaxRate{Name: "CA sales", Country: "US", Region: "CA", Percent: 10}
+	vat := config.TaxRate{Name: "VAT", Country: "DE", Percent: 19, Inclusive: true}
+
+	tests := []struct {
+		name      string
+		rates     config.ShippingConfig
+		taxes     config.TaxConfig
+		lines     []models.CartLine
+		dest      models.Address
+		method    string
+		discounts []models.OrderDiscount
+		// wantShipping is -1 when the quote has no shipping charge
+		wantShipping, wantTax, wantDiscounts, wantTotal int64
+	}{
+		{
+			name:         "exclusive tax on the goods only",
+			rates:        config.ShippingConfig{Rates: []config.ShippingRate{flatRate("standard", 500)}},
+			taxes:        config.TaxConfig{Rates: []config.TaxRate{salesTax}},
+			lines:        []models.CartLine{line(1, 1000, 1)},
+			dest:         california,
+			wantShipping: 500, wantTax: 100, wantTotal: 1600,
+		},
+		{
+			name:         "taxable shipping",
+			rates:        config.ShippingConfig{Rates: []config.ShippingRate{flatRate("standard", 500)}},
+			taxes:        config.TaxConfig{ShippingTaxable: true, Rates: []config.TaxRate{salesTax}},
+			lines:        []models.CartLine{line(1, 1000, 1)},
+			dest:         california,
+			wantShipping: 500, wantTax: 150, wantTotal: 1650,
+		},
+		{
+			name:  "inclusive tax backed out of the price",
+			rates: config.ShippingConfig{Rates: []config.ShippingRate{flatRate("standard", 500)}},
+			taxes: config.TaxConfig{Rates: []config.TaxRate{vat}},
+			lines: []models.CartLine{line(1, 11900, 1)},
+			dest:  berlin,
+			// 119.00 holds 19.00 of VAT, which is not added again
+			wantShipping: 500, wantTax: 1900, wantTotal: 12400,
+		},
+		{
+			name:         "inclusive tax on taxable shipping",
+			rates:        config.ShippingConfig{Rates: []config.ShippingRate{flatRate("standard", 1190)}},
+			taxes:        config.TaxConfig{ShippingTaxable: true, Rates: []config.TaxRate{vat}},
+			lines:        []models.CartLine{line(1, 11900, 1)},
+			dest:         berlin,
+			wantShipping: 1190, wantTax: 2090, wantTotal: 13090,
+		},
+		{
+			name:      "free shipping coupon zeroes the charge",
+			rates:     config.ShippingConfig{Rates: []config.ShippingRate{flatRate("standard", 500)}},
+			taxes:     config.TaxConfig{ShippingTaxable: true, Rates: []config.TaxRate{salesTax}},
+			lines:     []models.CartLine{line(1, 1000, 1)},
+			dest:      california,
+			discounts: freeShipping(),
+			// the discount line takes the 5.00, and no tax is due on it
+			wantShipping: 500, wantDiscounts: 500, wantTax: 100, wantTotal: 1100,
+		},
+		{
+			name:         "cheapest method when none is asked for",
+			rates:        config.ShippingConfig{Rates: []config.ShippingRate{flatRate("express", 1500), flatRate("standard", 500)}},
+			lines:        []models.CartLine{line(1, 1000, 1)},
+			dest:         california,
+			wantShipping: 500, wantTotal: 1500,
+		},
+		{
+			name:         "the method asked for",
+			rates:        config.ShippingConfig{Rates: []config.ShippingRate{flatRate("express", 1500), flatRate("standard", 500)}},
+			lines:        []models.CartLine{line(1, 1000, 1)},
+			dest:         california,
+			method:       "express",
+			wantShipping: 1500, wantTotal: 2500,
+		},
+		{
+			name: "free over the threshold",
+			rates: config.ShippingConfig{Rates: []config.ShippingRate{
+				{Method: "standard", Kind: "free_over", Currency: "USD", Amount: 500, Threshold: 5000},
+			}},
+			lines:        []models.CartLine{line(1, 2500, 2)},
+			dest:         california,
+			wantShipping: 0, wantTotal: 5000,
+		},
+		{
+			name:         "no shipping rates set up",
+			lines:        []models.CartLine{line(1, 1000, 1)},
+			dest:         california,
+			wantShipping: -1, wantTotal: 1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := NewCalculator(tt.rates, tt.taxes).Quote(tt.lines, tt.dest, tt.method, "", tt.discounts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantShipping < 0 {
+				if quote.Shipping != nil {
+					t.Errorf("shipping = %+v, want none", quote.Shipping)
+				}
+			} else if quote.Shipping == nil || quote.Shipping.Amount != usd(tt.wantShipping) {
+				t.Errorf("shipping = %+v, want %d", quote.Shipping, tt.wantShipping)
+			}
+			if quote.Tax_total != usd(tt.wantTax) {
+				t.Errorf("tax = %v, want %d", quote.Tax_total, tt.wantTax)
+			}
+			if quote.Discount_total != usd(tt.wantDiscounts) {
+				t.Errorf("discounts = %v, want %d", quote.Discount_total, tt.wantDiscounts)
+			}
+			if quote.Total != usd(tt.wantTotal) {
+				t.Errorf("total = %v, want %d", quote.Total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestQuoteWeightRoundsUpToWholeKilos(t *testing.T) {
+	calc := NewCalculator(config.ShippingConfig{Rates: []config.ShippingRate{
+		{Method: "parcel", Kind: "weight", Currency: "USD", Amount: 1000, PerKg: 200},
+	}}, config.TaxConfig{})
+
+	tests := []struct {
+		grams, quantity int
+		want            int64
+	}{
+		{0, 1, 1000},
+		{1, 1, 1200},
+		{1000, 1, 1200},
+		{1001, 1, 1400},
+		{400, 3, 1400}, // 1.2 kg across the line
+	}
+	for _, tt := range tests {
+		quote, err := calc.Quote([]models.CartLine{weighed(1, 1000, tt.quantity, tt.grams)}, california, "", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quote.Shipping.Amount != usd(tt.want) || quote.Shipping.Weight_grams != tt.grams*tt.quantity {
+			t.Errorf("%d x %dg: shipping = %+v, want %d", tt.quantity, tt.grams, quote.Shipping, tt.want)
+		}
+	}
+}
+
+func TestQuoteNoShippingRate(t *testing.T) {
+	calc := NewCalculator(config.ShippingConfig{Rates: []config.ShippingRate{flatRate("domestic", 500, "US")}}, config.TaxConfig{})
+
+	tests := []struct {
+		name   string
+		lines  []models.CartLine
+		dest   models.Address
+		method string
+	}{
+		{"destination not served", []models.CartLine{line(1, 1000, 1)}, berlin, ""},
+		{"unknown method", []models.CartLine{line(1, 1000, 1)}, california, "express"},
+		{"cart in another currency", []models.CartLine{{Product_id: 1, Unit_price: money.New(1000, "EUR"), Quantity: 1}}, california, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := calc.Quote(tt.lines, tt.dest, tt.method, "", nil)
+			if !errors.Is(err, ErrNoShippingRate) {
+				t.Fatalf("err = %v, want ErrNoShippingRate", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"errors"
+	"my-go-project/models"
+	"regexp"
+	"strings"
+)
+
+// ErrAddressRequired is returned when a cart is quoted or checked out without
+// a destination and the user has no complete address on file.
+var ErrAddressRequired = errors.New("shipping address required")
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// maxAddressField caps each address field, in characters.
+const maxAddressField = 200
+
+// NormalizeAddress trims every field of a, uppercases its country and region,
+// and reports whether the result is complete: Line1, City and an ISO 3166-1
+// alpha-2 Country are required.
+func NormalizeAddress(a models.Address) (models.Address, bool) {
+	fields := []*string{&a.Line1, &a.Line2, &a.City, &a.Region, &a.Postal_code, &a.Country}
+	for _, f := range fields {
+		*f = strings.TrimSpace(*f)
+		if len([]rune(*f)) > maxAddressField {
+			return a, false
+		}
+	}
+	a.Country, a.Region = strings.ToUpper(a.Country), strings.ToUpper(a.Region)
+	return a, a.Line1 != "" && a.City != "" && countryPattern.MatchString(a.Country)
+}
+
+// addressColumns are the users columns of models.Address, in field order.
+const addressColumns = `address_line1, address_line2, city, region, postal_code, country`
+
+// addressFields returns pointers to the fields of a, in addressColumns order.
+func addressFields(a *models.Address) []interface{} {
+	return []interface{}{&a.Line1, &a.Line2, &a.City, &a.Region, &a.Postal_code, &a.Country}
+}
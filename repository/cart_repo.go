@@ -0,0 +1,367 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+	"my-go-project/money"
+	"my-go-project/pricing"
+)
+
+// ***************************add cart*********************************
+// AddCart returns the user's cart, creating it the first time. Every user has
+// exactly one.
+func (r *UserRepository) AddCart(ctx context.Context, userID int) (models.Cart, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Cart{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.Cart{}, dbError(err)
+	}
+	return models.Cart{Cart_id: cartID, User_id: userID}, nil
+}
+
+// *********************add product in cart **********************************
+// AddCartProduct puts a product, or one of its variants, in the user's cart.
+// cp.Cart_id may be 0 for the user's cart. A product already in the cart gets
+// the quantity added to its line, and the line is returned. The line's total
+// quantity may not exceed the current stock of the product or variant, and a
+// product with variants needs one. Nothing is reserved yet; stock is only
+// taken at checkout.
+func (r *UserRepository) AddCartProduct(ctx context.Context, userID int, cp models.CartProduct) (models.CartProduct, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if cp.Cart_id != 0 && cp.Cart_id != cartID {
+		return models.CartProduct{}, ErrNotFound
+	}
+	cp, err = addCartLine(ctx, tx, cartID, cp)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+
+	log.Println("Product added to cart successfully")
+	return cp, nil
+}
+
+// ***************************update cart line*********************************
+// UpdateCartProduct sets the quantity of one of the user's cart lines, which
+// may not exceed the current stock.
+func (r *UserRepository) UpdateCartProduct(ctx context.Context, userID, cpID, quantity int) (models.CartProduct, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	cp, err := setCartLine(ctx, tx, cartID, cpID, quantity)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	return cp, nil
+}
+
+// ***************************remove cart line*********************************
+func (r *UserRepository) RemoveCartProduct(ctx context.Context, userID, cpID int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if err := removeCartLine(ctx, tx, cartID, cpID); err != nil {
+		return err
+	}
+	return dbError(tx.Commit(ctx))
+}
+
+// ***************************clear cart*********************************
+// ClearCart empties the user's cart and takes its coupon off.
+func (r *UserRepository) ClearCart(ctx context.Context, userID int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if err := clearCart(ctx, tx, cartID); err != nil {
+		return err
+	}
+	return dbError(tx.Commit(ctx))
+}
+
+// ***************************get cart *********************************
+// GetCart returns the user's cart with its lines priced at the current
+// catalog prices and the first picture of each product.
+func (r *UserRepository) GetCart(ctx context.Context, userID int) (models.CartView, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.CartView{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	cart, err := cartView(ctx, tx, cartID)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.CartView{}, dbError(err)
+	}
+	return cart, nil
+}
+
+// userCart returns the id of the user's cart, creating it the first time.
+func userCart(ctx context.Context, tx pgx.Tx, userID int) (int, error) {
+	var cartID int
+	err := tx.QueryRow(ctx, `SELECT cart_id FROM cart WHERE user_id = $1`, userID).Scan(&cartID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(ctx,
+			`INSERT INTO cart (user_id) VALUES ($1)
+			 ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+			 RETURNING cart_id`,
+			userID).Scan(&cartID)
+	}
+	if err != nil {
+		log.Println("Error provisioning cart:", err)
+		return 0, dbError(err)
+	}
+	return cartID, nil
+}
+
+// addCartLine adds cp to the cart, merging it into the line of the same
+// product and variant, and returns the line.
+func addCartLine(ctx context.Context, tx pgx.Tx, cartID int, cp models.CartProduct) (models.CartProduct, error) {
+	cp.Cart_id = cartID
+
+	var inCart int
+	err := tx.QueryRow(ctx,
+		`SELECT quantity FROM cart_product
+		 WHERE cart_id = $1 AND product_id = $2 AND COALESCE(variant_id, 0) = $3
+		 FOR UPDATE`,
+		cartID, cp.Product_id, cp.Variant_id).Scan(&inCart)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return models.CartProduct{}, dbError(err)
+	}
+	if err := checkCartStock(ctx, tx, cp.Product_id, cp.Variant_id, inCart+cp.Quantity); err != nil {
+		return models.CartProduct{}, err
+	}
+	if err := checkCartCurrency(ctx, tx, cartID, cp.Product_id); err != nil {
+		return models.CartProduct{}, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO cart_product (cart_id, product_id, variant_id, quantity)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (cart_id, product_id, COALESCE(variant_id, 0))
+		 DO UPDATE SET quantity = cart_product.quantity + EXCLUDED.quantity
+		 RETURNING cp_id, quantity`,
+		cartID, cp.Product_id, nullableID(cp.Variant_id), cp.Quantity,
+	).Scan(&cp.CP_id, &cp.Quantity)
+	if err != nil {
+		log.Println("Error inserting product into cart:", err)
+		return models.CartProduct{}, dbError(err)
+	}
+	return cp, nil
+}
+
+// setCartLine sets the quantity of a line of the cart. It is ErrNotFound when
+// the cart has no such line.
+func setCartLine(ctx context.Context, tx pgx.Tx, cartID, cpID, quantity int) (models.CartProduct, error) {
+	cp := models.CartProduct{CP_id: cpID, Cart_id: cartID, Quantity: quantity}
+	err := tx.QueryRow(ctx,
+		`SELECT product_id, COALESCE(variant_id, 0) FROM cart_product
+		 WHERE cp_id = $1 AND cart_id = $2
+		 FOR UPDATE`,
+		cpID, cartID).Scan(&cp.Product_id, &cp.Variant_id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CartProduct{}, ErrNotFound
+	}
+	if err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	if err := checkCartStock(ctx, tx, cp.Product_id, cp.Variant_id, quantity); err != nil {
+		return models.CartProduct{}, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE cart_product SET quantity = $2 WHERE cp_id = $1`, cpID, quantity); err != nil {
+		log.Println("Error updating cart line:", err)
+		return models.CartProduct{}, dbError(err)
+	}
+	return cp, nil
+}
+
+// removeCartLine deletes a line of the cart. It is ErrNotFound when the cart
+// has no such line.
+func removeCartLine(ctx context.Context, tx pgx.Tx, cartID, cpID int) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM cart_product WHERE cp_id = $1 AND cart_id = $2`, cpID, cartID)
+	if err != nil {
+		log.Println("Error removing cart line:", err)
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// clearCart deletes every line of the cart and takes its coupon off.
+func clearCart(ctx context.Context, tx pgx.Tx, cartID int) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM cart_product WHERE cart_id = $1`, cartID); err != nil {
+		log.Println("Error clearing cart:", err)
+		return dbError(err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE cart SET coupon_id = NULL WHERE cart_id = $1`, cartID); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+// cartView reads the cart with its lines priced at the current catalog prices
+// and the first picture of each product.
+func cartView(ctx context.Context, tx pgx.Tx, cartID int) (models.CartView, error) {
+	lines, _, err := cartLines(ctx, tx, cartID, false)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	summary, err := pricing.Summarize(lines, "", nil)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	cart := models.CartView{Cart_id: cartID, Items: summary.Items, Subtotal: summary.Subtotal}
+
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(k.code, '') FROM cart c LEFT JOIN coupons k ON k.coupon_id = c.coupon_id WHERE c.cart_id = $1`,
+		cartID).Scan(&cart.Coupon_code)
+	if err != nil {
+		return models.CartView{}, dbError(err)
+	}
+
+	productIDs := make([]int, len(lines))
+	for i, l := range lines {
+		productIDs[i] = l.Product_id
+	}
+	rows, err := tx.Query(ctx,
+		`SELECT DISTINCT ON (product_id) `+imageColumns+`
+		 FROM product_images WHERE product_id = ANY($1)
+		 ORDER BY product_id, position`,
+		uniqueIDs(productIDs))
+	if err != nil {
+		return models.CartView{}, dbError(err)
+	}
+	images, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ProductImage, error) {
+		return scanImage(row)
+	})
+	if err != nil {
+		return models.CartView{}, dbError(err)
+	}
+	setCartImages(cart.Items, images)
+	return cart, nil
+}
+
+// checkCartCurrency checks that a product is priced in the currency of the
+// cart, that of the products already in it.
+func checkCartCurrency(ctx context.Context, tx pgx.Tx, cartID, productID int) error {
+	var cartCurrency, currency string
+	err := tx.QueryRow(ctx,
+		`SELECT p.currency, np.currency
+		 FROM cart_product cp
+		 JOIN products p ON p.product_id = cp.product_id
+		 JOIN products np ON np.product_id = $2
+		 WHERE cp.cart_id = $1 AND p.currency <> np.currency
+		 LIMIT 1`,
+		cartID, productID).Scan(&cartCurrency, &currency)
+	if err == nil {
+		return fmt.Errorf("%w: the cart is priced in %s, the product in %s", money.ErrCurrencyMismatch, cartCurrency, currency)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return dbError(err)
+	}
+	return nil
+}
+
+// checkCartStock checks that quantity units of a product or variant are in
+// stock for a cart line.
+func checkCartStock(ctx context.Context, tx pgx.Tx, productID, variantID, quantity int) error {
+	stock, err := lineStock(ctx, tx, stockKey{productID, variantID}, false)
+	if errors.Is(err, ErrNotFound) {
+		return missingProduct("cart_product", productID)
+	}
+	if err != nil {
+		return dbError(err)
+	}
+	if stock < quantity {
+		return &InsufficientStockError{Product_id: productID, Variant_id: variantID, Requested: quantity, Available: stock}
+	}
+	return nil
+}
+
+// setCartImages gives each line the first image of its product, when there is
+// one.
+func setCartImages(lines []models.CartLine, images []models.ProductImage) {
+	first := map[int]models.ProductImage{}
+	for _, img := range images {
+		first[img.Product_id] = img
+	}
+	for i := range lines {
+		if img, ok := first[lines[i].Product_id]; ok {
+			lines[i].Image = &img
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"errors"
+	"my-go-project/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrCategoryCycle is returned when a category would become its own
+	// ancestor.
+	ErrCategoryCycle = errors.New("category cannot be moved under itself or its descendants")
+	// ErrUnknownCategory and ErrUnknownTag are returned when a product is
+	// linked to a slug that does not exist.
+	ErrUnknownCategory = errors.New("unknown category")
+	ErrUnknownTag      = errors.New("unknown tag")
+)
+
+// maxSlugLen caps category and tag slugs.
+const maxSlugLen = 100
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidSlug reports whether s is lowercase letters and digits in words joined
+// by single dashes, e.g. "running-shoes".
+func ValidSlug(s string) bool {
+	return len(s) <= maxSlugLen && slugPattern.MatchString(s)
+}
+
+// Slugify derives a slug from a display name: "Running Shoes & Boots" becomes
+// "running-shoes-boots". It returns "" when name has no letters or digits.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLen {
+		slug = strings.TrimRight(slug[:maxSlugLen], "-")
+	}
+	return slug
+}
+
+// CategoryTree nests a flat list of categories under their parents and returns
+// the children of parentID, 0 for the top level. Siblings keep the order of
+// categories.
+func CategoryTree(categories []models.Category, parentID int) []models.Category {
+	var children []models.Category
+	for _, c := range categories {
+		if c.Parent_id == parentID {
+			c.Children = CategoryTree(categories, c.Category_id)
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// uniqueSlugs sorts slugs and drops duplicates.
+func uniqueSlugs(slugs []string) []string {
+	out := append([]string{}, slugs...)
+	sort.Strings(out)
+	n := 0
+	for i, s := range out {
+		if i == 0 || s != out[n-1] {
+			out[n] = s
+			n++
+		}
+	}
+	return out[:n]
+}
@@ -0,0 +1,292 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+)
+
+const categoryColumns = `category_id, COALESCE(parent_id, 0), name, slug, create_at`
+
+func scanCategory(row pgx.Row) (models.Category, error) {
+	var c models.Category
+	err := row.Scan(&c.Category_id, &c.Parent_id, &c.Name, &c.Slug, &c.CreatedAt)
+	return c, err
+}
+
+// ***************************list categories*********************************
+// ListCategories returns every category, flat and ordered by name; use
+// CategoryTree to nest them.
+func (r *ProductRepository) ListCategories(ctx context.Context) ([]models.Category, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+categoryColumns+` FROM categories ORDER BY name, category_id`)
+	if err != nil {
+		log.Println("Error executing query:", err)
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return categories, nil
+}
+
+// ***************************get category*********************************
+func (r *ProductRepository) GetCategoryBySlug(ctx context.Context, slug string) (models.Category, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	c, err := scanCategory(r.db.QueryRow(ctx, `SELECT `+categoryColumns+` FROM categories WHERE slug = $1`, slug))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Category{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Category{}, dbError(err)
+	}
+	return c, nil
+}
+
+// ***************************create category*********************************
+func (r *ProductRepository) CreateCategory(ctx context.Context, c models.Category) (models.Category, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO categories (parent_id, name, slug) VALUES (NULLIF($1, 0), $2, $3)
+			  RETURNING category_id, create_at`
+	err := r.db.QueryRow(ctx, query, c.Parent_id, c.Name, c.Slug).Scan(&c.Category_id, &c.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting category:", err)
+		return models.Category{}, dbError(err)
+	}
+	return c, nil
+}
+
+// ***************************update category*********************************
+// UpdateCategory renames a category and may move it under another parent. It
+// fails with ErrCategoryCycle if the new parent is the category itself or one
+// of its descendants.
+func (r *ProductRepository) UpdateCategory(ctx context.Context, c models.Category) (models.Category, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Category{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if c.Parent_id != 0 {
+		// two concurrent moves could each pass the check below and still form
+		// a cycle together, so moves are serialized
+		if _, err := tx.Exec(ctx, `LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return models.Category{}, dbError(err)
+		}
+
+		var cycle bool
+		err := tx.QueryRow(ctx, `WITH RECURSIVE subtree AS (
+				SELECT category_id FROM categories WHERE category_id = $1
+				UNION ALL
+				SELECT c.category_id FROM categories c JOIN subtree s ON c.parent_id = s.category_id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE category_id = $2)`, c.Category_id, c.Parent_id).Scan(&cycle)
+		if err != nil {
+			return models.Category{}, dbError(err)
+		}
+		if cycle {
+			return models.Category{}, ErrCategoryCycle
+		}
+	}
+
+	updated, err := scanCategory(tx.QueryRow(ctx,
+		`UPDATE categories SET parent_id = NULLIF($1, 0), name = $2, slug = $3
+		 WHERE category_id = $4
+		 RETURNING `+categoryColumns,
+		c.Parent_id, c.Name, c.Slug, c.Category_id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Category{}, ErrNotFound
+	}
+	if err != nil {
+		log.Println("Error updating category:", err)
+		return models.Category{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Category{}, dbError(err)
+	}
+	return updated, nil
+}
+
+// ***************************delete category*********************************
+// DeleteCategory removes a category and its product links. A category that
+// still has children cannot be deleted.
+func (r *ProductRepository) DeleteCategory(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM categories WHERE category_id = $1`, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ***************************list tags*********************************
+func (r *ProductRepository) ListTags(ctx context.Context) ([]models.Tag, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT tag_id, name, slug FROM tags ORDER BY name, tag_id`)
+	if err != nil {
+		log.Println("Error executing query:", err)
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.Tag_id, &t.Name, &t.Slug); err != nil {
+			return nil, dbError(err)
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return tags, nil
+}
+
+// ***************************create tag*********************************
+func (r *ProductRepository) CreateTag(ctx context.Context, t models.Tag) (models.Tag, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := r.db.QueryRow(ctx, `INSERT INTO tags (name, slug) VALUES ($1, $2) RETURNING tag_id`, t.Name, t.Slug).Scan(&t.Tag_id)
+	if err != nil {
+		log.Println("Error inserting tag:", err)
+		return models.Tag{}, dbError(err)
+	}
+	return t, nil
+}
+
+// ***************************update tag*********************************
+func (r *ProductRepository) UpdateTag(ctx context.Context, t models.Tag) (models.Tag, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `UPDATE tags SET name = $1, slug = $2 WHERE tag_id = $3`, t.Name, t.Slug, t.Tag_id)
+	if err != nil {
+		log.Println("Error updating tag:", err)
+		return models.Tag{}, dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.Tag{}, ErrNotFound
+	}
+	return t, nil
+}
+
+// ***************************delete tag*********************************
+func (r *ProductRepository) DeleteTag(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM tags WHERE tag_id = $1`, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ***************************product categories and tags*********************************
+// SetProductCategories replaces the categories of a product with the ones
+// named by slugs and returns the slugs now linked, sorted. It fails with
+// ErrUnknownCategory, and changes nothing, if any slug does not exist.
+func (r *ProductRepository) SetProductCategories(ctx context.Context, productID int, slugs []string) ([]string, error) {
+	return r.setProductLinks(ctx, productID, slugs, productLinks{
+		lookup:  `SELECT category_id FROM categories WHERE slug = ANY($1)`,
+		clear:   `DELETE FROM product_categories WHERE product_id = $1`,
+		insert:  `INSERT INTO product_categories (product_id, category_id) SELECT $1, unnest($2::int[])`,
+		unknown: ErrUnknownCategory,
+	})
+}
+
+// SetProductTags is SetProductCategories for tags.
+func (r *ProductRepository) SetProductTags(ctx context.Context, productID int, slugs []string) ([]string, error) {
+	return r.setProductLinks(ctx, productID, slugs, productLinks{
+		lookup:  `SELECT tag_id FROM tags WHERE slug = ANY($1)`,
+		clear:   `DELETE FROM product_tags WHERE product_id = $1`,
+		insert:  `INSERT INTO product_tags (product_id, tag_id) SELECT $1, unnest($2::int[])`,
+		unknown: ErrUnknownTag,
+	})
+}
+
+// productLinks holds the queries for one of the product link tables.
+type productLinks struct {
+	lookup, clear, insert string
+	unknown               error
+}
+
+func (r *ProductRepository) setProductLinks(ctx context.Context, productID int, slugs []string, links productLinks) ([]string, error) {
+	slugs = uniqueSlugs(slugs)
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE product_id = $1)`, productID).Scan(&exists); err != nil {
+		return nil, dbError(err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	rows, err := tx.Query(ctx, links.lookup, slugs)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, dbError(err)
+	}
+	if len(ids) != len(slugs) {
+		return nil, links.unknown
+	}
+
+	if _, err := tx.Exec(ctx, links.clear, productID); err != nil {
+		return nil, dbError(err)
+	}
+	if _, err := tx.Exec(ctx, links.insert, productID, ids); err != nil {
+		log.Println("Error linking product:", err)
+		return nil, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, dbError(err)
+	}
+	return slugs, nil
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+	"time"
+)
+
+// ErrEmptyCart is returned by Checkout when the user's cart has no products.
+var ErrEmptyCart = errors.New("cart is empty")
+
+// ***************************quote*********************************
+// QuoteCart prices the user's cart for delivery as checkout would, without
+// placing an order.
+func (r *UserRepository) QuoteCart(ctx context.Context, userID int, d models.Delivery) (models.Quote, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Quote{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	quote, _, _, err := r.quoteCart(ctx, tx, userID, d, false)
+	return quote, err
+}
+
+// ***************************checkout*********************************
+// Checkout turns the user's cart into an order in one transaction: it locks the
+// cart lines, snapshots the current product or variant prices into order_product,
+// applies the coupon on the cart, prices shipping and tax for d, creates the
+// order, reserves the stock for it and empties the cart. Any failure, including
+// a product running out of stock, products priced in different currencies or a
+// coupon that no longer applies, rolls the whole checkout back.
+func (r *UserRepository) Checkout(ctx context.Context, userID int, d models.Delivery) (models.Checkout, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Checkout{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	quote, cartLineIDs, couponID, err := r.quoteCart(ctx, tx, userID, d, true)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+
+	items := make([]models.OrderProduct, len(quote.Items))
+	for i, l := range quote.Items {
+		items[i] = models.OrderProduct{Product_id: l.Product_id, Variant_id: l.Variant_id, Quantity: l.Quantity, Price_update: l.Unit_price, ProductName: l.Product_name}
+	}
+
+	order := orderFromQuote(quote)
+	order.User_id = userID
+	var shippingMethod, shippingName *string
+	var shippingAmount *int64
+	if order.Shipping != nil {
+		shippingMethod, shippingName, shippingAmount = &order.Shipping.Method, &order.Shipping.Name, &order.Shipping.Amount.Amount
+	}
+	a := order.Ship_to
+	err = tx.QueryRow(ctx,
+		`INSERT INTO orders (user_id, total_price, currency, status, coupon_id,
+		                     ship_line1, ship_line2, ship_city, ship_region, ship_postal_code, ship_country,
+		                     shipping_method, shipping_name, shipping_amount, tax_amount, tax_included)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		 RETURNING order_id, create_at`,
+		order.User_id, order.TotalPrice.Amount, order.TotalPrice.Currency, order.Status, nullableID(couponID),
+		a.Line1, a.Line2, a.City, a.Region, a.Postal_code, a.Country,
+		shippingMethod, shippingName, shippingAmount, order.Tax.Amount, order.Tax_included,
+	).Scan(&order.Order_id, &order.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting order:", err)
+		return models.Checkout{}, dbError(err)
+	}
+	if err := recordStatus(ctx, tx, order.Order_id, "", order.Status, userID, "checkout"); err != nil {
+		return models.Checkout{}, dbError(err)
+	}
+
+	for i := range items {
+		items[i].Order_id = order.Order_id
+		err := tx.QueryRow(ctx,
+			`INSERT INTO order_product (order_id, product_id, variant_id, quantity, price_update, currency, user_id)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)
+			 RETURNING op_id`,
+			order.Order_id, items[i].Product_id, nullableID(items[i].Variant_id), items[i].Quantity, items[i].Price_update.Amount, items[i].Price_update.Currency, userID,
+		).Scan(&items[i].OP_id)
+		if err != nil {
+			log.Println("Error inserting order_product:", err)
+			return models.Checkout{}, dbError(err)
+		}
+	}
+
+	for _, d := range quote.Discounts {
+		d.Order_id = order.Order_id
+		err := tx.QueryRow(ctx,
+			`INSERT INTO order_discounts (order_id, coupon_id, code, kind, product_id, description, amount, currency)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			 RETURNING discount_id`,
+			d.Order_id, d.Coupon_id, d.Code, d.Kind, nullableID(d.Product_id), d.Description, d.Amount.Amount, d.Amount.Currency,
+		).Scan(&d.Discount_id)
+		if err != nil {
+			log.Println("Error inserting order_discounts:", err)
+			return models.Checkout{}, dbError(err)
+		}
+		order.Discounts = append(order.Discounts, d)
+	}
+
+	if err := reserveStock(ctx, tx, order.Order_id, items, userID, time.Now().Add(r.inventory.HoldTTL)); err != nil {
+		if !errors.Is(err, ErrInsufficientStock) {
+			log.Println("Error reserving stock:", err)
+		}
+		return models.Checkout{}, dbError(err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM cart_product WHERE cp_id = ANY($1)`, cartLineIDs); err != nil {
+		log.Println("Error emptying cart:", err)
+		return models.Checkout{}, dbError(err)
+	}
+	if couponID != 0 {
+		if _, err := tx.Exec(ctx, `UPDATE cart SET coupon_id = NULL WHERE user_id = $1`, userID); err != nil {
+			return models.Checkout{}, dbError(err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Checkout{}, dbError(err)
+	}
+
+	log.Println("checkout completed, order:", order.Order_id)
+	return models.Checkout{Order: order, Items: items}, nil
+}
+
+// quoteCart prices the user's cart lines for d with the coupon on the cart. It
+// also returns the ids of the cart lines and the coupon's id, 0 without one.
+// lock takes the row locks checkout needs, the coupon's included so two
+// checkouts cannot both take its last use.
+func (r *UserRepository) quoteCart(ctx context.Context, tx pgx.Tx, userID int, d models.Delivery, lock bool) (models.Quote, []int, int, error) {
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return models.Quote{}, nil, 0, err
+	}
+	lines, cartLineIDs, err := cartLines(ctx, tx, cartID, lock)
+	if err != nil {
+		return models.Quote{}, nil, 0, err
+	}
+	if len(lines) == 0 {
+		return models.Quote{}, nil, 0, ErrEmptyCart
+	}
+
+	dest, err := shipTo(ctx, tx, userID, d)
+	if err != nil {
+		return models.Quote{}, nil, 0, err
+	}
+
+	var coupon models.Coupon
+	var discounts []models.OrderDiscount
+	var couponID int
+	err = tx.QueryRow(ctx, `SELECT coupon_id FROM cart WHERE cart_id = $1 AND coupon_id IS NOT NULL`, cartID).Scan(&couponID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return models.Quote{}, nil, 0, dbError(err)
+	}
+	if couponID != 0 {
+		if lock {
+			if _, err := tx.Exec(ctx, `SELECT 1 FROM coupons WHERE coupon_id = $1 FOR UPDATE`, couponID); err != nil {
+				return models.Quote{}, nil, 0, dbError(err)
+			}
+		}
+		coupon, err = scanCoupon(tx.QueryRow(ctx, `SELECT `+couponColumns+` FROM coupons c WHERE c.coupon_id = $1`, couponID))
+		if err != nil {
+			return models.Quote{}, nil, 0, dbError(err)
+		}
+		if discounts, err = couponDiscounts(ctx, tx, coupon, userID, lines); err != nil {
+			return models.Quote{}, nil, 0, err
+		}
+	}
+
+	quote, err := r.pricing.Quote(lines, dest, d.Shipping_method, coupon.Code, discounts)
+	if err != nil {
+		return models.Quote{}, nil, 0, err
+	}
+	return quote, cartLineIDs, couponID, nil
+}
+
+// shipTo returns d's destination, or the user's own address when d has none.
+// It is ErrAddressRequired when the user's address is incomplete.
+func shipTo(ctx context.Context, tx pgx.Tx, userID int, d models.Delivery) (models.Address, error) {
+	if d.Ship_to != nil {
+		return *d.Ship_to, nil
+	}
+	var a models.Address
+	err := tx.QueryRow(ctx, `SELECT `+addressColumns+` FROM users WHERE user_id = $1`, userID).Scan(addressFields(&a)...)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return models.Address{}, dbError(err)
+	}
+	a, ok := NormalizeAddress(a)
+	if !ok {
+		return models.Address{}, ErrAddressRequired
+	}
+	return a, nil
+}
+
+// orderFromQuote is the pending order a checkout of quote creates.
+func orderFromQuote(quote models.Quote) models.Orders {
+	tax := quote.Tax_total
+	order := models.Orders{
+		TotalPrice: quote.Total,
+		Status:     models.OrderPending,
+		Ship_to:    &quote.Ship_to,
+		Tax:        &tax,
+	}
+	if quote.Shipping != nil {
+		shipping := *quote.Shipping
+		shipping.Weight_grams = 0
+		order.Shipping = &shipping
+	}
+	for _, t := range quote.Taxes {
+		order.Tax_included = order.Tax_included || t.Inclusive
+	}
+	return order
+}
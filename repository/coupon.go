@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownProduct is returned when a coupon is limited to a product that
+// does not exist.
+var ErrUnknownProduct = errors.New("unknown product")
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// NormalizeCouponCode trims and uppercases code, so codes match whatever case
+// customers type them in, and reports whether the result is a valid code: 3
+// to 32 letters, digits, dashes or underscores.
+func NormalizeCouponCode(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return code, couponCodePattern.MatchString(code)
+}
+
+// uniqueIDs sorts ids and drops duplicates.
+func uniqueIDs(ids []int) []int {
+	out := append([]int{}, ids...)
+	sort.Ints(out)
+	n := 0
+	for i, id := range out {
+		if i == 0 || id != out[n-1] {
+			out[n] = id
+			n++
+		}
+	}
+	return out[:n]
+}
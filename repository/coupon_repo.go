@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+	"my-go-project/money"
+	"my-go-project/pricing"
+	"time"
+)
+
+const couponColumns = `c.coupon_id, c.code, c.kind, c.percent, c.amount, c.min_order_amount, c.currency,
+	c.buy_quantity, c.get_quantity, c.starts_at, c.ends_at, c.max_uses, c.max_uses_per_user, c.create_at,
+	ARRAY(SELECT cp.product_id FROM coupon_products cp WHERE cp.coupon_id = c.coupon_id ORDER BY cp.product_id),
+	ARRAY(SELECT cat.slug FROM coupon_categories cc JOIN categories cat ON cat.category_id = cc.category_id
+	      WHERE cc.coupon_id = c.coupon_id ORDER BY cat.slug),
+	(SELECT count(*) FROM orders o WHERE o.coupon_id = c.coupon_id AND o.status <> 'cancelled')`
+
+func scanCoupon(row pgx.Row) (models.Coupon, error) {
+	var c models.Coupon
+	var amount, minOrder *int64
+	var currency *string
+	err := row.Scan(&c.Coupon_id, &c.Code, &c.Kind, &c.Percent, &amount, &minOrder, &currency,
+		&c.Buy_quantity, &c.Get_quantity, &c.Starts_at, &c.Ends_at, &c.Max_uses, &c.Max_uses_per_user, &c.CreatedAt,
+		&c.Product_ids, &c.Categories, &c.Times_used)
+	if currency != nil && amount != nil {
+		c.Amount = &money.Money{Amount: *amount, Currency: *currency}
+	}
+	if currency != nil && minOrder != nil {
+		c.Min_order = &money.Money{Amount: *minOrder, Currency: *currency}
+	}
+	return c, err
+}
+
+// couponMoney splits a coupon's amounts into their columns. Both amounts are
+// in the one currency column, NULL when neither is set.
+func couponMoney(c models.Coupon) (amount, minOrder *int64, currency *string) {
+	if c.Amount != nil {
+		amount, currency = &c.Amount.Amount, &c.Amount.Currency
+	}
+	if c.Min_order != nil {
+		minOrder, currency = &c.Min_order.Amount, &c.Min_order.Currency
+	}
+	return amount, minOrder, currency
+}
+
+// ***************************list coupons*********************************
+func (r *UserRepository) ListCoupons(ctx context.Context, page PageRequest) (models.Page[models.Coupon], error) {
+	after, _, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.Coupon]{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT count(*) FROM coupons`).Scan(&total); err != nil {
+		log.Println("Error counting coupons:", err)
+		return models.Page[models.Coupon]{}, dbError(err)
+	}
+
+	limit := page.limit()
+	rows, err := r.db.Query(ctx,
+		`SELECT `+couponColumns+` FROM coupons c WHERE c.coupon_id > $1 ORDER BY c.coupon_id LIMIT $2`,
+		after.ID, limit+1)
+	if err != nil {
+		log.Println("Error executing query:", err)
+		return models.Page[models.Coupon]{}, dbError(err)
+	}
+	defer rows.Close()
+
+	var coupons []models.Coupon
+	var keys []cursor
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return models.Page[models.Coupon]{}, dbError(err)
+		}
+		coupons = append(coupons, c)
+		keys = append(keys, cursor{ID: c.Coupon_id})
+	}
+	if err := rows.Err(); err != nil {
+		return models.Page[models.Coupon]{}, dbError(err)
+	}
+	return newPage(coupons, keys, limit, total), nil
+}
+
+// ***************************get coupon*********************************
+func (r *UserRepository) GetCoupon(ctx context.Context, id int) (models.Coupon, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	c, err := scanCoupon(r.db.QueryRow(ctx, `SELECT `+couponColumns+` FROM coupons c WHERE c.coupon_id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Coupon{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	return c, nil
+}
+
+// ***************************create coupon*********************************
+// CreateCoupon adds a coupon and links it to its products and categories. It
+// returns ErrUnknownProduct or ErrUnknownCategory for a link to nothing, and
+// ErrConflict if the code is taken.
+func (r *UserRepository) CreateCoupon(ctx context.Context, c models.Coupon) (models.Coupon, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	amount, minOrder, currency := couponMoney(c)
+	var id int
+	err = tx.QueryRow(ctx,
+		`INSERT INTO coupons (code, kind, percent, amount, min_order_amount, currency, buy_quantity, get_quantity,
+		                      starts_at, ends_at, max_uses, max_uses_per_user)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		 RETURNING coupon_id`,
+		c.Code, c.Kind, c.Percent, amount, minOrder, currency, c.Buy_quantity, c.Get_quantity,
+		c.Starts_at, c.Ends_at, c.Max_uses, c.Max_uses_per_user,
+	).Scan(&id)
+	if err != nil {
+		log.Println("Error inserting coupon:", err)
+		return models.Coupon{}, dbError(err)
+	}
+
+	created, err := setCouponLinks(ctx, tx, id, c.Product_ids, c.Categories)
+	if err != nil {
+		return models.Coupon{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	return created, nil
+}
+
+// ***************************update coupon*********************************
+// UpdateCoupon replaces every setting of a coupon, its links included. Orders
+// that already used it keep the discounts they got.
+func (r *UserRepository) UpdateCoupon(ctx context.Context, c models.Coupon) (models.Coupon, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	amount, minOrder, currency := couponMoney(c)
+	tag, err := tx.Exec(ctx,
+		`UPDATE coupons SET code = $2, kind = $3, percent = $4, amount = $5, min_order_amount = $6, currency = $7,
+		        buy_quantity = $8, get_quantity = $9, starts_at = $10, ends_at = $11, max_uses = $12, max_uses_per_user = $13
+		 WHERE coupon_id = $1`,
+		c.Coupon_id, c.Code, c.Kind, c.Percent, amount, minOrder, currency, c.Buy_quantity, c.Get_quantity,
+		c.Starts_at, c.Ends_at, c.Max_uses, c.Max_uses_per_user)
+	if err != nil {
+		log.Println("Error updating coupon:", err)
+		return models.Coupon{}, dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.Coupon{}, ErrNotFound
+	}
+
+	updated, err := setCouponLinks(ctx, tx, c.Coupon_id, c.Product_ids, c.Categories)
+	if err != nil {
+		return models.Coupon{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	return updated, nil
+}
+
+// setCouponLinks replaces the products and categories a coupon is limited to
+// and returns the coupon as stored.
+func setCouponLinks(ctx context.Context, tx pgx.Tx, couponID int, productIDs []int, slugs []string) (models.Coupon, error) {
+	productIDs, slugs = uniqueIDs(productIDs), uniqueSlugs(slugs)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM coupon_products WHERE coupon_id = $1`, couponID); err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM coupon_categories WHERE coupon_id = $1`, couponID); err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+
+	if len(productIDs) > 0 {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO coupon_products (coupon_id, product_id)
+			 SELECT $1, product_id FROM products WHERE product_id = ANY($2)`,
+			couponID, productIDs)
+		if err != nil {
+			return models.Coupon{}, dbError(err)
+		}
+		if int(tag.RowsAffected()) != len(productIDs) {
+			return models.Coupon{}, ErrUnknownProduct
+		}
+	}
+	if len(slugs) > 0 {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO coupon_categories (coupon_id, category_id)
+			 SELECT $1, category_id FROM categories WHERE slug = ANY($2)`,
+			couponID, slugs)
+		if err != nil {
+			return models.Coupon{}, dbError(err)
+		}
+		if int(tag.RowsAffected()) != len(slugs) {
+			return models.Coupon{}, ErrUnknownCategory
+		}
+	}
+
+	c, err := scanCoupon(tx.QueryRow(ctx, `SELECT `+couponColumns+` FROM coupons c WHERE c.coupon_id = $1`, couponID))
+	if err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	return c, nil
+}
+
+// ***************************delete coupon*********************************
+// DeleteCoupon removes a coupon and takes it off the carts it was applied to.
+// Orders that used it keep their discount lines.
+func (r *UserRepository) DeleteCoupon(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM coupons WHERE coupon_id = $1`, id)
+	if err != nil {
+		log.Println("Error deleting coupon:", err)
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ***************************apply coupon to cart*********************************
+// ApplyCartCoupon checks that the coupon with code can be used on the user's
+// cart and keeps it there until checkout. It returns the cart priced with the
+// discounts, ErrNotFound for an unknown code, ErrEmptyCart, or a
+// *pricing.CouponError saying why the coupon does not apply.
+func (r *UserRepository) ApplyCartCoupon(ctx context.Context, userID int, code string) (models.CartSummary, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.CartSummary{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	c, err := scanCoupon(tx.QueryRow(ctx, `SELECT `+couponColumns+` FROM coupons c WHERE c.code = $1`, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CartSummary{}, ErrNotFound
+	}
+	if err != nil {
+		return models.CartSummary{}, dbError(err)
+	}
+
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return models.CartSummary{}, err
+	}
+	lines, _, err := cartLines(ctx, tx, cartID, false)
+	if err != nil {
+		return models.CartSummary{}, err
+	}
+	if len(lines) == 0 {
+		return models.CartSummary{}, ErrEmptyCart
+	}
+	discounts, err := couponDiscounts(ctx, tx, c, userID, lines)
+	if err != nil {
+		return models.CartSummary{}, err
+	}
+	summary, err := pricing.Summarize(lines, c.Code, discounts)
+	if err != nil {
+		return models.CartSummary{}, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE cart SET coupon_id = $1 WHERE cart_id = $2`, c.Coupon_id, cartID); err != nil {
+		log.Println("Error applying coupon:", err)
+		return models.CartSummary{}, dbError(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.CartSummary{}, dbError(err)
+	}
+	return summary, nil
+}
+
+// ***************************remove coupon from cart*********************************
+func (r *UserRepository) RemoveCartCoupon(ctx context.Context, userID int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.db.Exec(ctx, `UPDATE cart SET coupon_id = NULL WHERE user_id = $1`, userID)
+	return dbError(err)
+}
+
+// cartLines reads the cart's lines, priced at the current product or
+// variant price, and the ids of their cart_product rows. lock takes row locks
+// on the lines for checkout.
+func cartLines(ctx context.Context, tx pgx.Tx, cartID int, lock bool) ([]models.CartLine, []int, error) {
+	query := `SELECT cp.cp_id, cp.product_id, COALESCE(cp.variant_id, 0), cp.quantity, COALESCE(v.price, p.price), p.currency, p.product_name,
+			         COALESCE(NULLIF(v.img_url, ''), p.img_url), p.weight_grams
+			  FROM cart_product cp
+			  JOIN products p ON p.product_id = cp.product_id
+			  LEFT JOIN product_variants v ON v.variant_id = cp.variant_id
+			  WHERE cp.cart_id = $1
+			  ORDER BY cp.cp_id`
+	if lock {
+		query += ` FOR UPDATE OF cp`
+	}
+	rows, err := tx.Query(ctx, query, cartID)
+	if err != nil {
+		log.Println("Error reading cart:", err)
+		return nil, nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var lines []models.CartLine
+	var ids []int
+	for rows.Next() {
+		var l models.CartLine
+		if err := rows.Scan(&l.CP_id, &l.Product_id, &l.Variant_id, &l.Quantity, &l.Unit_price.Amount, &l.Unit_price.Currency, &l.Product_name, &l.Img_url, &l.Weight_grams); err != nil {
+			return nil, nil, dbError(err)
+		}
+		lines = append(lines, l)
+		ids = append(ids, l.CP_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, dbError(err)
+	}
+	return lines, ids, nil
+}
+
+// couponDiscounts checks that c can be used by userID on lines and works out
+// the discounts it gives.
+func couponDiscounts(ctx context.Context, tx pgx.Tx, c models.Coupon, userID int, lines []models.CartLine) ([]models.OrderDiscount, error) {
+	subtotal, err := pricing.Subtotal(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage pricing.Usage
+	err = tx.QueryRow(ctx,
+		`SELECT count(*), count(*) FILTER (WHERE user_id = $2)
+		 FROM orders WHERE coupon_id = $1 AND status <> 'cancelled'`,
+		c.Coupon_id, userID).Scan(&usage.Total, &usage.ByUser)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	if err := pricing.CheckCoupon(c, time.Now(), subtotal, usage); err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]int, len(lines))
+	for i, l := range lines {
+		productIDs[i] = l.Product_id
+	}
+	rows, err := tx.Query(ctx,
+		`SELECT p.product_id FROM products p
+		 WHERE p.product_id = ANY($2) AND (
+		       NOT EXISTS (SELECT 1 FROM coupon_products WHERE coupon_id = $1)
+		   AND NOT EXISTS (SELECT 1 FROM coupon_categories WHERE coupon_id = $1)
+		    OR p.product_id IN (SELECT product_id FROM coupon_products WHERE coupon_id = $1)
+		    OR p.product_id IN (
+		       SELECT pc.product_id FROM product_categories pc
+		       WHERE pc.category_id IN (
+		           WITH RECURSIVE subtree AS (
+		               SELECT category_id FROM coupon_categories WHERE coupon_id = $1
+		               UNION ALL
+		               SELECT cat.category_id FROM categories cat JOIN subtree s ON cat.parent_id = s.category_id
+		           )
+		           SELECT category_id FROM subtree)))`,
+		c.Coupon_id, productIDs)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, dbError(err)
+	}
+	eligible := map[int]bool{}
+	for _, id := range ids {
+		eligible[id] = true
+	}
+
+	return pricing.Discounts(c, lines, func(productID int) bool { return eligible[productID] })
+}
+
+// orderDiscounts loads the discount lines of an order.
+func (r *UserRepository) orderDiscounts(ctx context.Context, orderID int) ([]models.OrderDiscount, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT discount_id, order_id, COALESCE(coupon_id, 0), code, kind, COALESCE(product_id, 0), description, amount, currency
+		 FROM order_discounts WHERE order_id = $1 ORDER BY discount_id`,
+		orderID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.OrderDiscount, error) {
+		var d models.OrderDiscount
+		err := row.Scan(&d.Discount_id, &d.Order_id, &d.Coupon_id, &d.Code, &d.Kind, &d.Product_id, &d.Description, &d.Amount.Amount, &d.Amount.Currency)
+		return d, err
+	})
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"my-go-project/money"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when a query runs past its deadline.
+	ErrTimeout = errors.New("database query timed out")
+	// ErrNotFound is returned when a lookup by id matches no row.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write breaks a unique constraint.
+	ErrConflict = errors.New("conflict")
+	// ErrForeignKeyViolation is returned when a write references a missing row,
+	// or a delete would orphan one.
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	// ErrValidation is returned when the database rejects a value, e.g. a
+	// CHECK or NOT NULL constraint.
+	ErrValidation = errors.New("validation failed")
+	// ErrInvalidCredentials is returned by LoginUser for an unknown email or a
+	// wrong password; callers should not be able to tell the two apart.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+// ConstraintError is a write rejected by a database constraint. Kind is one of
+// ErrConflict, ErrForeignKeyViolation, ErrValidation or
+// money.ErrCurrencyMismatch, so errors.Is matches both the kind and the
+// underlying driver error.
+type ConstraintError struct {
+	Kind       error
+	Constraint string
+	Column     string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Constraint != "" {
+		return fmt.Sprintf("%v: %s: %v", e.Kind, e.Constraint, e.Err)
+	}
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *ConstraintError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// withTimeout bounds a single repository call by the configured query timeout,
+// on top of whatever deadline the caller's context already carries.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dbError marks deadline failures with ErrTimeout and constraint violations
+// with a ConstraintError, and leaves other errors as is.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if kind := constraintKind(pgErr.Code); kind != nil {
+			if currencyConstraints[pgErr.ConstraintName] {
+				kind = money.ErrCurrencyMismatch
+			}
+			return &ConstraintError{Kind: kind, Constraint: pgErr.ConstraintName, Column: pgErr.ColumnName, Err: err}
+		}
+	}
+	return err
+}
+
+// currencyConstraints are the composite foreign keys that keep a variant price
+// in its product's currency and order lines, discounts and payments in their
+// order's.
+var currencyConstraints = map[string]bool{
+	"product_variants_currency_fkey": true,
+	"order_product_currency_fkey":    true,
+	"payments_currency_fkey":         true,
+	"order_discounts_currency_fkey":  true,
+}
+
+// constraintKind maps a Postgres SQLSTATE to one of the constraint sentinels.
+func constraintKind(code string) error {
+	switch code {
+	case "23505": // unique_violation
+		return ErrConflict
+	case "23503": // foreign_key_violation
+		return ErrForeignKeyViolation
+	case "23502", "23514", "22P02", "22001", "22003": // not_null, check, bad text representation, string too long, out of range
+		return ErrValidation
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+	"my-go-project/money"
+	"time"
+)
+
+// ***************************start guest cart*********************************
+// StartGuestCart opens a cart for an anonymous visitor. It lives for the
+// configured guest cart TTL and is opened with the signed guest token it
+// returns.
+func (r *UserRepository) StartGuestCart(ctx context.Context) (models.GuestCart, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	guestID, err := randomToken(16)
+	if err != nil {
+		return models.GuestCart{}, err
+	}
+	cart := models.GuestCart{Guest_id: guestID, Expires_at: time.Now().Add(r.guest.TTL)}
+	err = r.db.QueryRow(ctx,
+		`INSERT INTO cart (guest_id, expires_at) VALUES ($1, $2) RETURNING cart_id`,
+		guestID, cart.Expires_at).Scan(&cart.Cart_id)
+	if err != nil {
+		log.Println("Error inserting guest cart:", err)
+		return models.GuestCart{}, dbError(err)
+	}
+
+	if cart.Guest_token, err = signGuestToken(guestID, r.signer, cart.Expires_at); err != nil {
+		return models.GuestCart{}, err
+	}
+	return cart, nil
+}
+
+// ***************************get guest cart*********************************
+// GetGuestCart returns the guest cart like GetCart. It is ErrNotFound once the
+// cart has expired or been merged.
+func (r *UserRepository) GetGuestCart(ctx context.Context, guestID string) (models.CartView, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.CartView{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := guestCart(ctx, tx, guestID, false)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	return cartView(ctx, tx, cartID)
+}
+
+// ***************************add product in guest cart*********************************
+// AddGuestCartProduct is AddCartProduct for a guest cart.
+func (r *UserRepository) AddGuestCartProduct(ctx context.Context, guestID string, cp models.CartProduct) (models.CartProduct, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := guestCart(ctx, tx, guestID, false)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if cp.Cart_id != 0 && cp.Cart_id != cartID {
+		return models.CartProduct{}, ErrNotFound
+	}
+	cp, err = addCartLine(ctx, tx, cartID, cp)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	return cp, nil
+}
+
+// ***************************update guest cart line*********************************
+func (r *UserRepository) UpdateGuestCartProduct(ctx context.Context, guestID string, cpID, quantity int) (models.CartProduct, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := guestCart(ctx, tx, guestID, false)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	cp, err := setCartLine(ctx, tx, cartID, cpID, quantity)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+	return cp, nil
+}
+
+// ***************************remove guest cart line*********************************
+func (r *UserRepository) RemoveGuestCartProduct(ctx context.Context, guestID string, cpID int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := guestCart(ctx, tx, guestID, false)
+	if err != nil {
+		return err
+	}
+	if err := removeCartLine(ctx, tx, cartID, cpID); err != nil {
+		return err
+	}
+	return dbError(tx.Commit(ctx))
+}
+
+// ***************************clear guest cart*********************************
+func (r *UserRepository) ClearGuestCart(ctx context.Context, guestID string) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	cartID, err := guestCart(ctx, tx, guestID, false)
+	if err != nil {
+		return err
+	}
+	if err := clearCart(ctx, tx, cartID); err != nil {
+		return err
+	}
+	return dbError(tx.Commit(ctx))
+}
+
+// ***************************merge guest cart*********************************
+// MergeGuestCart moves the guest cart's lines into the user's cart and deletes
+// the guest cart. A product already in the user's cart gets the quantity the
+// configured merge rule gives; only what the guest cart adds is capped at the
+// stock on hand, so the user's own line is never lowered. Lines that can no
+// longer be bought, or are priced in another currency than the user's cart,
+// are dropped. It is ErrNotFound when the guest cart has expired or was
+// already merged.
+func (r *UserRepository) MergeGuestCart(ctx context.Context, guestID string, userID int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	guestCartID, err := guestCart(ctx, tx, guestID, true)
+	if err != nil {
+		return err
+	}
+	cartID, err := userCart(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT product_id, COALESCE(variant_id, 0), quantity FROM cart_product WHERE cart_id = $1 ORDER BY cp_id`,
+		guestCartID)
+	if err != nil {
+		return dbError(err)
+	}
+	lines, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.CartProduct, error) {
+		var cp models.CartProduct
+		err := row.Scan(&cp.Product_id, &cp.Variant_id, &cp.Quantity)
+		return cp, err
+	})
+	if err != nil {
+		return dbError(err)
+	}
+
+	merged := 0
+	for _, l := range lines {
+		var inCart int
+		err := tx.QueryRow(ctx,
+			`SELECT quantity FROM cart_product
+			 WHERE cart_id = $1 AND product_id = $2 AND COALESCE(variant_id, 0) = $3
+			 FOR UPDATE`,
+			cartID, l.Product_id, l.Variant_id).Scan(&inCart)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return dbError(err)
+		}
+
+		stock, err := lineStock(ctx, tx, stockKey{l.Product_id, l.Variant_id}, false)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnknownVariant) || errors.Is(err, ErrVariantRequired) {
+			continue
+		}
+		if err != nil {
+			return dbError(err)
+		}
+		quantity := mergeQuantity(r.guest.Merge, inCart, l.Quantity, stock)
+		if quantity <= 0 || quantity == inCart {
+			continue
+		}
+		if inCart == 0 {
+			err := checkCartCurrency(ctx, tx, cartID, l.Product_id)
+			if errors.Is(err, money.ErrCurrencyMismatch) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO cart_product (cart_id, product_id, variant_id, quantity)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (cart_id, product_id, COALESCE(variant_id, 0))
+			 DO UPDATE SET quantity = EXCLUDED.quantity`,
+			cartID, l.Product_id, nullableID(l.Variant_id), quantity)
+		if err != nil {
+			log.Println("Error merging guest cart line:", err)
+			return dbError(err)
+		}
+		merged++
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM cart WHERE cart_id = $1`, guestCartID); err != nil {
+		return dbError(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return dbError(err)
+	}
+	log.Printf("guest cart merged into cart %d: %d of %d lines", cartID, merged, len(lines))
+	return nil
+}
+
+// ***************************expire guest carts*********************************
+// ExpireGuestCarts deletes the guest carts whose time has run out and returns
+// how many there were.
+func (r *UserRepository) ExpireGuestCarts(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM cart WHERE guest_id IS NOT NULL AND expires_at <= now()`)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// guestCart returns the id of the unexpired guest cart guestID, or
+// ErrNotFound. lock locks the cart row.
+func guestCart(ctx context.Context, tx pgx.Tx, guestID string, lock bool) (int, error) {
+	query := `SELECT cart_id FROM cart WHERE guest_id = $1 AND expires_at > now()`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	var cartID int
+	err := tx.QueryRow(ctx, query, guestID).Scan(&cartID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return cartID, nil
+}
+
+// mergeQuantity is the quantity of a product that is inCart in the user's
+// cart and guest in the guest cart after a merge by rule. A merge that adds
+// to the user's line adds no more than stock allows, but never takes away
+// what the user already had.
+func mergeQuantity(rule string, inCart, guest, stock int) int {
+	var quantity int
+	switch rule {
+	case "max":
+		quantity = inCart
+		if guest > inCart {
+			quantity = guest
+		}
+	case "user":
+		quantity = inCart
+		if inCart == 0 {
+			quantity = guest
+		}
+	case "guest":
+		quantity = guest
+	default:
+		quantity = inCart + guest
+	}
+	if quantity > inCart && quantity > stock {
+		quantity = stock
+		if quantity < inCart {
+			quantity = inCart
+		}
+	}
+	return quantity
+}
@@ -0,0 +1,35 @@
+package repository
+
+import "testing"
+
+func TestMergeQuantity(t *testing.T) {
+	tests := []struct {
+		name                 string
+		rule                 string
+		inCart, guest, stock int
+		want                 int
+	}{
+		{"sum", "sum", 2, 3, 10, 5},
+		{"sum capped at stock", "sum", 2, 3, 4, 4},
+		{"sum over a line already above stock", "sum", 5, 3, 4, 5},
+		{"max takes the guest's", "max", 2, 3, 10, 3},
+		{"max keeps the user's", "max", 3, 2, 10, 3},
+		{"max keeps the user's above stock", "max", 5, 2, 4, 5},
+		{"max capped at stock", "max", 2, 6, 4, 4},
+		{"user keeps the user's", "user", 2, 3, 10, 2},
+		{"user keeps the user's above stock", "user", 5, 3, 4, 5},
+		{"user takes the guest's when new", "user", 0, 3, 10, 3},
+		{"user capped at stock when new", "user", 0, 6, 4, 4},
+		{"guest takes the guest's", "guest", 5, 3, 10, 3},
+		{"guest capped at stock", "guest", 2, 6, 4, 4},
+		{"guest never lowered by the cap", "guest", 5, 6, 4, 5},
+		{"nothing in stock", "sum", 0, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeQuantity(tt.rule, tt.inCart, tt.guest, tt.stock); got != tt.want {
+				t.Fatalf("mergeQuantity(%s, %d, %d, %d) = %d, want %d", tt.rule, tt.inCart, tt.guest, tt.stock, got, tt.want)
+			}
+		})
+	}
+}
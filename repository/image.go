@@ -0,0 +1,21 @@
+package repository
+
+import "errors"
+
+// ErrTooManyImages is returned when a product's gallery is already full.
+var ErrTooManyImages = errors.New("product has too many images")
+
+// MaxProductImages is the size of a product's gallery.
+const MaxProductImages = 20
+
+// clampPosition keeps a requested gallery position within 0..n-1, so a
+// position past the end moves the image to the end.
+func clampPosition(position, n int) int {
+	if position < 0 {
+		return 0
+	}
+	if position > n-1 {
+		return n - 1
+	}
+	return position
+}
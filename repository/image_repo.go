@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+)
+
+const imageColumns = `image_id, product_id, position, alt_text, content_type, width, height, size_bytes,
+	original_key, thumb_key, medium_key, create_at`
+
+func scanImage(row pgx.Row) (models.ProductImage, error) {
+	var img models.ProductImage
+	err := row.Scan(&img.Image_id, &img.Product_id, &img.Position, &img.Alt_text, &img.Content_type,
+		&img.Width, &img.Height, &img.Size, &img.Original_key, &img.Thumb_key, &img.Medium_key, &img.CreatedAt)
+	return img, err
+}
+
+// productImages loads productID's gallery in position order.
+func (r *ProductRepository) productImages(ctx context.Context, productID int) ([]models.ProductImage, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+imageColumns+` FROM product_images WHERE product_id = $1 ORDER BY position`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []models.ProductImage{}
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// lockGallery locks productID's row so gallery changes to one product run one
+// at a time, and returns the number of images it has.
+func lockGallery(ctx context.Context, tx pgx.Tx, productID int) (int, error) {
+	var locked int
+	err := tx.QueryRow(ctx, `SELECT product_id FROM products WHERE product_id = $1 FOR UPDATE`, productID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = tx.QueryRow(ctx, `SELECT count(*) FROM product_images WHERE product_id = $1`, productID).Scan(&n)
+	return n, err
+}
+
+// ***************************list images*********************************
+func (r *ProductRepository) ListProductImages(ctx context.Context, productID int) ([]models.ProductImage, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE product_id = $1)`, productID).Scan(&exists); err != nil {
+		return nil, dbError(err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	images, err := r.productImages(ctx, productID)
+	if err != nil {
+		log.Println("Error reading product images:", err)
+		return nil, dbError(err)
+	}
+	return images, nil
+}
+
+// ***************************add image*********************************
+// AddProductImage appends img to the end of its product's gallery. It returns
+// ErrNotFound if the product does not exist and ErrTooManyImages if the
+// gallery is full.
+func (r *ProductRepository) AddProductImage(ctx context.Context, img models.ProductImage) (models.ProductImage, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := lockGallery(ctx, tx, img.Product_id)
+	if err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+	if n >= MaxProductImages {
+		return models.ProductImage{}, ErrTooManyImages
+	}
+
+	query := `INSERT INTO product_images (product_id, position, alt_text, content_type, width, height, size_bytes,
+	                                      original_key, thumb_key, medium_key)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	          RETURNING ` + imageColumns
+	img, err = scanImage(tx.QueryRow(ctx, query, img.Product_id, n, img.Alt_text, img.Content_type,
+		img.Width, img.Height, img.Size, img.Original_key, img.Thumb_key, img.Medium_key))
+	if err != nil {
+		log.Println("Error inserting product image:", err)
+		return models.ProductImage{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+	return img, nil
+}
+
+// ***************************update image*********************************
+// UpdateProductImage sets an image's alt text and moves it to position,
+// shifting the images in between; a position past the end means the end.
+func (r *ProductRepository) UpdateProductImage(ctx context.Context, productID, imageID int, altText string, position int) (models.ProductImage, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := lockGallery(ctx, tx, productID)
+	if err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+
+	var from int
+	err = tx.QueryRow(ctx, `SELECT position FROM product_images WHERE image_id = $1 AND product_id = $2`,
+		imageID, productID).Scan(&from)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ProductImage{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+
+	// the unique position constraint is deferred, so the rows in between can
+	// shift before the moved image takes its new place
+	to := clampPosition(position, n)
+	switch {
+	case to < from:
+		_, err = tx.Exec(ctx, `UPDATE product_images SET position = position + 1
+		                       WHERE product_id = $1 AND position >= $2 AND position < $3`, productID, to, from)
+	case to > from:
+		_, err = tx.Exec(ctx, `UPDATE product_images SET position = position - 1
+		                       WHERE product_id = $1 AND position > $2 AND position <= $3`, productID, from, to)
+	}
+	if err != nil {
+		log.Println("Error reordering product images:", err)
+		return models.ProductImage{}, dbError(err)
+	}
+
+	img, err := scanImage(tx.QueryRow(ctx,
+		`UPDATE product_images SET alt_text = $2, position = $3 WHERE image_id = $1 RETURNING `+imageColumns,
+		imageID, altText, to))
+	if err != nil {
+		log.Println("Error updating product image:", err)
+		return models.ProductImage{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+	return img, nil
+}
+
+// ***************************delete image*********************************
+// DeleteProductImage removes an image from the gallery, closing the gap it
+// leaves, and returns it so the caller can remove its files.
+func (r *ProductRepository) DeleteProductImage(ctx context.Context, productID, imageID int) (models.ProductImage, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockGallery(ctx, tx, productID); err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+
+	img, err := scanImage(tx.QueryRow(ctx,
+		`DELETE FROM product_images WHERE image_id = $1 AND product_id = $2 RETURNING `+imageColumns,
+		imageID, productID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ProductImage{}, ErrNotFound
+	}
+	if err != nil {
+		log.Println("Error deleting product image:", err)
+		return models.ProductImage{}, dbError(err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE product_images SET position = position - 1 WHERE product_id = $1 AND position > $2`,
+		productID, img.Position)
+	if err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+	return img, nil
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"my-go-project/models"
+	"sort"
+	"time"
+)
+
+// ErrInsufficientStock is returned when a product has less stock than asked
+// for. The error is an *InsufficientStockError naming the product.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// InsufficientStockError reports the product, and variant if any, that ran
+// short.
+type InsufficientStockError struct {
+	Product_id int
+	Variant_id int
+	Requested  int
+	Available  int
+}
+
+func (e *InsufficientStockError) Error() string {
+	if e.Variant_id != 0 {
+		return fmt.Sprintf("insufficient stock for product %d variant %d: requested %d, available %d", e.Product_id, e.Variant_id, e.Requested, e.Available)
+	}
+	return fmt.Sprintf("insufficient stock for product %d: requested %d, available %d", e.Product_id, e.Requested, e.Available)
+}
+
+func (e *InsufficientStockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
+
+// Ledger reasons written by the order flow; admin adjustments carry their own.
+const (
+	reasonOrderPlaced    = "order placed"
+	reasonOrderCancelled = "order cancelled"
+)
+
+// stockKey names where a line's stock lives: the variant when variant is set,
+// the product itself otherwise.
+type stockKey struct {
+	product int
+	variant int
+}
+
+// stockQuantities sums line quantities per stock key and returns the keys in
+// ascending order. Rows are always locked in that order, so two checkouts
+// sharing products cannot deadlock.
+func stockQuantities(lines []models.OrderProduct) (map[stockKey]int, []stockKey) {
+	qty := map[stockKey]int{}
+	for _, l := range lines {
+		qty[stockKey{l.Product_id, l.Variant_id}] += l.Quantity
+	}
+	keys := make([]stockKey, 0, len(qty))
+	for k := range qty {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].product != keys[j].product {
+			return keys[i].product < keys[j].product
+		}
+		return keys[i].variant < keys[j].variant
+	})
+	return qty, keys
+}
+
+// lineStock returns the stock a line for key draws on, locking the row when
+// lock is set. A product with variants has no stock of its own, so a key
+// without a variant fails with ErrVariantRequired; a variant of another
+// product fails with ErrUnknownVariant, and a missing product with
+// ErrNotFound.
+func lineStock(ctx context.Context, q queryRower, key stockKey, lock bool) (int, error) {
+	forUpdate := ""
+	if lock {
+		forUpdate = " FOR UPDATE"
+	}
+
+	var stock int
+	if key.variant != 0 {
+		err := q.QueryRow(ctx, `SELECT stock FROM product_variants WHERE variant_id = $1 AND product_id = $2`+forUpdate, key.variant, key.product).Scan(&stock)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUnknownVariant
+		}
+		return stock, err
+	}
+
+	var hasVariants bool
+	err := q.QueryRow(ctx,
+		`SELECT stock, EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.product_id) FROM products p WHERE p.product_id = $1`+forUpdate,
+		key.product).Scan(&stock, &hasVariants)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if hasVariants {
+		return 0, ErrVariantRequired
+	}
+	return stock, nil
+}
+
+// missingProduct reports a line naming a product that does not exist, the way
+// the line's foreign key would.
+func missingProduct(table string, productID int) error {
+	return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: table + "_product_id_fkey", Err: fmt.Errorf("product %d does not exist", productID)}
+}
+
+// reserveStock takes the stock for lines of an order inside tx. Each product
+// or variant row is locked with SELECT ... FOR UPDATE before it is checked and
+// decremented, so concurrent orders for the same stock queue up and it never
+// goes negative. The taken stock is recorded as a reservation that expires at
+// holdUntil, and in the ledger.
+func reserveStock(ctx context.Context, tx pgx.Tx, orderID int, lines []models.OrderProduct, actorID int, holdUntil time.Time) error {
+	qty, keys := stockQuantities(lines)
+	for _, key := range keys {
+		stock, err := lineStock(ctx, tx, key, true)
+		if errors.Is(err, ErrNotFound) {
+			return missingProduct("order_product", key.product)
+		}
+		if err != nil {
+			return err
+		}
+		if stock < qty[key] {
+			return &InsufficientStockError{Product_id: key.product, Variant_id: key.variant, Requested: qty[key], Available: stock}
+		}
+
+		if err := setStock(ctx, tx, key, stock-qty[key]); err != nil {
+			return err
+		}
+		if err := recordInventory(ctx, tx, key, -qty[key], stock-qty[key], reasonOrderPlaced, orderID, actorID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO stock_reservations (order_id, product_id, variant_id, quantity, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+			orderID, key.product, nullableID(key.variant), qty[key], holdUntil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseStock puts the stock reserved by an order back on sale inside tx and
+// drops the reservations. Orders without reservations are left alone.
+func releaseStock(ctx context.Context, tx pgx.Tx, orderID int, actorID int, reason string) error {
+	rows, err := tx.Query(ctx, `DELETE FROM stock_reservations WHERE order_id = $1 RETURNING product_id, COALESCE(variant_id, 0), quantity`, orderID)
+	if err != nil {
+		return err
+	}
+	var lines []models.OrderProduct
+	for rows.Next() {
+		var l models.OrderProduct
+		if err := rows.Scan(&l.Product_id, &l.Variant_id, &l.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	qty, keys := stockQuantities(lines)
+	for _, key := range keys {
+		query := `UPDATE products SET stock = stock + $1 WHERE product_id = $2 RETURNING stock`
+		id := key.product
+		if key.variant != 0 {
+			query = `UPDATE product_variants SET stock = stock + $1 WHERE variant_id = $2 RETURNING stock`
+			id = key.variant
+		}
+		var stock int
+		if err := tx.QueryRow(ctx, query, qty[key], id).Scan(&stock); err != nil {
+			return err
+		}
+		if err := recordInventory(ctx, tx, key, qty[key], stock, reason, orderID, actorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeStock turns an order's reservations into a sale: the stock stays
+// taken and the hold is dropped so it can no longer expire.
+func consumeStock(ctx context.Context, tx pgx.Tx, orderID int) error {
+	_, err := tx.Exec(ctx, `DELETE FROM stock_reservations WHERE order_id = $1`, orderID)
+	return err
+}
+
+// setStock stores the stock level of key.
+func setStock(ctx context.Context, tx pgx.Tx, key stockKey, stock int) error {
+	var err error
+	if key.variant != 0 {
+		_, err = tx.Exec(ctx, `UPDATE product_variants SET stock = $1 WHERE variant_id = $2`, stock, key.variant)
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE products SET stock = $1 WHERE product_id = $2`, stock, key.product)
+	}
+	return err
+}
+
+// recordInventory appends an entry to a product's inventory ledger.
+func recordInventory(ctx context.Context, tx pgx.Tx, key stockKey, delta, stockAfter int, reason string, orderID, actorID int) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO inventory_ledger (product_id, variant_id, delta, stock_after, reason, order_id, actor_id) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.product, nullableID(key.variant), delta, stockAfter, reason, nullableID(orderID), nullableID(actorID))
+	return err
+}
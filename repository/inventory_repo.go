@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+)
+
+// ***************************stock level*********************************
+// GetStock returns a product's stock on sale and what pending orders hold,
+// with the same for each of its variants.
+func (r *ProductRepository) GetStock(ctx context.Context, productID int) (models.StockLevel, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	level := models.StockLevel{Product_id: productID}
+	query := `SELECT p.stock, COALESCE((SELECT sum(sr.quantity) FROM stock_reservations sr
+		                                WHERE sr.product_id = p.product_id AND sr.variant_id IS NULL), 0)
+		FROM products p WHERE p.product_id = $1`
+	err := r.db.QueryRow(ctx, query, productID).Scan(&level.Stock, &level.Reserved)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.StockLevel{}, ErrNotFound
+	}
+	if err != nil {
+		return models.StockLevel{}, dbError(err)
+	}
+
+	rows, err := r.db.Query(ctx, `SELECT v.variant_id, v.stock, COALESCE(sum(sr.quantity), 0)
+		FROM product_variants v
+		LEFT JOIN stock_reservations sr ON sr.variant_id = v.variant_id
+		WHERE v.product_id = $1
+		GROUP BY v.variant_id
+		ORDER BY v.variant_id`, productID)
+	if err != nil {
+		return models.StockLevel{}, dbError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		v := models.StockLevel{Product_id: productID}
+		if err := rows.Scan(&v.Variant_id, &v.Stock, &v.Reserved); err != nil {
+			return models.StockLevel{}, dbError(err)
+		}
+		level.Variants = append(level.Variants, v)
+	}
+	if err := rows.Err(); err != nil {
+		return models.StockLevel{}, dbError(err)
+	}
+	return level, nil
+}
+
+// ***************************stock adjustment*********************************
+// AdjustStock changes the stock of a product, or of one of its variants when
+// variantID is set, by delta and records why in the ledger. A product with
+// variants is only stocked through them (ErrVariantRequired). The row is
+// locked for the change, so an adjustment racing a checkout cannot take stock
+// below zero; one that would fails with an *InsufficientStockError.
+func (r *ProductRepository) AdjustStock(ctx context.Context, productID, variantID, delta int, reason string, actorID int) (models.InventoryEntry, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.InventoryEntry{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	key := stockKey{productID, variantID}
+	stock, err := lineStock(ctx, tx, key, true)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVariantRequired) || errors.Is(err, ErrUnknownVariant) {
+		return models.InventoryEntry{}, err
+	}
+	if err != nil {
+		return models.InventoryEntry{}, dbError(err)
+	}
+	if stock+delta < 0 {
+		return models.InventoryEntry{}, &InsufficientStockError{Product_id: productID, Variant_id: variantID, Requested: -delta, Available: stock}
+	}
+
+	entry := models.InventoryEntry{Product_id: productID, Variant_id: variantID, Delta: delta, Stock_after: stock + delta, Reason: reason, Actor_id: actorID}
+	if err := setStock(ctx, tx, key, entry.Stock_after); err != nil {
+		log.Println("Error adjusting stock:", err)
+		return models.InventoryEntry{}, dbError(err)
+	}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO inventory_ledger (product_id, variant_id, delta, stock_after, reason, actor_id) VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING entry_id, create_at`,
+		productID, nullableID(variantID), delta, entry.Stock_after, reason, nullableID(actorID),
+	).Scan(&entry.Entry_id, &entry.CreatedAt)
+	if err != nil {
+		log.Println("Error recording stock adjustment:", err)
+		return models.InventoryEntry{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.InventoryEntry{}, dbError(err)
+	}
+	return entry, nil
+}
+
+// ***************************inventory ledger*********************************
+// ListInventoryLedger pages through the stock changes of a product and its
+// variants, newest first.
+func (r *ProductRepository) ListInventoryLedger(ctx context.Context, productID int, page PageRequest) (models.Page[models.InventoryEntry], error) {
+	after, _, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.InventoryEntry]{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var exists bool
+	var total int
+	err = r.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM products WHERE product_id = $1), (SELECT count(*) FROM inventory_ledger WHERE product_id = $1)`,
+		productID).Scan(&exists, &total)
+	if err != nil {
+		return models.Page[models.InventoryEntry]{}, dbError(err)
+	}
+	if !exists {
+		return models.Page[models.InventoryEntry]{}, ErrNotFound
+	}
+
+	// after.ID is 0 on the first page
+	query := `SELECT entry_id, product_id, COALESCE(variant_id, 0), delta, stock_after, reason, COALESCE(order_id, 0), COALESCE(actor_id, 0), create_at
+		FROM inventory_ledger
+		WHERE product_id = $1 AND ($2 = 0 OR entry_id < $2)
+		ORDER BY entry_id DESC
+		LIMIT $3`
+
+	limit := page.limit()
+	rows, err := r.db.Query(ctx, query, productID, after.ID, limit+1)
+	if err != nil {
+		log.Println("Error reading inventory ledger:", err)
+		return models.Page[models.InventoryEntry]{}, dbError(err)
+	}
+	defer rows.Close()
+
+	var entries []models.InventoryEntry
+	var keys []cursor
+	for rows.Next() {
+		var e models.InventoryEntry
+		if err := rows.Scan(&e.Entry_id, &e.Product_id, &e.Variant_id, &e.Delta, &e.Stock_after, &e.Reason, &e.Order_id, &e.Actor_id, &e.CreatedAt); err != nil {
+			return models.Page[models.InventoryEntry]{}, dbError(err)
+		}
+		entries = append(entries, e)
+		keys = append(keys, cursor{ID: e.Entry_id})
+	}
+	if err := rows.Err(); err != nil {
+		return models.Page[models.InventoryEntry]{}, dbError(err)
+	}
+	return newPage(entries, keys, limit, total), nil
+}
+
+// ***************************expire holds*********************************
+// ExpireReservations cancels every pending order whose stock hold has run out,
+// which puts the stock back on sale. Each order is cancelled in its own
+// transaction; one that was paid or cancelled in the meantime is skipped. It
+// returns how many orders were cancelled.
+func (r *UserRepository) ExpireReservations(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT DISTINCT order_id FROM stock_reservations WHERE expires_at <= now() ORDER BY order_id`)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	var orderIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, dbError(err)
+		}
+		orderIDs = append(orderIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, dbError(err)
+	}
+
+	expired := 0
+	for _, id := range orderIDs {
+		err := r.expireOrder(ctx, id)
+		if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return expired, dbError(err)
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func (r *UserRepository) expireOrder(ctx context.Context, orderID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := transitionOrder(ctx, tx, orderID, models.OrderCancelled, 0, "reservation expired"); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
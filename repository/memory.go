@@ -0,0 +1,2724 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"my-go-project/config"
+	"my-go-project/models"
+	"my-go-project/money"
+	"my-go-project/pricing"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory implementation of every store interface with the
+// same semantics as the Postgres repositories, including key and foreign-key
+// checks. It is safe for concurrent use and meant for handler tests.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	jwt       config.JWTConfig
+	inventory config.InventoryConfig
+	guest     config.GuestCartConfig
+	signer    TokenSigner
+	nextID    map[string]int
+
+	products      map[int]models.Products
+	users         map[int]models.Users
+	carts         map[int]models.Cart
+	cartProducts  map[int]models.CartProduct
+	orders        map[int]models.Orders
+	orderProducts map[int]orderProductRow
+	creditCards   map[int]models.CreditCard
+	payments      map[int]models.Payment
+	statusHistory []models.OrderStatusChange
+	refreshTokens map[string]*refreshTokenRow
+	revokedJTIs   map[string]time.Time
+
+	categories        map[int]models.Category
+	tags              map[int]models.Tag
+	productCategories map[int]map[int]bool // product_id -> category_ids
+	productTags       map[int]map[int]bool // product_id -> tag_ids
+
+	variants        map[int]models.ProductVariant
+	images          map[int]models.ProductImage
+	reservations    map[int]reservationRow
+	inventoryLedger []models.InventoryEntry
+
+	coupons          map[int]models.Coupon
+	couponCategories map[int]map[int]bool // coupon_id -> category_ids
+	cartCoupons      map[int]int          // cart_id -> coupon_id
+	orderCoupons     map[int]int          // order_id -> coupon_id
+	orderDiscounts   map[int]models.OrderDiscount
+
+	pricing         *pricing.Calculator
+	orderDeliveries map[int]orderDeliveryRow
+
+	guestCarts map[string]guestCartRow // guest_id -> cart
+}
+
+// guestCartRow mirrors the guest_id and expires_at columns of cart.
+type guestCartRow struct {
+	cartID    int
+	expiresAt time.Time
+}
+
+// orderDeliveryRow mirrors the ship_*, shipping_* and tax columns of orders,
+// which only GetOrder and Checkout return.
+type orderDeliveryRow struct {
+	shipTo      models.Address
+	shipping    *models.ShippingCharge
+	tax         money.Money
+	taxIncluded bool
+}
+
+// reservationRow mirrors stock_reservations.
+type reservationRow struct {
+	orderID   int
+	productID int
+	variantID int
+	quantity  int
+	expiresAt time.Time
+}
+
+// refreshTokenRow mirrors refresh_tokens, keyed by token hash.
+type refreshTokenRow struct {
+	userID    int
+	family    string
+	expiresAt time.Time
+	revoked   bool
+}
+
+// orderProductRow mirrors order_product, whose user_id column is not part of
+// models.OrderProduct.
+type orderProductRow struct {
+	models.OrderProduct
+	userID int
+}
+
+func NewMemoryStore(jwtCfg config.JWTConfig, inventoryCfg config.InventoryConfig, guestCfg config.GuestCartConfig, signer TokenSigner, calc *pricing.Calculator) *MemoryStore {
+	return &MemoryStore{
+		jwt:           jwtCfg,
+		inventory:     inventoryCfg,
+		guest:         guestCfg,
+		signer:        signer,
+		nextID:        map[string]int{},
+		products:      map[int]models.Products{},
+		users:         map[int]models.Users{},
+		carts:         map[int]models.Cart{},
+		cartProducts:  map[int]models.CartProduct{},
+		orders:        map[int]models.Orders{},
+		orderProducts: map[int]orderProductRow{},
+		creditCards:   map[int]models.CreditCard{},
+		payments:      map[int]models.Payment{},
+		refreshTokens: map[string]*refreshTokenRow{},
+		revokedJTIs:   map[string]time.Time{},
+
+		categories:        map[int]models.Category{},
+		tags:              map[int]models.Tag{},
+		productCategories: map[int]map[int]bool{},
+		productTags:       map[int]map[int]bool{},
+
+		variants:     map[int]models.ProductVariant{},
+		images:       map[int]models.ProductImage{},
+		reservations: map[int]reservationRow{},
+
+		coupons:          map[int]models.Coupon{},
+		couponCategories: map[int]map[int]bool{},
+		cartCoupons:      map[int]int{},
+		orderCoupons:     map[int]int{},
+		orderDiscounts:   map[int]models.OrderDiscount{},
+
+		pricing:         calc,
+		orderDeliveries: map[int]orderDeliveryRow{},
+
+		guestCarts: map[string]guestCartRow{},
+	}
+}
+
+var (
+	_ ProductStore    = (*MemoryStore)(nil)
+	_ UserStore       = (*MemoryStore)(nil)
+	_ CartStore       = (*MemoryStore)(nil)
+	_ GuestCartStore  = (*MemoryStore)(nil)
+	_ OrderStore      = (*MemoryStore)(nil)
+	_ CreditCardStore = (*MemoryStore)(nil)
+	_ CatalogStore    = (*MemoryStore)(nil)
+	_ VariantStore    = (*MemoryStore)(nil)
+	_ ImageStore      = (*MemoryStore)(nil)
+	_ InventoryStore  = (*MemoryStore)(nil)
+	_ PaymentStore    = (*MemoryStore)(nil)
+	_ CouponStore     = (*MemoryStore)(nil)
+)
+
+// newID hands out the next identity value for table, like a Postgres
+// identity column. Callers must hold the write lock.
+func (s *MemoryStore) newID(table string) int {
+	s.nextID[table]++
+	return s.nextID[table]
+}
+
+func missingReference(table string, id int) error {
+	return &ConstraintError{Kind: ErrForeignKeyViolation, Err: fmt.Errorf("%s %d does not exist", table, id)}
+}
+
+// currencyMismatch mirrors a violation of one of the currencyConstraints.
+func currencyMismatch(constraint, got, want string) error {
+	return &ConstraintError{Kind: money.ErrCurrencyMismatch, Constraint: constraint, Err: fmt.Errorf("currency %s does not match %s", got, want)}
+}
+
+// sortedKeys returns the keys of m in ascending order so results are stable.
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// pageFrom pages rows that are already in list order, keys[i] being the
+// cursor of rows[i]. The page starts at the first row for which past reports
+// true, i.e. the first row after the request's cursor.
+func pageFrom[T any](rows []T, keys []cursor, limit int, past func(i int) bool) models.Page[T] {
+	start := 0
+	for start < len(rows) && !past(start) {
+		start++
+	}
+	end := start + limit + 1
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return newPage(rows[start:end], keys[start:end], limit, len(rows))
+}
+
+// ******************************products*************************************
+func (s *MemoryStore) GetAllProducts(ctx context.Context, f ProductFilter) (models.Page[models.Products], error) {
+	if err := ctx.Err(); err != nil {
+		return models.Page[models.Products]{}, dbError(err)
+	}
+
+	sortName := f.sortName()
+	order, ok := productSorts[sortName]
+	if !ok {
+		return models.Page[models.Products]{}, fmt.Errorf("%w: unknown sort %q", ErrValidation, f.Sort)
+	}
+	after, hasCursor, err := decodeCursor(f.PageRequest, sortName)
+	if err != nil {
+		return models.Page[models.Products]{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inCategory := s.categorySubtree(f.Category)
+	var products []models.Products
+	for _, id := range sortedKeys(s.products) {
+		p := s.products[id]
+		if !f.matches(p) || !hasLink(s.productCategories[id], inCategory, f.Category) || !hasLink(s.productTags[id], s.tagIDs(f.Tag), f.Tag) {
+			continue
+		}
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return order.before(products[i], products[j]) })
+
+	keys := make([]cursor, len(products))
+	for i, p := range products {
+		keys[i] = order.key(sortName, p)
+	}
+	last := models.Products{Product_id: after.ID, Product_name: after.S}
+	if order.column == "price" {
+		last.Price = money.Money{Amount: int64(after.N), Currency: after.S}
+	}
+	page := pageFrom(products, keys, f.limit(), func(i int) bool {
+		return !hasCursor || order.before(last, products[i])
+	})
+	for i := range page.Items {
+		page.Items[i].Variants = s.productVariants(page.Items[i].Product_id)
+		page.Items[i].Variant_options = VariantOptions(page.Items[i].Variants)
+	}
+	return page, nil
+}
+
+// SearchProducts approximates the Postgres full-text search: every word of q
+// must start a word of the name or description, and name matches rank higher.
+func (s *MemoryStore) SearchProducts(ctx context.Context, q string, limit int) (models.Page[models.ProductSearchResult], error) {
+	if err := ctx.Err(); err != nil {
+		return models.Page[models.ProductSearchResult]{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := searchTerms(q)
+	results := []models.ProductSearchResult{}
+	for _, id := range sortedKeys(s.products) {
+		p := s.products[id]
+		if rank, ok := memoryRank(terms, p); ok {
+			snippet := memorySnippet(terms, p.Product_name+" — "+p.Description)
+			results = append(results, models.ProductSearchResult{Products: p, Rank: rank, Snippet: snippet})
+		}
+	}
+	sortByScore(results, func(r models.ProductSearchResult) float64 { return r.Rank }, func(r models.ProductSearchResult) int { return r.Product_id })
+
+	page := models.Page[models.ProductSearchResult]{Items: results, Total: len(results)}
+	if limit = clampLimit(limit, DefaultPageLimit, MaxPageLimit); len(results) > limit {
+		page.Items = results[:limit]
+	}
+	return page, nil
+}
+
+// memoryRank scores 1 for each term found in p's name and 0.4 for each found
+// only in its description, the ratio of the A and B weights in Postgres.
+func memoryRank(terms []string, p models.Products) (float64, bool) {
+	if len(terms) == 0 {
+		return 0, false
+	}
+	name, desc := searchTerms(p.Product_name), searchTerms(p.Description)
+	rank := 0.0
+	for _, t := range terms {
+		switch {
+		case hasWordPrefix(name, t):
+			rank += 1
+		case hasWordPrefix(desc, t):
+			rank += 0.4
+		default:
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+func hasWordPrefix(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// memorySnippet marks the words of text that start with one of terms.
+func memorySnippet(terms []string, text string) string {
+	words := strings.Fields(text)
+	for i, w := range words {
+		for _, t := range terms {
+			if hasWordPrefix(searchTerms(w), t) {
+				words[i] = highlightStart + w + highlightStop
+				break
+			}
+		}
+	}
+	return highlight(strings.Join(words, " "))
+}
+
+// SuggestProducts scores names with wordSimilarity, the in-memory stand-in
+// for pg_trgm.
+func (s *MemoryStore) SuggestProducts(ctx context.Context, q string, limit int) ([]models.ProductSuggestion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	suggestions := []models.ProductSuggestion{}
+	for _, id := range sortedKeys(s.products) {
+		p := s.products[id]
+		if score := wordSimilarity(q, p.Product_name); score >= suggestThreshold {
+			suggestions = append(suggestions, models.ProductSuggestion{Product_id: p.Product_id, Product_name: p.Product_name, Score: score})
+		}
+	}
+	sortByScore(suggestions, func(s models.ProductSuggestion) float64 { return s.Score }, func(s models.ProductSuggestion) int { return s.Product_id })
+
+	if limit = clampLimit(limit, DefaultSuggestLimit, MaxSuggestLimit); len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+func (s *MemoryStore) GetProduct(ctx context.Context, id int) (models.Products, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Products{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.products[id]
+	if !ok {
+		return models.Products{}, ErrNotFound
+	}
+	p.Categories, p.Tags = []string{}, []string{}
+	for categoryID := range s.productCategories[id] {
+		p.Categories = append(p.Categories, s.categories[categoryID].Slug)
+	}
+	for tagID := range s.productTags[id] {
+		p.Tags = append(p.Tags, s.tags[tagID].Slug)
+	}
+	sort.Strings(p.Categories)
+	sort.Strings(p.Tags)
+	p.Variants = s.productVariants(id)
+	p.Variant_options = VariantOptions(p.Variants)
+	p.Images = s.productImages(id)
+	return p, nil
+}
+
+func (s *MemoryStore) CreateProduct(ctx context.Context, p models.Products) (models.Products, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Products{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.Product_id = s.newID("products")
+	// stock is changed through AdjustStock; links through SetProductCategories
+	// and SetProductTags
+	p.Stock = 0
+	p.Categories, p.Tags = nil, nil
+	p.Variants, p.Variant_options = nil, nil
+	p.Images = nil
+	s.products[p.Product_id] = p
+	return p, nil
+}
+
+func (s *MemoryStore) DeleteProduct(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[id]; !ok {
+		return ErrNotFound
+	}
+	for _, op := range s.orderProducts {
+		if op.Product_id == id {
+			return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: "order_product_product_id_fkey", Err: fmt.Errorf("product %d is referenced by order_product", id)}
+		}
+	}
+	for cpID, cp := range s.cartProducts {
+		if cp.Product_id == id {
+			delete(s.cartProducts, cpID)
+		}
+	}
+	delete(s.productCategories, id)
+	delete(s.productTags, id)
+	for couponID, c := range s.coupons {
+		var kept []int
+		for _, productID := range c.Product_ids {
+			if productID != id {
+				kept = append(kept, productID)
+			}
+		}
+		c.Product_ids = kept
+		s.coupons[couponID] = c
+	}
+	for variantID, v := range s.variants {
+		if v.Product_id == id {
+			delete(s.variants, variantID)
+		}
+	}
+	for imageID, img := range s.images {
+		if img.Product_id == id {
+			delete(s.images, imageID)
+		}
+	}
+	ledger := s.inventoryLedger[:0]
+	for _, e := range s.inventoryLedger {
+		if e.Product_id != id {
+			ledger = append(ledger, e)
+		}
+	}
+	s.inventoryLedger = ledger
+	delete(s.products, id)
+	return nil
+}
+
+func (s *MemoryStore) UpdateProduct(ctx context.Context, p models.Products) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.products[p.Product_id]
+	if !ok {
+		return ErrNotFound
+	}
+	if p.Price.Currency != existing.Price.Currency {
+		for _, v := range s.variants {
+			if v.Product_id == p.Product_id && v.Price != nil {
+				return currencyMismatch("product_variants_currency_fkey", p.Price.Currency, v.Price.Currency)
+			}
+		}
+	}
+	existing.Product_name = p.Product_name
+	existing.Description = p.Description
+	existing.Price = p.Price
+	existing.Img_url = p.Img_url
+	existing.Weight_grams = p.Weight_grams
+	s.products[p.Product_id] = existing
+	return nil
+}
+
+func (s *MemoryStore) GetProductSales(ctx context.Context, username string, page PageRequest) (models.Page[models.Orders], error) {
+	if err := ctx.Err(); err != nil {
+		return models.Page[models.Orders]{}, dbError(err)
+	}
+	after, hasCursor, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.Orders]{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sales []models.Orders
+	var keys []cursor
+	opIDs := sortedKeys(s.orderProducts)
+	for i := len(opIDs) - 1; i >= 0; i-- {
+		opID := opIDs[i]
+		op := s.orderProducts[opID]
+		u, ok := s.users[op.userID]
+		if !ok || u.User_name != username {
+			continue
+		}
+		o, ok := s.orders[op.Order_id]
+		if !ok {
+			continue
+		}
+		p, ok := s.products[op.Product_id]
+		if !ok {
+			continue
+		}
+		sales = append(sales, models.Orders{
+			Order_id:    o.Order_id,
+			CreatedAt:   o.CreatedAt,
+			Username:    u.User_name,
+			ProductName: p.Product_name,
+			Quantity:    op.Quantity,
+			TotalPrice:  op.Price_update.Mul(op.Quantity),
+		})
+		keys = append(keys, cursor{ID: opID})
+	}
+	return pageFrom(sales, keys, page.limit(), func(i int) bool {
+		return !hasCursor || keys[i].ID < after.ID
+	}), nil
+}
+
+// ******************************users*************************************
+func (s *MemoryStore) GetAllUsers(ctx context.Context, page PageRequest) (models.Page[models.Users], error) {
+	if err := ctx.Err(); err != nil {
+		return models.Page[models.Users]{}, dbError(err)
+	}
+	after, _, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.Users]{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []models.Users
+	var keys []cursor
+	for _, id := range sortedKeys(s.users) {
+		u := s.users[id]
+		users = append(users, models.Users{User_id: u.User_id, User_name: u.User_name, Role: u.Role})
+		keys = append(keys, cursor{ID: id})
+	}
+	return pageFrom(users, keys, page.limit(), func(i int) bool {
+		return keys[i].ID > after.ID
+	}), nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, id int) (models.Users, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Users{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return models.Users{}, ErrNotFound
+	}
+	u.Password = ""
+	return u, nil
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user models.Users) (models.Users, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Users{}, dbError(err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.Users{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Email == user.Email {
+			return models.Users{}, &ConstraintError{Kind: ErrConflict, Constraint: "users_email_key", Column: "email", Err: fmt.Errorf("duplicate email %q", user.Email)}
+		}
+	}
+	user.User_id = s.newID("users")
+	user.CreatedAt = time.Now()
+	user.Password = string(hashedPassword)
+	user.Role = models.RoleCustomer
+	s.users[user.User_id] = user
+
+	user.Password = ""
+	return user, nil
+}
+
+func (s *MemoryStore) LoginUser(ctx context.Context, email, password string) (models.TokenPair, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TokenPair{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	var user models.Users
+	found := false
+	for _, u := range s.users {
+		if u.Email == email {
+			user, found = u, true
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if !found {
+		return models.TokenPair{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return models.TokenPair{}, ErrInvalidCredentials
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueSession(user, "")
+}
+
+// issueSession mirrors UserRepository.issueSession. Callers hold the write lock.
+func (s *MemoryStore) issueSession(user models.Users, family string) (models.TokenPair, error) {
+	access, err := signToken(user, s.signer, s.jwt.TTL)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	if family == "" {
+		if family, err = randomToken(16); err != nil {
+			return models.TokenPair{}, err
+		}
+	}
+
+	s.refreshTokens[hashToken(refresh)] = &refreshTokenRow{
+		userID:    user.User_id,
+		family:    family,
+		expiresAt: time.Now().Add(s.jwt.RefreshTTL),
+	}
+	return models.TokenPair{Token: access, RefreshToken: refresh, ExpiresIn: s.jwt.TTL, User_id: user.User_id}, nil
+}
+
+func (s *MemoryStore) revokeFamily(family string) {
+	for _, row := range s.refreshTokens {
+		if row.family == family {
+			row.revoked = true
+		}
+	}
+}
+
+func (s *MemoryStore) RefreshSession(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	if err := ctx.Err(); err != nil {
+		return models.TokenPair{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.refreshTokens[hashToken(refreshToken)]
+	if !ok {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if row.revoked {
+		s.revokeFamily(row.family)
+		return models.TokenPair{}, ErrRefreshTokenReused
+	}
+	if time.Now().After(row.expiresAt) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, ok := s.users[row.userID]
+	if !ok {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	pair, err := s.issueSession(user, row.family)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	row.revoked = true
+	return pair, nil
+}
+
+func (s *MemoryStore) Logout(ctx context.Context, userID int, jti string, expiresAt time.Time, refreshToken string) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokedJTIs[jti] = expiresAt
+	for id, exp := range s.revokedJTIs {
+		if exp.Before(time.Now()) {
+			delete(s.revokedJTIs, id)
+		}
+	}
+
+	if refreshToken != "" {
+		if row, ok := s.refreshTokens[hashToken(refreshToken)]; ok && row.userID == userID {
+			s.revokeFamily(row.family)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.revokedJTIs[jti]
+	return revoked, nil
+}
+
+func (s *MemoryStore) SetUserRole(ctx context.Context, userID int, role string) (models.Users, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Users{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.Users{}, ErrNotFound
+	}
+	u.Role = role
+	s.users[userID] = u
+
+	u.Password = ""
+	return u, nil
+}
+
+func (s *MemoryStore) SetUserAddress(ctx context.Context, userID int, a models.Address) (models.Users, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Users{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.Users{}, ErrNotFound
+	}
+	u.Address = a
+	s.users[userID] = u
+
+	u.Password = ""
+	return u, nil
+}
+
+// ******************************cart*************************************
+func (s *MemoryStore) AddCart(ctx context.Context, userID int) (models.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Cart{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, err := s.userCart(userID)
+	if err != nil {
+		return models.Cart{}, err
+	}
+	return s.carts[cartID], nil
+}
+
+func (s *MemoryStore) AddCartProduct(ctx context.Context, userID int, cp models.CartProduct) (models.CartProduct, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, err := s.userCart(userID)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if cp.Cart_id != 0 && cp.Cart_id != cartID {
+		return models.CartProduct{}, ErrNotFound
+	}
+	return s.addCartLine(cartID, cp)
+}
+
+func (s *MemoryStore) UpdateCartProduct(ctx context.Context, userID, cpID, quantity int) (models.CartProduct, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setCartLine(s.findUserCart(userID), cpID, quantity)
+}
+
+func (s *MemoryStore) RemoveCartProduct(ctx context.Context, userID, cpID int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeCartLine(s.findUserCart(userID), cpID)
+}
+
+func (s *MemoryStore) ClearCart(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clearCart(s.findUserCart(userID))
+	return nil
+}
+
+// GetCart takes the write lock because it creates the cart the first time.
+func (s *MemoryStore) GetCart(ctx context.Context, userID int) (models.CartView, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartView{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, err := s.userCart(userID)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	return s.cartView(cartID)
+}
+
+// ******************************guest carts*************************************
+func (s *MemoryStore) StartGuestCart(ctx context.Context) (models.GuestCart, error) {
+	if err := ctx.Err(); err != nil {
+		return models.GuestCart{}, dbError(err)
+	}
+
+	guestID, err := randomToken(16)
+	if err != nil {
+		return models.GuestCart{}, err
+	}
+	cart := models.GuestCart{Guest_id: guestID, Expires_at: time.Now().Add(s.guest.TTL)}
+	if cart.Guest_token, err = signGuestToken(guestID, s.signer, cart.Expires_at); err != nil {
+		return models.GuestCart{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cart.Cart_id = s.newID("cart")
+	s.carts[cart.Cart_id] = models.Cart{Cart_id: cart.Cart_id}
+	s.guestCarts[guestID] = guestCartRow{cartID: cart.Cart_id, expiresAt: cart.Expires_at}
+	return cart, nil
+}
+
+func (s *MemoryStore) GetGuestCart(ctx context.Context, guestID string) (models.CartView, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartView{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cartID, err := s.guestCart(guestID)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	return s.cartView(cartID)
+}
+
+func (s *MemoryStore) AddGuestCartProduct(ctx context.Context, guestID string, cp models.CartProduct) (models.CartProduct, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, err := s.guestCart(guestID)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	if cp.Cart_id != 0 && cp.Cart_id != cartID {
+		return models.CartProduct{}, ErrNotFound
+	}
+	return s.addCartLine(cartID, cp)
+}
+
+func (s *MemoryStore) UpdateGuestCartProduct(ctx context.Context, guestID string, cpID, quantity int) (models.CartProduct, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartProduct{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, err := s.guestCart(guestID)
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+	return s.setCartLine(cartID, cpID, quantity)
+}
+
+func (s *MemoryStore) RemoveGuestCartProduct(ctx context.Context, guestID string, cpID int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, err := s.guestCart(guestID)
+	if err != nil {
+		return err
+	}
+	return s.removeCartLine(cartID, cpID)
+}
+
+func (s *MemoryStore) ClearGuestCart(ctx context.Context, guestID string) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cartID, err := s.guestCart(guestID)
+	if err != nil {
+		return err
+	}
+	s.clearCart(cartID)
+	return nil
+}
+
+func (s *MemoryStore) MergeGuestCart(ctx context.Context, guestID string, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	guestCartID, err := s.guestCart(guestID)
+	if err != nil {
+		return err
+	}
+	cartID, err := s.userCart(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range sortedKeys(s.cartProducts) {
+		l := s.cartProducts[id]
+		if l.Cart_id != guestCartID {
+			continue
+		}
+		var existing models.CartProduct
+		for _, line := range s.cartProducts {
+			if line.Cart_id == cartID && line.Product_id == l.Product_id && line.Variant_id == l.Variant_id {
+				existing = line
+			}
+		}
+
+		stock, err := s.lineStock(stockKey{l.Product_id, l.Variant_id})
+		if err != nil {
+			continue
+		}
+		quantity := mergeQuantity(s.guest.Merge, existing.Quantity, l.Quantity, stock)
+		if quantity <= 0 || quantity == existing.Quantity {
+			continue
+		}
+		if existing.CP_id != 0 {
+			existing.Quantity = quantity
+			s.cartProducts[existing.CP_id] = existing
+			continue
+		}
+		if s.checkCartCurrency(cartID, l.Product_id) != nil {
+			continue
+		}
+		line := models.CartProduct{CP_id: s.newID("cart_product"), Cart_id: cartID, Product_id: l.Product_id, Variant_id: l.Variant_id, Quantity: quantity}
+		s.cartProducts[line.CP_id] = line
+	}
+
+	s.clearCart(guestCartID)
+	delete(s.carts, guestCartID)
+	delete(s.guestCarts, guestID)
+	return nil
+}
+
+func (s *MemoryStore) ExpireGuestCarts(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	expired := 0
+	for guestID, row := range s.guestCarts {
+		if row.expiresAt.After(now) {
+			continue
+		}
+		s.clearCart(row.cartID)
+		delete(s.carts, row.cartID)
+		delete(s.guestCarts, guestID)
+		expired++
+	}
+	return expired, nil
+}
+
+// guestCart mirrors the Postgres guestCart. Callers must hold the lock.
+func (s *MemoryStore) guestCart(guestID string) (int, error) {
+	row, ok := s.guestCarts[guestID]
+	if !ok || !row.expiresAt.After(time.Now()) {
+		return 0, ErrNotFound
+	}
+	return row.cartID, nil
+}
+
+// addCartLine mirrors the Postgres addCartLine. Callers must hold the write
+// lock.
+func (s *MemoryStore) addCartLine(cartID int, cp models.CartProduct) (models.CartProduct, error) {
+	cp.Cart_id = cartID
+
+	var existing models.CartProduct
+	for _, id := range sortedKeys(s.cartProducts) {
+		if line := s.cartProducts[id]; line.Cart_id == cartID && line.Product_id == cp.Product_id && line.Variant_id == cp.Variant_id {
+			existing = line
+		}
+	}
+	if err := s.checkCartStock(cp.Product_id, cp.Variant_id, existing.Quantity+cp.Quantity); err != nil {
+		return models.CartProduct{}, err
+	}
+	if err := s.checkCartCurrency(cartID, cp.Product_id); err != nil {
+		return models.CartProduct{}, err
+	}
+
+	if existing.CP_id != 0 {
+		existing.Quantity += cp.Quantity
+		s.cartProducts[existing.CP_id] = existing
+		return existing, nil
+	}
+	cp.CP_id = s.newID("cart_product")
+	s.cartProducts[cp.CP_id] = cp
+	return cp, nil
+}
+
+// setCartLine mirrors the Postgres setCartLine. Callers must hold the write
+// lock.
+func (s *MemoryStore) setCartLine(cartID, cpID, quantity int) (models.CartProduct, error) {
+	cp, ok := s.cartProducts[cpID]
+	if !ok || cp.Cart_id != cartID {
+		return models.CartProduct{}, ErrNotFound
+	}
+	if err := s.checkCartStock(cp.Product_id, cp.Variant_id, quantity); err != nil {
+		return models.CartProduct{}, err
+	}
+	cp.Quantity = quantity
+	s.cartProducts[cpID] = cp
+	return cp, nil
+}
+
+// removeCartLine mirrors the Postgres removeCartLine. Callers must hold the
+// write lock.
+func (s *MemoryStore) removeCartLine(cartID, cpID int) error {
+	cp, ok := s.cartProducts[cpID]
+	if !ok || cp.Cart_id != cartID {
+		return ErrNotFound
+	}
+	delete(s.cartProducts, cpID)
+	return nil
+}
+
+// clearCart mirrors the Postgres clearCart. Callers must hold the write lock.
+func (s *MemoryStore) clearCart(cartID int) {
+	for id, cp := range s.cartProducts {
+		if cp.Cart_id == cartID {
+			delete(s.cartProducts, id)
+		}
+	}
+	delete(s.cartCoupons, cartID)
+}
+
+// cartView mirrors the Postgres cartView. Callers must hold the lock.
+func (s *MemoryStore) cartView(cartID int) (models.CartView, error) {
+	lines, _ := s.cartLines(cartID)
+	summary, err := pricing.Summarize(lines, "", nil)
+	if err != nil {
+		return models.CartView{}, err
+	}
+	cart := models.CartView{Cart_id: cartID, Items: summary.Items, Subtotal: summary.Subtotal}
+	if couponID, ok := s.cartCoupons[cartID]; ok {
+		cart.Coupon_code = s.coupons[couponID].Code
+	}
+
+	var images []models.ProductImage
+	for _, l := range lines {
+		if gallery := s.productImages(l.Product_id); len(gallery) > 0 {
+			images = append(images, gallery[0])
+		}
+	}
+	setCartImages(cart.Items, images)
+	return cart, nil
+}
+
+// findUserCart returns the id of the user's cart, or 0 when they have none
+// yet. Callers must hold the lock.
+func (s *MemoryStore) findUserCart(userID int) int {
+	for _, id := range sortedKeys(s.carts) {
+		if s.carts[id].User_id == userID {
+			return id
+		}
+	}
+	return 0
+}
+
+// userCart mirrors the Postgres userCart. Callers must hold the write lock.
+func (s *MemoryStore) userCart(userID int) (int, error) {
+	if cartID := s.findUserCart(userID); cartID != 0 {
+		return cartID, nil
+	}
+	if _, ok := s.users[userID]; !ok {
+		return 0, missingReference("users", userID)
+	}
+	cart := models.Cart{Cart_id: s.newID("cart"), User_id: userID}
+	s.carts[cart.Cart_id] = cart
+	return cart.Cart_id, nil
+}
+
+// checkCartStock mirrors the Postgres checkCartStock. Callers must hold the
+// lock.
+func (s *MemoryStore) checkCartStock(productID, variantID, quantity int) error {
+	stock, err := s.lineStock(stockKey{productID, variantID})
+	if errors.Is(err, ErrNotFound) {
+		return missingReference("products", productID)
+	}
+	if err != nil {
+		return err
+	}
+	if stock < quantity {
+		return &InsufficientStockError{Product_id: productID, Variant_id: variantID, Requested: quantity, Available: stock}
+	}
+	return nil
+}
+
+// checkCartCurrency mirrors the Postgres checkCartCurrency. Callers must hold
+// the lock.
+func (s *MemoryStore) checkCartCurrency(cartID, productID int) error {
+	currency := s.products[productID].Price.Currency
+	for _, line := range s.cartProducts {
+		if p, ok := s.products[line.Product_id]; ok && line.Cart_id == cartID && p.Price.Currency != currency {
+			return fmt.Errorf("%w: the cart is priced in %s, the product in %s", money.ErrCurrencyMismatch, p.Price.Currency, currency)
+		}
+	}
+	return nil
+}
+
+// ******************************orders*************************************
+func (s *MemoryStore) GetOrder(ctx context.Context, userID, orderID int) (models.Orders, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Orders{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	order, ok := s.orders[orderID]
+	if !ok || order.User_id == 0 || order.User_id != userID {
+		return models.Orders{}, ErrNotFound
+	}
+	return s.orderView(order), nil
+}
+
+func (s *MemoryStore) FindOrder(ctx context.Context, orderID int) (models.Orders, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Orders{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return models.Orders{}, ErrNotFound
+	}
+	return s.orderView(order), nil
+}
+
+// orderView adds an order's delivery and discount lines. A User_id of 0
+// stands for the NULL owner of an order whose user was deleted. Callers must
+// hold the read lock.
+func (s *MemoryStore) orderView(order models.Orders) models.Orders {
+	if d, ok := s.orderDeliveries[order.Order_id]; ok {
+		shipTo, tax := d.shipTo, d.tax
+		order.Ship_to, order.Shipping, order.Tax, order.Tax_included = &shipTo, d.shipping, &tax, d.taxIncluded
+	}
+	for _, id := range sortedKeys(s.orderDiscounts) {
+		if d := s.orderDiscounts[id]; d.Order_id == order.Order_id {
+			order.Discounts = append(order.Discounts, d)
+		}
+	}
+	return order
+}
+
+func (s *MemoryStore) GetOrderItems(ctx context.Context, orderID int) ([]models.OrderProduct, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []models.OrderProduct
+	for _, id := range sortedKeys(s.orderProducts) {
+		if op := s.orderProducts[id]; op.Order_id == orderID {
+			items = append(items, op.OrderProduct)
+		}
+	}
+	return items, nil
+}
+
+func (s *MemoryStore) GetHistory(ctx context.Context, userID int, page PageRequest) (models.Page[models.OrderProduct], error) {
+	if err := ctx.Err(); err != nil {
+		return models.Page[models.OrderProduct]{}, dbError(err)
+	}
+	after, hasCursor, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.OrderProduct]{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var orderHistory []models.OrderProduct
+	var keys []cursor
+	opIDs := sortedKeys(s.orderProducts)
+	for i := len(opIDs) - 1; i >= 0; i-- {
+		op := s.orderProducts[opIDs[i]]
+		o, ok := s.orders[op.Order_id]
+		if !ok || o.User_id != userID {
+			continue
+		}
+		switch o.Status {
+		case models.OrderPaid, models.OrderFulfilled, models.OrderShipped, models.OrderDelivered:
+		default:
+			continue
+		}
+		p, ok := s.products[op.Product_id]
+		if !ok {
+			continue
+		}
+		orderHistory = append(orderHistory, models.OrderProduct{
+			OP_id:       op.OP_id,
+			Product_id:  op.Product_id,
+			Variant_id:  op.Variant_id,
+			Order_id:    op.Order_id,
+			Quantity:    op.Quantity,
+			ProductName: p.Product_name,
+		})
+		keys = append(keys, cursor{ID: op.OP_id})
+	}
+	return pageFrom(orderHistory, keys, page.limit(), func(i int) bool {
+		return !hasCursor || keys[i].ID < after.ID
+	}), nil
+}
+
+func (s *MemoryStore) QuoteCart(ctx context.Context, userID int, d models.Delivery) (models.Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Quote{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	quote, _, _, err := s.quoteCart(userID, d)
+	return quote, err
+}
+
+func (s *MemoryStore) Checkout(ctx context.Context, userID int, d models.Delivery) (models.Checkout, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Checkout{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quote, cartLineIDs, couponID, err := s.quoteCart(userID, d)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+	items := make([]models.OrderProduct, len(quote.Items))
+	for i, l := range quote.Items {
+		items[i] = models.OrderProduct{Product_id: l.Product_id, Variant_id: l.Variant_id, Quantity: l.Quantity, Price_update: l.Unit_price, ProductName: l.Product_name}
+	}
+
+	order := orderFromQuote(quote)
+	order.Order_id = s.newID("orders")
+	order.User_id = userID
+	order.CreatedAt = time.Now()
+	if err := s.reserveStock(order.Order_id, items, userID, time.Now().Add(s.inventory.HoldTTL)); err != nil {
+		return models.Checkout{}, err
+	}
+	if couponID != 0 {
+		s.orderCoupons[order.Order_id] = couponID
+	}
+	for _, d := range quote.Discounts {
+		d.Discount_id = s.newID("order_discounts")
+		d.Order_id = order.Order_id
+		s.orderDiscounts[d.Discount_id] = d
+		order.Discounts = append(order.Discounts, d)
+	}
+	s.orderDeliveries[order.Order_id] = orderDeliveryRow{shipTo: *order.Ship_to, shipping: order.Shipping, tax: *order.Tax, taxIncluded: order.Tax_included}
+	s.orders[order.Order_id] = models.Orders{
+		Order_id:   order.Order_id,
+		User_id:    order.User_id,
+		TotalPrice: order.TotalPrice,
+		Status:     order.Status,
+		CreatedAt:  order.CreatedAt,
+	}
+	s.recordStatus(order.Order_id, "", order.Status, userID, "checkout")
+
+	for i := range items {
+		items[i].OP_id = s.newID("order_product")
+		items[i].Order_id = order.Order_id
+		row := items[i]
+		row.ProductName = ""
+		s.orderProducts[row.OP_id] = orderProductRow{OrderProduct: row, userID: userID}
+	}
+
+	for _, id := range cartLineIDs {
+		delete(s.cartProducts, id)
+	}
+	for cartID, c := range s.carts {
+		if c.User_id == userID {
+			delete(s.cartCoupons, cartID)
+		}
+	}
+	return models.Checkout{Order: order, Items: items}, nil
+}
+
+// quoteCart mirrors the Postgres quoteCart. Callers must hold the lock.
+func (s *MemoryStore) quoteCart(userID int, d models.Delivery) (models.Quote, []int, int, error) {
+	lines, cartLineIDs := s.cartLines(s.findUserCart(userID))
+	if len(lines) == 0 {
+		return models.Quote{}, nil, 0, ErrEmptyCart
+	}
+
+	dest := models.Address{}
+	if d.Ship_to != nil {
+		dest = *d.Ship_to
+	} else {
+		var ok bool
+		if dest, ok = NormalizeAddress(s.users[userID].Address); !ok {
+			return models.Quote{}, nil, 0, ErrAddressRequired
+		}
+	}
+
+	var coupon models.Coupon
+	var discounts []models.OrderDiscount
+	couponID := s.userCartCoupon(userID)
+	if couponID != 0 {
+		coupon = s.coupon(couponID)
+		var err error
+		if discounts, err = s.couponDiscounts(coupon, userID, lines); err != nil {
+			return models.Quote{}, nil, 0, err
+		}
+	}
+	quote, err := s.pricing.Quote(lines, dest, d.Shipping_method, coupon.Code, discounts)
+	if err != nil {
+		return models.Quote{}, nil, 0, err
+	}
+	return quote, cartLineIDs, couponID, nil
+}
+
+// recordStatus appends to an order's timeline. Callers must hold the write lock.
+func (s *MemoryStore) recordStatus(orderID int, from, to string, actorID int, note string) {
+	s.statusHistory = append(s.statusHistory, models.OrderStatusChange{
+		History_id:  s.newID("order_status_history"),
+		Order_id:    orderID,
+		From_status: from,
+		To_status:   to,
+		Actor_id:    actorID,
+		Note:        note,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// transitionOrder applies the transition table. Callers must hold the write lock.
+func (s *MemoryStore) transitionOrder(orderID int, to string, actorID int, note string) (models.Orders, error) {
+	order, ok := s.orders[orderID]
+	if !ok {
+		return models.Orders{}, ErrNotFound
+	}
+	if !CanTransition(order.Status, to) {
+		return models.Orders{}, ErrInvalidTransition
+	}
+	s.recordStatus(orderID, order.Status, to, actorID, note)
+	order.Status = to
+	s.orders[orderID] = order
+
+	switch to {
+	case models.OrderCancelled:
+		reason := reasonOrderCancelled
+		if note != "" {
+			reason += ": " + note
+		}
+		s.releaseStock(orderID, actorID, reason)
+	case models.OrderPaid:
+		for id, res := range s.reservations {
+			if res.orderID == orderID {
+				delete(s.reservations, id)
+			}
+		}
+	}
+	return order, nil
+}
+
+func (s *MemoryStore) TransitionOrder(ctx context.Context, orderID int, to string, actorID int, note string) (models.Orders, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Orders{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transitionOrder(orderID, to, actorID, note)
+}
+
+func (s *MemoryStore) GetOrderTimeline(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var timeline []models.OrderStatusChange
+	for _, c := range s.statusHistory {
+		if c.Order_id == orderID {
+			timeline = append(timeline, c)
+		}
+	}
+	return timeline, nil
+}
+
+// ******************************inventory*************************************
+// lineStock mirrors the Postgres lineStock. Callers must hold the lock.
+func (s *MemoryStore) lineStock(key stockKey) (int, error) {
+	if key.variant != 0 {
+		v, ok := s.variants[key.variant]
+		if !ok || v.Product_id != key.product {
+			return 0, ErrUnknownVariant
+		}
+		return v.Stock, nil
+	}
+	p, ok := s.products[key.product]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	for _, v := range s.variants {
+		if v.Product_id == key.product {
+			return 0, ErrVariantRequired
+		}
+	}
+	return p.Stock, nil
+}
+
+// reserveStock takes the stock for an order's lines, or nothing at all if any
+// product or variant is short. Callers must hold the write lock.
+func (s *MemoryStore) reserveStock(orderID int, lines []models.OrderProduct, actorID int, holdUntil time.Time) error {
+	qty, keys := stockQuantities(lines)
+	for _, key := range keys {
+		stock, err := s.lineStock(key)
+		if errors.Is(err, ErrNotFound) {
+			return missingReference("products", key.product)
+		}
+		if err != nil {
+			return err
+		}
+		if stock < qty[key] {
+			return &InsufficientStockError{Product_id: key.product, Variant_id: key.variant, Requested: qty[key], Available: stock}
+		}
+	}
+	for _, key := range keys {
+		s.recordInventory(key, -qty[key], reasonOrderPlaced, orderID, actorID)
+		s.reservations[s.newID("stock_reservations")] = reservationRow{orderID: orderID, productID: key.product, variantID: key.variant, quantity: qty[key], expiresAt: holdUntil}
+	}
+	return nil
+}
+
+// releaseStock puts an order's reserved stock back on sale. Callers must hold
+// the write lock.
+func (s *MemoryStore) releaseStock(orderID int, actorID int, reason string) {
+	var lines []models.OrderProduct
+	for id, res := range s.reservations {
+		if res.orderID == orderID {
+			lines = append(lines, models.OrderProduct{Product_id: res.productID, Variant_id: res.variantID, Quantity: res.quantity})
+			delete(s.reservations, id)
+		}
+	}
+	qty, keys := stockQuantities(lines)
+	for _, key := range keys {
+		s.recordInventory(key, qty[key], reason, orderID, actorID)
+	}
+}
+
+// recordInventory applies delta to the stock of key and logs it in the
+// ledger. Callers must hold the write lock.
+func (s *MemoryStore) recordInventory(key stockKey, delta int, reason string, orderID, actorID int) models.InventoryEntry {
+	var stock int
+	if key.variant != 0 {
+		v := s.variants[key.variant]
+		v.Stock += delta
+		s.variants[key.variant] = v
+		stock = v.Stock
+	} else {
+		p := s.products[key.product]
+		p.Stock += delta
+		s.products[key.product] = p
+		stock = p.Stock
+	}
+	entry := models.InventoryEntry{
+		Entry_id:    s.newID("inventory_ledger"),
+		Product_id:  key.product,
+		Variant_id:  key.variant,
+		Delta:       delta,
+		Stock_after: stock,
+		Reason:      reason,
+		Order_id:    orderID,
+		Actor_id:    actorID,
+		CreatedAt:   time.Now(),
+	}
+	s.inventoryLedger = append(s.inventoryLedger, entry)
+	return entry
+}
+
+func (s *MemoryStore) GetStock(ctx context.Context, productID int) (models.StockLevel, error) {
+	if err := ctx.Err(); err != nil {
+		return models.StockLevel{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.products[productID]
+	if !ok {
+		return models.StockLevel{}, ErrNotFound
+	}
+	level := models.StockLevel{Product_id: productID, Stock: p.Stock}
+	for _, v := range s.productVariants(productID) {
+		level.Variants = append(level.Variants, models.StockLevel{Product_id: productID, Variant_id: v.Variant_id, Stock: v.Stock})
+	}
+	for _, res := range s.reservations {
+		if res.productID != productID {
+			continue
+		}
+		if res.variantID == 0 {
+			level.Reserved += res.quantity
+		}
+		for i := range level.Variants {
+			if level.Variants[i].Variant_id == res.variantID {
+				level.Variants[i].Reserved += res.quantity
+			}
+		}
+	}
+	return level, nil
+}
+
+func (s *MemoryStore) AdjustStock(ctx context.Context, productID, variantID, delta int, reason string, actorID int) (models.InventoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return models.InventoryEntry{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := stockKey{productID, variantID}
+	stock, err := s.lineStock(key)
+	if err != nil {
+		return models.InventoryEntry{}, err
+	}
+	if stock+delta < 0 {
+		return models.InventoryEntry{}, &InsufficientStockError{Product_id: productID, Variant_id: variantID, Requested: -delta, Available: stock}
+	}
+	return s.recordInventory(key, delta, reason, 0, actorID), nil
+}
+
+func (s *MemoryStore) ListInventoryLedger(ctx context.Context, productID int, page PageRequest) (models.Page[models.InventoryEntry], error) {
+	if err := ctx.Err(); err != nil {
+		return models.Page[models.InventoryEntry]{}, dbError(err)
+	}
+	after, hasCursor, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.InventoryEntry]{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.products[productID]; !ok {
+		return models.Page[models.InventoryEntry]{}, ErrNotFound
+	}
+	var entries []models.InventoryEntry
+	var keys []cursor
+	for i := len(s.inventoryLedger) - 1; i >= 0; i-- {
+		if e := s.inventoryLedger[i]; e.Product_id == productID {
+			entries = append(entries, e)
+			keys = append(keys, cursor{ID: e.Entry_id})
+		}
+	}
+	return pageFrom(entries, keys, page.limit(), func(i int) bool {
+		return !hasCursor || keys[i].ID < after.ID
+	}), nil
+}
+
+func (s *MemoryStore) ExpireReservations(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	orders := map[int]bool{}
+	for _, res := range s.reservations {
+		if !res.expiresAt.After(now) {
+			orders[res.orderID] = true
+		}
+	}
+	expired := 0
+	for _, id := range sortedKeys(orders) {
+		if _, err := s.transitionOrder(id, models.OrderCancelled, 0, "reservation expired"); err == nil {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// ******************************variants*************************************
+// productVariants returns the variants of productID in variant_id order.
+// Callers must hold the lock.
+func (s *MemoryStore) productVariants(productID int) []models.ProductVariant {
+	var variants []models.ProductVariant
+	for _, id := range sortedKeys(s.variants) {
+		if v := s.variants[id]; v.Product_id == productID {
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+// checkVariant enforces the unique SKU and per-product option set, and keeps a
+// price override in the product's currency. Callers must hold the lock.
+func (s *MemoryStore) checkVariant(v models.ProductVariant) error {
+	if p := s.products[v.Product_id]; v.Price != nil && v.Price.Currency != p.Price.Currency {
+		return currencyMismatch("product_variants_currency_fkey", v.Price.Currency, p.Price.Currency)
+	}
+	for id, other := range s.variants {
+		if id == v.Variant_id {
+			continue
+		}
+		if other.Sku == v.Sku {
+			return &ConstraintError{Kind: ErrConflict, Constraint: "product_variants_sku_key", Err: fmt.Errorf("sku %q is taken", v.Sku)}
+		}
+		if other.Product_id == v.Product_id && sameOptions(other.Options, v.Options) {
+			return &ConstraintError{Kind: ErrConflict, Constraint: "product_variants_product_id_options_key", Err: fmt.Errorf("product %d already has a variant with these options", v.Product_id)}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListVariants(ctx context.Context, productID int) ([]models.ProductVariant, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.products[productID]; !ok {
+		return nil, ErrNotFound
+	}
+	variants := s.productVariants(productID)
+	if variants == nil {
+		variants = []models.ProductVariant{}
+	}
+	return variants, nil
+}
+
+func (s *MemoryStore) CreateVariant(ctx context.Context, v models.ProductVariant) (models.ProductVariant, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ProductVariant{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[v.Product_id]; !ok {
+		return models.ProductVariant{}, ErrNotFound
+	}
+	v.Variant_id = 0
+	if err := s.checkVariant(v); err != nil {
+		return models.ProductVariant{}, err
+	}
+	v.Variant_id = s.newID("product_variants")
+	v.Stock = 0
+	s.variants[v.Variant_id] = v
+	return v, nil
+}
+
+func (s *MemoryStore) UpdateVariant(ctx context.Context, v models.ProductVariant) (models.ProductVariant, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ProductVariant{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.variants[v.Variant_id]
+	if !ok || existing.Product_id != v.Product_id {
+		return models.ProductVariant{}, ErrNotFound
+	}
+	if err := s.checkVariant(v); err != nil {
+		return models.ProductVariant{}, err
+	}
+	v.Stock = existing.Stock
+	s.variants[v.Variant_id] = v
+	return v, nil
+}
+
+func (s *MemoryStore) DeleteVariant(ctx context.Context, productID, variantID int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.variants[variantID]; !ok || v.Product_id != productID {
+		return ErrNotFound
+	}
+	for _, op := range s.orderProducts {
+		if op.Variant_id == variantID {
+			return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: "order_product_variant_id_fkey", Err: fmt.Errorf("variant %d is referenced by order_product", variantID)}
+		}
+	}
+	for cpID, cp := range s.cartProducts {
+		if cp.Variant_id == variantID {
+			delete(s.cartProducts, cpID)
+		}
+	}
+	ledger := s.inventoryLedger[:0]
+	for _, e := range s.inventoryLedger {
+		if e.Variant_id != variantID {
+			ledger = append(ledger, e)
+		}
+	}
+	s.inventoryLedger = ledger
+	delete(s.variants, variantID)
+	return nil
+}
+
+// ******************************images*************************************
+// productImages returns the gallery of productID in position order. Callers
+// must hold the lock.
+func (s *MemoryStore) productImages(productID int) []models.ProductImage {
+	images := []models.ProductImage{}
+	for _, img := range s.images {
+		if img.Product_id == productID {
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Position < images[j].Position })
+	return images
+}
+
+func (s *MemoryStore) ListProductImages(ctx context.Context, productID int) ([]models.ProductImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.products[productID]; !ok {
+		return nil, ErrNotFound
+	}
+	return s.productImages(productID), nil
+}
+
+func (s *MemoryStore) AddProductImage(ctx context.Context, img models.ProductImage) (models.ProductImage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[img.Product_id]; !ok {
+		return models.ProductImage{}, ErrNotFound
+	}
+	n := len(s.productImages(img.Product_id))
+	if n >= MaxProductImages {
+		return models.ProductImage{}, ErrTooManyImages
+	}
+	img.Image_id = s.newID("product_images")
+	img.Position = n
+	img.CreatedAt = time.Now()
+	s.images[img.Image_id] = img
+	return img, nil
+}
+
+func (s *MemoryStore) UpdateProductImage(ctx context.Context, productID, imageID int, altText string, position int) (models.ProductImage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img, ok := s.images[imageID]
+	if !ok || img.Product_id != productID {
+		return models.ProductImage{}, ErrNotFound
+	}
+	gallery := s.productImages(productID)
+	from, to := img.Position, clampPosition(position, len(gallery))
+	for _, other := range gallery {
+		switch {
+		case to < from && other.Position >= to && other.Position < from:
+			other.Position++
+		case to > from && other.Position > from && other.Position <= to:
+			other.Position--
+		default:
+			continue
+		}
+		s.images[other.Image_id] = other
+	}
+	img.Alt_text = altText
+	img.Position = to
+	s.images[imageID] = img
+	return img, nil
+}
+
+func (s *MemoryStore) DeleteProductImage(ctx context.Context, productID, imageID int) (models.ProductImage, error) {
+	if err := ctx.Err(); err != nil {
+		return models.ProductImage{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img, ok := s.images[imageID]
+	if !ok || img.Product_id != productID {
+		return models.ProductImage{}, ErrNotFound
+	}
+	delete(s.images, imageID)
+	for id, other := range s.images {
+		if other.Product_id == productID && other.Position > img.Position {
+			other.Position--
+			s.images[id] = other
+		}
+	}
+	return img, nil
+}
+
+// ******************************credit cards*************************************
+func (s *MemoryStore) AddCreditCard(ctx context.Context, userID int, card models.CreditCard) (models.CreditCard, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CreditCard{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return models.CreditCard{}, missingReference("users", userID)
+	}
+	card.Card_id = s.newID("credit_card")
+	card.User_id = userID
+	card.Is_default = true
+	for _, c := range s.creditCards {
+		if c.User_id == userID {
+			card.Is_default = false
+			break
+		}
+	}
+	card.CreatedAt = time.Now()
+	s.creditCards[card.Card_id] = card
+	return card, nil
+}
+
+func (s *MemoryStore) ListCreditCards(ctx context.Context, userID int) ([]models.CreditCard, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cards []models.CreditCard
+	for _, id := range sortedKeys(s.creditCards) {
+		card := s.creditCards[id]
+		if card.User_id != userID {
+			continue
+		}
+		if card.Is_default {
+			cards = append([]models.CreditCard{card}, cards...)
+		} else {
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+func (s *MemoryStore) GetCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CreditCard{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	card, ok := s.creditCards[cardID]
+	if !ok || card.User_id != userID {
+		return models.CreditCard{}, ErrNotFound
+	}
+	return card, nil
+}
+
+func (s *MemoryStore) GetDefaultCreditCard(ctx context.Context, userID int) (models.CreditCard, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CreditCard{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, card := range s.creditCards {
+		if card.User_id == userID && card.Is_default {
+			return card, nil
+		}
+	}
+	return models.CreditCard{}, ErrNotFound
+}
+
+func (s *MemoryStore) SetDefaultCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CreditCard{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	card, ok := s.creditCards[cardID]
+	if !ok || card.User_id != userID {
+		return models.CreditCard{}, ErrNotFound
+	}
+	for id, c := range s.creditCards {
+		if c.User_id == userID && c.Is_default {
+			c.Is_default = false
+			s.creditCards[id] = c
+		}
+	}
+	card.Is_default = true
+	s.creditCards[cardID] = card
+	return card, nil
+}
+
+func (s *MemoryStore) DeleteCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CreditCard{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	card, ok := s.creditCards[cardID]
+	if !ok || card.User_id != userID {
+		return models.CreditCard{}, ErrNotFound
+	}
+	delete(s.creditCards, cardID)
+	return card, nil
+}
+
+// ******************************payments*************************************
+func (s *MemoryStore) CreatePayment(ctx context.Context, p models.Payment) (models.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Payment{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[p.Order_id]
+	if !ok {
+		return models.Payment{}, missingReference("orders", p.Order_id)
+	}
+	if p.Amount.Currency != o.TotalPrice.Currency {
+		return models.Payment{}, currencyMismatch("payments_currency_fkey", p.Amount.Currency, o.TotalPrice.Currency)
+	}
+	if _, ok := s.creditCards[p.Card_id]; !ok {
+		return models.Payment{}, missingReference("credit_card", p.Card_id)
+	}
+	p.Payment_id = s.newID("payments")
+	p.CreatedAt = time.Now()
+	s.payments[p.Payment_id] = p
+	return p, nil
+}
+
+func (s *MemoryStore) GetPayment(ctx context.Context, paymentID int) (models.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Payment{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.payments[paymentID]
+	if !ok {
+		return models.Payment{}, ErrNotFound
+	}
+	return p, nil
+}
+
+func (s *MemoryStore) ListOrderPayments(ctx context.Context, orderID int) ([]models.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var payments []models.Payment
+	for _, id := range sortedKeys(s.payments) {
+		if p := s.payments[id]; p.Order_id == orderID {
+			payments = append(payments, p)
+		}
+	}
+	return payments, nil
+}
+
+func (s *MemoryStore) SetPaymentStatus(ctx context.Context, paymentID int, status, providerRef string) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[paymentID]
+	if !ok {
+		return ErrNotFound
+	}
+	p.Status = status
+	if providerRef != "" {
+		p.Provider_ref = providerRef
+	}
+	s.payments[paymentID] = p
+	return nil
+}
+
+func (s *MemoryStore) MarkPaymentCaptured(ctx context.Context, paymentID int, providerRef string, actorID int) (models.Payment, error) {
+	return s.settle(ctx, paymentID, models.PaymentCaptured, providerRef, models.OrderPaid, actorID)
+}
+
+func (s *MemoryStore) ClaimRefund(ctx context.Context, paymentID int) (models.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Payment{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[paymentID]
+	if !ok {
+		return models.Payment{}, ErrNotFound
+	}
+	order, ok := s.orders[p.Order_id]
+	if !ok {
+		return models.Payment{}, ErrNotFound
+	}
+	if p.Status != models.PaymentCaptured || !CanTransition(order.Status, models.OrderRefunded) {
+		return models.Payment{}, ErrNotRefundable
+	}
+	p.Status = models.PaymentRefundPending
+	s.payments[paymentID] = p
+	return p, nil
+}
+
+func (s *MemoryStore) MarkPaymentRefunded(ctx context.Context, paymentID int, actorID int) (models.Payment, error) {
+	return s.settle(ctx, paymentID, models.PaymentRefunded, "", models.OrderRefunded, actorID)
+}
+
+func (s *MemoryStore) settle(ctx context.Context, paymentID int, paymentStatus, providerRef, orderStatus string, actorID int) (models.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Payment{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[paymentID]
+	if !ok {
+		return models.Payment{}, ErrNotFound
+	}
+	if _, err := s.transitionOrder(p.Order_id, orderStatus, actorID, "payment "+paymentStatus); err != nil {
+		return models.Payment{}, err
+	}
+
+	p.Status = paymentStatus
+	if providerRef != "" {
+		p.Provider_ref = providerRef
+	}
+	s.payments[paymentID] = p
+	return p, nil
+}
+
+// ******************************categories and tags*************************************
+
+// categorySubtree returns the ids of the category with slug and of all its
+// descendants; it is empty when no category has that slug. Callers must hold
+// the lock.
+func (s *MemoryStore) categorySubtree(slug string) map[int]bool {
+	ids := map[int]bool{}
+	for _, c := range s.categories {
+		if c.Slug == slug {
+			s.addSubtree(ids, c.Category_id)
+		}
+	}
+	return ids
+}
+
+func (s *MemoryStore) addSubtree(ids map[int]bool, id int) {
+	ids[id] = true
+	for _, c := range s.categories {
+		if c.Parent_id == id && !ids[c.Category_id] {
+			s.addSubtree(ids, c.Category_id)
+		}
+	}
+}
+
+// tagIDs returns the id of the tag with slug, as a set.
+func (s *MemoryStore) tagIDs(slug string) map[int]bool {
+	ids := map[int]bool{}
+	for _, t := range s.tags {
+		if t.Slug == slug {
+			ids[t.Tag_id] = true
+		}
+	}
+	return ids
+}
+
+// hasLink reports whether a product's links include one of wanted. An empty
+// slug means the filter is not set and always matches.
+func hasLink(links, wanted map[int]bool, slug string) bool {
+	if slug == "" {
+		return true
+	}
+	for id := range links {
+		if wanted[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) ListCategories(ctx context.Context) ([]models.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	categories := []models.Category{}
+	for _, id := range sortedKeys(s.categories) {
+		categories = append(categories, s.categories[id])
+	}
+	sort.SliceStable(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+func (s *MemoryStore) GetCategoryBySlug(ctx context.Context, slug string) (models.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Category{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.categories {
+		if c.Slug == slug {
+			return c, nil
+		}
+	}
+	return models.Category{}, ErrNotFound
+}
+
+// checkCategory enforces the categories constraints for c. Callers must hold
+// the write lock.
+func (s *MemoryStore) checkCategory(c models.Category) error {
+	for _, other := range s.categories {
+		if other.Slug == c.Slug && other.Category_id != c.Category_id {
+			return &ConstraintError{Kind: ErrConflict, Constraint: "categories_slug_key", Column: "slug", Err: fmt.Errorf("duplicate slug %q", c.Slug)}
+		}
+	}
+	if _, ok := s.categories[c.Parent_id]; c.Parent_id != 0 && !ok {
+		return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: "categories_parent_id_fkey", Err: fmt.Errorf("category %d does not exist", c.Parent_id)}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateCategory(ctx context.Context, c models.Category) (models.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Category{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCategory(c); err != nil {
+		return models.Category{}, err
+	}
+	c.Category_id = s.newID("categories")
+	c.CreatedAt = time.Now()
+	c.Children = nil
+	s.categories[c.Category_id] = c
+	return c, nil
+}
+
+func (s *MemoryStore) UpdateCategory(ctx context.Context, c models.Category) (models.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Category{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.categories[c.Category_id]
+	if !ok {
+		return models.Category{}, ErrNotFound
+	}
+	if c.Parent_id != 0 {
+		subtree := map[int]bool{}
+		s.addSubtree(subtree, c.Category_id)
+		if subtree[c.Parent_id] {
+			return models.Category{}, ErrCategoryCycle
+		}
+	}
+	if err := s.checkCategory(c); err != nil {
+		return models.Category{}, err
+	}
+	existing.Parent_id, existing.Name, existing.Slug = c.Parent_id, c.Name, c.Slug
+	s.categories[c.Category_id] = existing
+	return existing, nil
+}
+
+func (s *MemoryStore) DeleteCategory(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.categories[id]; !ok {
+		return ErrNotFound
+	}
+	for _, c := range s.categories {
+		if c.Parent_id == id {
+			return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: "categories_parent_id_fkey", Err: fmt.Errorf("category %d has children", id)}
+		}
+	}
+	for _, links := range s.productCategories {
+		delete(links, id)
+	}
+	for _, links := range s.couponCategories {
+		delete(links, id)
+	}
+	delete(s.categories, id)
+	return nil
+}
+
+func (s *MemoryStore) ListTags(ctx context.Context) ([]models.Tag, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tags := []models.Tag{}
+	for _, id := range sortedKeys(s.tags) {
+		tags = append(tags, s.tags[id])
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (s *MemoryStore) checkTag(t models.Tag) error {
+	for _, other := range s.tags {
+		if other.Slug == t.Slug && other.Tag_id != t.Tag_id {
+			return &ConstraintError{Kind: ErrConflict, Constraint: "tags_slug_key", Column: "slug", Err: fmt.Errorf("duplicate slug %q", t.Slug)}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateTag(ctx context.Context, t models.Tag) (models.Tag, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Tag{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkTag(t); err != nil {
+		return models.Tag{}, err
+	}
+	t.Tag_id = s.newID("tags")
+	s.tags[t.Tag_id] = t
+	return t, nil
+}
+
+func (s *MemoryStore) UpdateTag(ctx context.Context, t models.Tag) (models.Tag, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Tag{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tags[t.Tag_id]; !ok {
+		return models.Tag{}, ErrNotFound
+	}
+	if err := s.checkTag(t); err != nil {
+		return models.Tag{}, err
+	}
+	s.tags[t.Tag_id] = t
+	return t, nil
+}
+
+func (s *MemoryStore) DeleteTag(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tags[id]; !ok {
+		return ErrNotFound
+	}
+	for _, links := range s.productTags {
+		delete(links, id)
+	}
+	delete(s.tags, id)
+	return nil
+}
+
+func (s *MemoryStore) SetProductCategories(ctx context.Context, productID int, slugs []string) ([]string, error) {
+	return s.setProductLinks(ctx, productID, slugs, s.productCategories, func(slug string) (int, bool) {
+		for _, c := range s.categories {
+			if c.Slug == slug {
+				return c.Category_id, true
+			}
+		}
+		return 0, false
+	}, ErrUnknownCategory)
+}
+
+func (s *MemoryStore) SetProductTags(ctx context.Context, productID int, slugs []string) ([]string, error) {
+	return s.setProductLinks(ctx, productID, slugs, s.productTags, func(slug string) (int, bool) {
+		for _, t := range s.tags {
+			if t.Slug == slug {
+				return t.Tag_id, true
+			}
+		}
+		return 0, false
+	}, ErrUnknownTag)
+}
+
+// setProductLinks replaces links[productID] with the ids lookup finds for
+// slugs. lookup runs with the write lock held.
+func (s *MemoryStore) setProductLinks(ctx context.Context, productID int, slugs []string, links map[int]map[int]bool, lookup func(string) (int, bool), unknown error) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	slugs = uniqueSlugs(slugs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.products[productID]; !ok {
+		return nil, ErrNotFound
+	}
+	ids := map[int]bool{}
+	for _, slug := range slugs {
+		id, ok := lookup(slug)
+		if !ok {
+			return nil, unknown
+		}
+		ids[id] = true
+	}
+	links[productID] = ids
+	return slugs, nil
+}
+
+// ******************************coupons*************************************
+
+// coupon returns the coupon with id as the Postgres couponColumns render it.
+// Callers must hold the lock.
+func (s *MemoryStore) coupon(id int) models.Coupon {
+	c := s.coupons[id]
+	c.Categories = nil
+	for categoryID := range s.couponCategories[id] {
+		c.Categories = append(c.Categories, s.categories[categoryID].Slug)
+	}
+	sort.Strings(c.Categories)
+	c.Times_used = s.couponUsage(id, 0).Total
+	return c
+}
+
+// couponUsage counts the orders that used a coupon and are not cancelled.
+// Callers must hold the lock.
+func (s *MemoryStore) couponUsage(couponID, userID int) pricing.Usage {
+	var usage pricing.Usage
+	for orderID, id := range s.orderCoupons {
+		o := s.orders[orderID]
+		if id != couponID || o.Status == models.OrderCancelled {
+			continue
+		}
+		usage.Total++
+		if o.User_id == userID {
+			usage.ByUser++
+		}
+	}
+	return usage
+}
+
+// checkCoupon enforces the coupons constraints and resolves c's category
+// slugs to ids. Callers must hold the write lock.
+func (s *MemoryStore) checkCoupon(c models.Coupon) (map[int]bool, error) {
+	for _, other := range s.coupons {
+		if other.Code == c.Code && other.Coupon_id != c.Coupon_id {
+			return nil, &ConstraintError{Kind: ErrConflict, Constraint: "coupons_code_key", Column: "code", Err: fmt.Errorf("duplicate code %q", c.Code)}
+		}
+	}
+	for _, id := range c.Product_ids {
+		if _, ok := s.products[id]; !ok {
+			return nil, ErrUnknownProduct
+		}
+	}
+	categoryIDs := map[int]bool{}
+	for _, slug := range c.Categories {
+		ids := map[int]bool{}
+		for _, cat := range s.categories {
+			if cat.Slug == slug {
+				ids[cat.Category_id] = true
+			}
+		}
+		if len(ids) == 0 {
+			return nil, ErrUnknownCategory
+		}
+		for id := range ids {
+			categoryIDs[id] = true
+		}
+	}
+	return categoryIDs, nil
+}
+
+func (s *MemoryStore) ListCoupons(ctx context.Context, page PageRequest) (models.Page[models.Coupon], error) {
+	if err := ctx.Err(); err != nil {
+		return models.Page[models.Coupon]{}, dbError(err)
+	}
+	after, _, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.Coupon]{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var coupons []models.Coupon
+	var keys []cursor
+	for _, id := range sortedKeys(s.coupons) {
+		coupons = append(coupons, s.coupon(id))
+		keys = append(keys, cursor{ID: id})
+	}
+	return pageFrom(coupons, keys, page.limit(), func(i int) bool {
+		return keys[i].ID > after.ID
+	}), nil
+}
+
+func (s *MemoryStore) GetCoupon(ctx context.Context, id int) (models.Coupon, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.coupons[id]; !ok {
+		return models.Coupon{}, ErrNotFound
+	}
+	return s.coupon(id), nil
+}
+
+func (s *MemoryStore) CreateCoupon(ctx context.Context, c models.Coupon) (models.Coupon, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	c.Product_ids, c.Categories = uniqueIDs(c.Product_ids), uniqueSlugs(c.Categories)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.Coupon_id = 0
+	categoryIDs, err := s.checkCoupon(c)
+	if err != nil {
+		return models.Coupon{}, err
+	}
+	c.Coupon_id = s.newID("coupons")
+	c.CreatedAt = time.Now()
+	s.coupons[c.Coupon_id] = c
+	s.couponCategories[c.Coupon_id] = categoryIDs
+	return s.coupon(c.Coupon_id), nil
+}
+
+func (s *MemoryStore) UpdateCoupon(ctx context.Context, c models.Coupon) (models.Coupon, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Coupon{}, dbError(err)
+	}
+	c.Product_ids, c.Categories = uniqueIDs(c.Product_ids), uniqueSlugs(c.Categories)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.coupons[c.Coupon_id]
+	if !ok {
+		return models.Coupon{}, ErrNotFound
+	}
+	categoryIDs, err := s.checkCoupon(c)
+	if err != nil {
+		return models.Coupon{}, err
+	}
+	c.CreatedAt = existing.CreatedAt
+	s.coupons[c.Coupon_id] = c
+	s.couponCategories[c.Coupon_id] = categoryIDs
+	return s.coupon(c.Coupon_id), nil
+}
+
+func (s *MemoryStore) DeleteCoupon(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.coupons[id]; !ok {
+		return ErrNotFound
+	}
+	for cartID, couponID := range s.cartCoupons {
+		if couponID == id {
+			delete(s.cartCoupons, cartID)
+		}
+	}
+	for orderID, couponID := range s.orderCoupons {
+		if couponID == id {
+			delete(s.orderCoupons, orderID)
+		}
+	}
+	for discountID, d := range s.orderDiscounts {
+		if d.Coupon_id == id {
+			d.Coupon_id = 0
+			s.orderDiscounts[discountID] = d
+		}
+	}
+	delete(s.couponCategories, id)
+	delete(s.coupons, id)
+	return nil
+}
+
+func (s *MemoryStore) ApplyCartCoupon(ctx context.Context, userID int, code string) (models.CartSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartSummary{}, dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	couponID := 0
+	for id, c := range s.coupons {
+		if c.Code == code {
+			couponID = id
+		}
+	}
+	if couponID == 0 {
+		return models.CartSummary{}, ErrNotFound
+	}
+	c := s.coupon(couponID)
+
+	lines, _ := s.cartLines(s.findUserCart(userID))
+	if len(lines) == 0 {
+		return models.CartSummary{}, ErrEmptyCart
+	}
+	discounts, err := s.couponDiscounts(c, userID, lines)
+	if err != nil {
+		return models.CartSummary{}, err
+	}
+	summary, err := pricing.Summarize(lines, c.Code, discounts)
+	if err != nil {
+		return models.CartSummary{}, err
+	}
+	for cartID, cart := range s.carts {
+		if cart.User_id == userID {
+			s.cartCoupons[cartID] = couponID
+		}
+	}
+	return summary, nil
+}
+
+func (s *MemoryStore) RemoveCartCoupon(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return dbError(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cartID, cart := range s.carts {
+		if cart.User_id == userID {
+			delete(s.cartCoupons, cartID)
+		}
+	}
+	return nil
+}
+
+// cartLines mirrors the Postgres cartLines. Callers must hold the lock.
+func (s *MemoryStore) cartLines(cartID int) ([]models.CartLine, []int) {
+	var lines []models.CartLine
+	var ids []int
+	for _, id := range sortedKeys(s.cartProducts) {
+		cp := s.cartProducts[id]
+		if cp.Cart_id != cartID {
+			continue
+		}
+		p, ok := s.products[cp.Product_id]
+		if !ok {
+			continue
+		}
+		price, img := p.Price, p.Img_url
+		if v, ok := s.variants[cp.Variant_id]; ok {
+			if v.Price != nil {
+				price = *v.Price
+			}
+			if v.Img_url != "" {
+				img = v.Img_url
+			}
+		}
+		lines = append(lines, models.CartLine{
+			CP_id:        id,
+			Product_id:   cp.Product_id,
+			Variant_id:   cp.Variant_id,
+			Product_name: p.Product_name,
+			Img_url:      img,
+			Quantity:     cp.Quantity,
+			Unit_price:   price,
+			Weight_grams: p.Weight_grams,
+		})
+		ids = append(ids, id)
+	}
+	return lines, ids
+}
+
+// userCartCoupon returns the coupon applied to the user's first cart that has
+// one, or 0. Callers must hold the lock.
+func (s *MemoryStore) userCartCoupon(userID int) int {
+	for _, cartID := range sortedKeys(s.carts) {
+		if couponID, ok := s.cartCoupons[cartID]; ok && s.carts[cartID].User_id == userID {
+			return couponID
+		}
+	}
+	return 0
+}
+
+// couponDiscounts mirrors the Postgres couponDiscounts. Callers must hold the
+// lock.
+func (s *MemoryStore) couponDiscounts(c models.Coupon, userID int, lines []models.CartLine) ([]models.OrderDiscount, error) {
+	subtotal, err := pricing.Subtotal(lines)
+	if err != nil {
+		return nil, err
+	}
+	if err := pricing.CheckCoupon(c, time.Now(), subtotal, s.couponUsage(c.Coupon_id, userID)); err != nil {
+		return nil, err
+	}
+
+	products := map[int]bool{}
+	for _, id := range c.Product_ids {
+		products[id] = true
+	}
+	categories := map[int]bool{}
+	for id := range s.couponCategories[c.Coupon_id] {
+		s.addSubtree(categories, id)
+	}
+	everything := len(products) == 0 && len(categories) == 0
+
+	return pricing.Discounts(c, lines, func(productID int) bool {
+		if everything || products[productID] {
+			return true
+		}
+		for id := range s.productCategories[productID] {
+			if categories[id] {
+				return true
+			}
+		}
+		return false
+	})
+}
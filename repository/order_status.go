@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"my-go-project/models"
+)
+
+// ErrInvalidTransition is returned when an order cannot move from its current
+// status to the requested one.
+var ErrInvalidTransition = errors.New("order status transition not allowed")
+
+// orderTransitions lists, for each order status, the statuses it may move to.
+// cancelled and refunded are final.
+var orderTransitions = map[string][]string{
+	models.OrderPending:   {models.OrderPaid, models.OrderCancelled},
+	models.OrderPaid:      {models.OrderFulfilled, models.OrderRefunded},
+	models.OrderFulfilled: {models.OrderShipped, models.OrderRefunded},
+	models.OrderShipped:   {models.OrderDelivered},
+	models.OrderDelivered: {models.OrderRefunded},
+	models.OrderCancelled: nil,
+	models.OrderRefunded:  nil,
+}
+
+// ValidOrderStatus reports whether status is one of the order lifecycle states.
+func ValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an order in status from may move to status to.
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// nullableID stores a missing (zero) id as NULL.
+func nullableID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// recordStatus appends an entry to the order's timeline.
+func recordStatus(ctx context.Context, tx pgx.Tx, orderID int, from, to string, actorID int, note string) error {
+	var fromStatus *string
+	if from != "" {
+		fromStatus = &from
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO order_status_history (order_id, from_status, to_status, actor_id, note) VALUES ($1, $2, $3, $4, $5)`,
+		orderID, fromStatus, to, nullableID(actorID), note)
+	return err
+}
+
+// transitionOrder moves an order to status to inside tx, locking the row and
+// checking the transition table first. Cancelling an order puts its reserved
+// stock back on sale; paying for it makes the reservation final. It returns
+// the updated order.
+func transitionOrder(ctx context.Context, tx pgx.Tx, orderID int, to string, actorID int, note string) (models.Orders, error) {
+	var order models.Orders
+	err := tx.QueryRow(ctx,
+		`SELECT order_id, COALESCE(user_id, 0), total_price, currency, status, create_at FROM orders WHERE order_id = $1 FOR UPDATE`,
+		orderID,
+	).Scan(&order.Order_id, &order.User_id, &order.TotalPrice.Amount, &order.TotalPrice.Currency, &order.Status, &order.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Orders{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Orders{}, err
+	}
+
+	if !CanTransition(order.Status, to) {
+		return models.Orders{}, ErrInvalidTransition
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE orders SET status = $1 WHERE order_id = $2`, to, orderID); err != nil {
+		return models.Orders{}, err
+	}
+	if err := recordStatus(ctx, tx, orderID, order.Status, to, actorID, note); err != nil {
+		return models.Orders{}, err
+	}
+
+	switch to {
+	case models.OrderCancelled:
+		reason := reasonOrderCancelled
+		if note != "" {
+			reason += ": " + note
+		}
+		if err := releaseStock(ctx, tx, orderID, actorID, reason); err != nil {
+			return models.Orders{}, err
+		}
+	case models.OrderPaid:
+		if err := consumeStock(ctx, tx, orderID); err != nil {
+			return models.Orders{}, err
+		}
+	}
+
+	order.Status = to
+	return order, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"my-go-project/models"
+	"strings"
+)
+
+const (
+	// DefaultPageLimit is the page size when a request does not set one.
+	DefaultPageLimit = 20
+	// MaxPageLimit caps the page size a client can ask for.
+	MaxPageLimit = 100
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued by a previous
+// page of the same list and sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageRequest asks for the page after Cursor, which is empty for the first
+// page. Limit is clamped to 1..MaxPageLimit, with 0 meaning DefaultPageLimit.
+type PageRequest struct {
+	Limit  int
+	Cursor string
+}
+
+func (p PageRequest) limit() int {
+	switch {
+	case p.Limit <= 0:
+		return DefaultPageLimit
+	case p.Limit > MaxPageLimit:
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// cursor is the position of the last row of a page: the value of the sort
+// column (N or S, whichever it is) and the row id that breaks ties. Sort
+// records the ordering it belongs to so a cursor cannot be replayed against
+// another one. Clients only ever see it base64-encoded.
+type cursor struct {
+	Sort string `json:"s,omitempty"`
+	N    int    `json:"n,omitempty"`
+	S    string `json:"t,omitempty"`
+	ID   int    `json:"id"`
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses the cursor of req. ok is false for a first page.
+func decodeCursor(req PageRequest, sort string) (c cursor, ok bool, err error) {
+	if req.Cursor == "" {
+		return cursor{}, false, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+	if err != nil {
+		return cursor{}, false, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort || c.ID <= 0 {
+		return cursor{}, false, ErrInvalidCursor
+	}
+	return c, true, nil
+}
+
+// newPage builds a page from rows fetched with one extra row beyond limit:
+// keys[i] is the cursor of rows[i], and the extra row, when present, only
+// tells us there is a next page.
+func newPage[T any](rows []T, keys []cursor, limit, total int) models.Page[T] {
+	page := models.Page[T]{Items: rows, Total: total}
+	if len(rows) > limit {
+		page.Items = rows[:limit]
+		page.Next_cursor = keys[limit-1].encode()
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page
+}
+
+// whereClause joins SQL conditions with AND, or returns "" when there are none.
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"my-go-project/config"
+	"my-go-project/models"
+	"my-go-project/money"
+	"my-go-project/pricing"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	priceCursor := cursor{Sort: SortPrice, N: 1999, ID: 7}
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		cursor  string
+		sort    string
+		want    cursor
+		wantOK  bool
+		wantErr error
+	}{
+		{"first page", "", SortPrice, cursor{}, false, nil},
+		{"round trip", priceCursor.encode(), SortPrice, priceCursor, true, nil},
+		{"round trip by id", cursor{ID: 42}.encode(), "", cursor{ID: 42}, true, nil},
+		{"round trip by name", cursor{Sort: SortName, S: "Mug", ID: 3}.encode(), SortName, cursor{Sort: SortName, S: "Mug", ID: 3}, true, nil},
+		{"another sort", priceCursor.encode(), SortName, cursor{}, false, ErrInvalidCursor},
+		{"sorted cursor on an id list", priceCursor.encode(), "", cursor{}, false, ErrInvalidCursor},
+		{"id cursor on a sorted list", cursor{ID: 42}.encode(), SortPrice, cursor{}, false, ErrInvalidCursor},
+		{"not base64", "not*base64!", "", cursor{}, false, ErrInvalidCursor},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"id":1}`)), "", cursor{}, false, ErrInvalidCursor},
+		{"not json", raw("id=1"), "", cursor{}, false, ErrInvalidCursor},
+		{"wrong type", raw(`{"id":"1"}`), "", cursor{}, false, ErrInvalidCursor},
+		{"no id", raw(`{"n":5}`), "", cursor{}, false, ErrInvalidCursor},
+		{"negative id", raw(`{"id":-1}`), "", cursor{}, false, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := decodeCursor(PageRequest{Cursor: tt.cursor}, tt.sort)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("got %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func newTestStore() *MemoryStore {
+	return NewMemoryStore(
+		config.JWTConfig{Secret: "0123456789abcdef", TTL: time.Hour, RefreshTTL: 24 * time.Hour},
+		config.InventoryConfig{HoldTTL: time.Minute, SweepInterval: time.Minute},
+		config.GuestCartConfig{TTL: time.Hour, SweepInterval: time.Minute, Merge: "sum"},
+		nil,
+		pricing.NewCalculator(config.ShippingConfig{}, config.TaxConfig{}),
+	)
+}
+
+// walk follows Next_cursor from the first page to the last and returns the
+// ids of every item in the order they were listed.
+func walk[T any](t *testing.T, list func(PageRequest) (models.Page[T], error), id func(T) int) []int {
+	t.Helper()
+	var ids []int
+	req := PageRequest{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("pagination does not end")
+		}
+		page, err := list(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range page.Items {
+			ids = append(ids, id(item))
+		}
+		if page.Next_cursor == "" {
+			return ids
+		}
+		req.Cursor = page.Next_cursor
+	}
+}
+
+func sameIDs(got, want []int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestProductPagesBreakTiesOnID(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore()
+	// products 2, 3 and 4 share a price, so only their ids order them
+	for _, cents := range []int64{500, 999, 999, 999, 100} {
+		if _, err := s.CreateProduct(ctx, models.Products{Product_name: "Tee", Price: money.New(cents, "USD")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{SortPrice, []int{5, 1, 2, 3, 4}},
+		{SortPriceDesc, []int{4, 3, 2, 1, 5}},
+		{SortName, []int{1, 2, 3, 4, 5}},
+		{SortNameDesc, []int{5, 4, 3, 2, 1}},
+		{SortNewest, []int{5, 4, 3, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			got := walk(t, func(req PageRequest) (models.Page[models.Products], error) {
+				return s.GetAllProducts(ctx, ProductFilter{Sort: tt.sort, PageRequest: req})
+			}, func(p models.Products) int { return p.Product_id })
+			if !sameIDs(got, tt.want) {
+				t.Fatalf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// a cursor only resumes the sort it came from
+	page, err := s.GetAllProducts(ctx, ProductFilter{Sort: SortPrice, PageRequest: PageRequest{Limit: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetAllProducts(ctx, ProductFilter{Sort: SortName, PageRequest: PageRequest{Cursor: page.Next_cursor}})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestProductSalesPages(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore()
+	user, err := s.CreateUser(ctx, models.Users{
+		User_name: "alice",
+		Email:     "alice@example.com",
+		Password:  "secret",
+		Address:   models.Address{Line1: "1 Main St", City: "Los Angeles", Region: "CA", Country: "US"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		p, err := s.CreateProduct(ctx, models.Products{Product_name: "Tee", Price: money.New(1000, "USD")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.AdjustStock(ctx, p.Product_id, 0, 10, "restock", user.User_id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// two checkouts: lines 1-3, then lines 4-5
+	for _, products := range [][]int{{1, 2, 3}, {1, 2}} {
+		for _, id := range products {
+			if _, err := s.AddCartProduct(ctx, user.User_id, models.CartProduct{Product_id: id, Quantity: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Checkout(ctx, user.User_id, models.Delivery{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := walk(t, func(req PageRequest) (models.Page[models.Orders], error) {
+		return s.GetProductSales(ctx, "alice", req)
+	}, func(o models.Orders) int { return o.Order_id })
+	if want := []int{2, 2, 1, 1, 1}; !sameIDs(got, want) {
+		t.Fatalf("orders = %v, want %v", got, want)
+	}
+
+	// a cursor of a sorted product list is not a sales cursor
+	page, err := s.GetAllProducts(ctx, ProductFilter{Sort: SortPrice, PageRequest: PageRequest{Limit: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetProductSales(ctx, "alice", PageRequest{Cursor: page.Next_cursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("err = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log"
+	"my-go-project/models"
+	"time"
+)
+
+// ErrNotRefundable is returned when a payment is not captured, or its order
+// can no longer be refunded.
+var ErrNotRefundable = errors.New("payment cannot be refunded")
+
+type PaymentRepository struct {
+	db      *pgxpool.Pool
+	timeout time.Duration
+}
+
+func NewPaymentRepository(db *pgxpool.Pool, queryTimeout time.Duration) *PaymentRepository {
+	return &PaymentRepository{db: db, timeout: queryTimeout}
+}
+
+const paymentColumns = `payment_id, order_id, COALESCE(card_id, 0), method, amount, currency, status, provider_ref, create_at`
+
+func scanPayment(row pgx.Row) (models.Payment, error) {
+	var p models.Payment
+	err := row.Scan(&p.Payment_id, &p.Order_id, &p.Card_id, &p.Method, &p.Amount.Amount, &p.Amount.Currency, &p.Status, &p.Provider_ref, &p.CreatedAt)
+	return p, err
+}
+
+// ***************************create payment*********************************
+func (r *PaymentRepository) CreatePayment(ctx context.Context, p models.Payment) (models.Payment, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO payments (order_id, card_id, method, amount, currency, status)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING payment_id, create_at`
+
+	err := r.db.QueryRow(ctx, query, p.Order_id, p.Card_id, p.Method, p.Amount.Amount, p.Amount.Currency, p.Status).Scan(&p.Payment_id, &p.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting payment:", err)
+		return models.Payment{}, dbError(err)
+	}
+	return p, nil
+}
+
+// ***************************get payment*********************************
+func (r *PaymentRepository) GetPayment(ctx context.Context, paymentID int) (models.Payment, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	p, err := scanPayment(r.db.QueryRow(ctx, `SELECT `+paymentColumns+` FROM payments WHERE payment_id = $1`, paymentID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Payment{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Payment{}, dbError(err)
+	}
+	return p, nil
+}
+
+// ***************************payments of an order*********************************
+func (r *PaymentRepository) ListOrderPayments(ctx context.Context, orderID int) ([]models.Payment, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.db.Query(ctx, `SELECT `+paymentColumns+` FROM payments WHERE order_id = $1 ORDER BY payment_id`, orderID)
+	if err != nil {
+		log.Println("Error executing query:", err)
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return payments, nil
+}
+
+// ***************************update payment status*********************************
+func (r *PaymentRepository) SetPaymentStatus(ctx context.Context, paymentID int, status, providerRef string) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE payments SET status = $1, provider_ref = COALESCE(NULLIF($2, ''), provider_ref) WHERE payment_id = $3`
+	tag, err := r.db.Exec(ctx, query, status, providerRef, paymentID)
+	if err != nil {
+		log.Println("Error updating payment:", err)
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ***************************payment captured*********************************
+// MarkPaymentCaptured records a successful capture and moves the order to paid
+// in the same transaction. It fails with ErrInvalidTransition, and changes
+// nothing, if the order is no longer pending.
+func (r *PaymentRepository) MarkPaymentCaptured(ctx context.Context, paymentID int, providerRef string, actorID int) (models.Payment, error) {
+	return r.settle(ctx, paymentID, models.PaymentCaptured, providerRef, models.OrderPaid, actorID)
+}
+
+// ***************************claim refund*********************************
+// ClaimRefund moves a captured payment to refund_pending before the provider is
+// asked to refund it. The update only matches a captured payment, so of two
+// refunds of the same payment only one claims it; the other, like a refund of
+// an order that can no longer be refunded, fails with ErrNotRefundable.
+func (r *PaymentRepository) ClaimRefund(ctx context.Context, paymentID int) (models.Payment, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Payment{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := scanPayment(tx.QueryRow(ctx,
+		`UPDATE payments SET status = $1 WHERE payment_id = $2 AND status = $3 RETURNING `+paymentColumns,
+		models.PaymentRefundPending, paymentID, models.PaymentCaptured))
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM payments WHERE payment_id = $1)`, paymentID).Scan(&exists); err != nil {
+			return models.Payment{}, dbError(err)
+		}
+		if !exists {
+			return models.Payment{}, ErrNotFound
+		}
+		return models.Payment{}, ErrNotRefundable
+	}
+	if err != nil {
+		log.Println("Error claiming payment:", err)
+		return models.Payment{}, dbError(err)
+	}
+
+	var orderStatus string
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE order_id = $1 FOR UPDATE`, p.Order_id).Scan(&orderStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Payment{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Payment{}, dbError(err)
+	}
+	if !CanTransition(orderStatus, models.OrderRefunded) {
+		return models.Payment{}, ErrNotRefundable
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Payment{}, dbError(err)
+	}
+	return p, nil
+}
+
+// ***************************payment refunded*********************************
+// MarkPaymentRefunded records a refund claimed with ClaimRefund and moves the
+// order to refunded in the same transaction.
+func (r *PaymentRepository) MarkPaymentRefunded(ctx context.Context, paymentID int, actorID int) (models.Payment, error) {
+	return r.settle(ctx, paymentID, models.PaymentRefunded, "", models.OrderRefunded, actorID)
+}
+
+func (r *PaymentRepository) settle(ctx context.Context, paymentID int, paymentStatus, providerRef, orderStatus string, actorID int) (models.Payment, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Payment{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := scanPayment(tx.QueryRow(ctx,
+		`UPDATE payments SET status = $1, provider_ref = COALESCE(NULLIF($2, ''), provider_ref)
+		 WHERE payment_id = $3
+		 RETURNING `+paymentColumns,
+		paymentStatus, providerRef, paymentID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Payment{}, ErrNotFound
+	}
+	if err != nil {
+		log.Println("Error updating payment:", err)
+		return models.Payment{}, dbError(err)
+	}
+
+	_, err = transitionOrder(ctx, tx, p.Order_id, orderStatus, actorID, "payment "+paymentStatus)
+	if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrNotFound) {
+		return models.Payment{}, err
+	}
+	if err != nil {
+		log.Println("Error updating order status:", err)
+		return models.Payment{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Payment{}, dbError(err)
+	}
+	return p, nil
+}
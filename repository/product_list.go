@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"my-go-project/models"
+	"strings"
+)
+
+// Product sort orders accepted by GetAllProducts. A leading "-" reverses the
+// order; newest lists the most recently created products first.
+const (
+	SortNewest    = "newest"
+	SortPrice     = "price"
+	SortPriceDesc = "-price"
+	SortName      = "name"
+	SortNameDesc  = "-name"
+)
+
+// ProductFilter selects and orders a page of products. Nil prices and empty
+// strings do not filter. Currency is an ISO 4217 code and MinPrice and
+// MaxPrice are minor units of it. Name matches any part of the product name,
+// ignoring case. Category is a category slug and also matches products in its
+// descendant categories; Tag is a tag slug. An empty Sort means SortNewest;
+// the price sorts group products by currency first.
+type ProductFilter struct {
+	Currency string
+	MinPrice *int64
+	MaxPrice *int64
+	Name     string
+	Category string
+	Tag      string
+	Sort     string
+	PageRequest
+}
+
+// productSort orders products by column, then by product_id to break ties. An
+// empty column orders by product_id alone, which follows creation order.
+type productSort struct {
+	column string
+	desc   bool
+}
+
+var productSorts = map[string]productSort{
+	SortNewest:    {desc: true},
+	SortPrice:     {column: "price"},
+	SortPriceDesc: {column: "price", desc: true},
+	SortName:      {column: "product_name"},
+	SortNameDesc:  {column: "product_name", desc: true},
+}
+
+// ValidProductSort reports whether sort is one of the product sort orders.
+func ValidProductSort(sort string) bool {
+	_, ok := productSorts[sort]
+	return ok || sort == ""
+}
+
+func (f ProductFilter) sortName() string {
+	if f.Sort == "" {
+		return SortNewest
+	}
+	return f.Sort
+}
+
+// key is the cursor that resumes the listing right after p.
+func (s productSort) key(sort string, p models.Products) cursor {
+	c := cursor{Sort: sort, ID: p.Product_id}
+	switch s.column {
+	case "price":
+		c.N, c.S = int(p.Price.Amount), p.Price.Currency
+	case "product_name":
+		c.S = p.Product_name
+	}
+	return c
+}
+
+// before reports whether a sorts ahead of b.
+func (s productSort) before(a, b models.Products) bool {
+	var less, greater bool
+	switch s.column {
+	case "price":
+		less, greater = a.Price.Currency < b.Price.Currency, a.Price.Currency > b.Price.Currency
+		if !less && !greater {
+			less, greater = a.Price.Amount < b.Price.Amount, a.Price.Amount > b.Price.Amount
+		}
+	case "product_name":
+		less, greater = a.Product_name < b.Product_name, a.Product_name > b.Product_name
+	}
+	if !less && !greater {
+		less, greater = a.Product_id < b.Product_id, a.Product_id > b.Product_id
+	}
+	if s.desc {
+		return greater
+	}
+	return less
+}
+
+// matches applies the filter's currency, price and name conditions to p.
+// Category and Tag need the link tables and are checked by the store.
+func (f ProductFilter) matches(p models.Products) bool {
+	if f.Currency != "" && p.Price.Currency != f.Currency {
+		return false
+	}
+	if f.MinPrice != nil && p.Price.Amount < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && p.Price.Amount > *f.MaxPrice {
+		return false
+	}
+	return f.Name == "" || strings.Contains(strings.ToLower(p.Product_name), strings.ToLower(f.Name))
+}
+
+// escapeLike quotes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
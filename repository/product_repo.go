@@ -3,336 +3,826 @@ package repository
 import (
 	"context"
 	"errors"
-	"github.com/golang-jwt/jwt/v5"
+	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 	"log"
+	"my-go-project/config"
 	"my-go-project/models"
+	"my-go-project/money"
+	"my-go-project/pricing"
+	"strconv"
 	"time"
 )
 
 type ProductRepository struct {
-	db *pgxpool.Pool
+	db      *pgxpool.Pool
+	timeout time.Duration
 }
 
 type UserRepository struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	jwt       config.JWTConfig
+	inventory config.InventoryConfig
+	guest     config.GuestCartConfig
+	signer    TokenSigner
+	pricing   *pricing.Calculator
+	timeout   time.Duration
 }
 
-func NewProductRepository(db *pgxpool.Pool) *ProductRepository {
-	return &ProductRepository{db: db}
+func NewProductRepository(db *pgxpool.Pool, queryTimeout time.Duration) *ProductRepository {
+	return &ProductRepository{db: db, timeout: queryTimeout}
 }
 
-func NewUserRepository(db *pgxpool.Pool) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *pgxpool.Pool, jwtCfg config.JWTConfig, inventoryCfg config.InventoryConfig, guestCfg config.GuestCartConfig, signer TokenSigner, calc *pricing.Calculator, queryTimeout time.Duration) *UserRepository {
+	return &UserRepository{db: db, jwt: jwtCfg, inventory: inventoryCfg, guest: guestCfg, signer: signer, pricing: calc, timeout: queryTimeout}
 }
 
 // ******************************get all product*************************************
-func (r *ProductRepository) GetAllProducts() ([]models.Products, error) {
-	query := `SELECT product_id, product_name, description, price, img_url FROM products`
-	rows, err := r.db.Query(context.Background(), query)
+// GetAllProducts returns one page of the products matching f, in f's sort order.
+func (r *ProductRepository) GetAllProducts(ctx context.Context, f ProductFilter) (models.Page[models.Products], error) {
+	sortName := f.sortName()
+	order, ok := productSorts[sortName]
+	if !ok {
+		return models.Page[models.Products]{}, fmt.Errorf("%w: unknown sort %q", ErrValidation, f.Sort)
+	}
+	after, hasCursor, err := decodeCursor(f.PageRequest, sortName)
+	if err != nil {
+		return models.Page[models.Products]{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if f.Currency != "" {
+		where = append(where, "currency = "+arg(f.Currency))
+	}
+	if f.MinPrice != nil {
+		where = append(where, "price >= "+arg(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		where = append(where, "price <= "+arg(*f.MaxPrice))
+	}
+	if f.Name != "" {
+		where = append(where, "product_name ILIKE "+arg("%"+escapeLike(f.Name)+"%"))
+	}
+	if f.Category != "" {
+		where = append(where, `product_id IN (
+			SELECT pc.product_id FROM product_categories pc
+			WHERE pc.category_id IN (
+				WITH RECURSIVE subtree AS (
+					SELECT category_id FROM categories WHERE slug = `+arg(f.Category)+`
+					UNION ALL
+					SELECT c.category_id FROM categories c JOIN subtree s ON c.parent_id = s.category_id
+				)
+				SELECT category_id FROM subtree))`)
+	}
+	if f.Tag != "" {
+		where = append(where, `product_id IN (
+			SELECT pt.product_id FROM product_tags pt JOIN tags t ON t.tag_id = pt.tag_id
+			WHERE t.slug = `+arg(f.Tag)+`)`)
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT count(*) FROM products`+whereClause(where), args...).Scan(&total); err != nil {
+		log.Println("Error counting products:", err)
+		return models.Page[models.Products]{}, dbError(err)
+	}
+
+	dir, cmp := "ASC", ">"
+	if order.desc {
+		dir, cmp = "DESC", "<"
+	}
+	orderBy := " ORDER BY product_id " + dir
+	switch order.column {
+	case "":
+	case "price":
+		orderBy = " ORDER BY currency " + dir + ", price " + dir + ", product_id " + dir
+	default:
+		orderBy = " ORDER BY " + order.column + " " + dir + ", product_id " + dir
+	}
+	if hasCursor {
+		switch order.column {
+		case "":
+			where = append(where, "product_id "+cmp+" "+arg(after.ID))
+		case "price":
+			where = append(where, "(currency, price, product_id) "+cmp+" ("+arg(after.S)+", "+arg(int64(after.N))+", "+arg(after.ID)+")")
+		default:
+			where = append(where, "("+order.column+", product_id) "+cmp+" ("+arg(after.S)+", "+arg(after.ID)+")")
+		}
+	}
+
+	limit := f.limit()
+	query := `SELECT product_id, product_name, description, price, currency, img_url, stock, weight_grams FROM products` +
+		whereClause(where) + orderBy + " LIMIT " + arg(limit+1)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		log.Println("err failed excute sql", err)
-		return nil, err
+		return models.Page[models.Products]{}, dbError(err)
 	}
 	defer rows.Close()
 
 	var products []models.Products
+	var keys []cursor
 	for rows.Next() {
 		var p models.Products
-		if err := rows.Scan(&p.Product_id, &p.Product_name, &p.Description, &p.Price, &p.Img_url); err != nil {
-			return nil, err
+		if err := rows.Scan(&p.Product_id, &p.Product_name, &p.Description, &p.Price.Amount, &p.Price.Currency, &p.Img_url, &p.Stock, &p.Weight_grams); err != nil {
+			return models.Page[models.Products]{}, dbError(err)
 		}
 		products = append(products, p)
+		keys = append(keys, order.key(sortName, p))
+	}
+	if err := rows.Err(); err != nil {
+		return models.Page[models.Products]{}, dbError(err)
+	}
+	rows.Close()
+
+	page := newPage(products, keys, limit, total)
+	ids := make([]int, len(page.Items))
+	for i, p := range page.Items {
+		ids[i] = p.Product_id
+	}
+	variants, err := r.productVariants(ctx, ids)
+	if err != nil {
+		log.Println("Error reading variants:", err)
+		return models.Page[models.Products]{}, dbError(err)
 	}
-	return products, nil
+	for i := range page.Items {
+		page.Items[i].Variants = variants[page.Items[i].Product_id]
+		page.Items[i].Variant_options = VariantOptions(page.Items[i].Variants)
+	}
+	return page, nil
+}
+
+// ******************************get product by id*************************************
+func (r *ProductRepository) GetProduct(ctx context.Context, id int) (models.Products, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var p models.Products
+	query := `SELECT product_id, product_name, description, price, currency, img_url, stock, weight_grams,
+		ARRAY(SELECT c.slug FROM product_categories pc JOIN categories c ON c.category_id = pc.category_id
+		      WHERE pc.product_id = p.product_id ORDER BY c.slug),
+		ARRAY(SELECT t.slug FROM product_tags pt JOIN tags t ON t.tag_id = pt.tag_id
+		      WHERE pt.product_id = p.product_id ORDER BY t.slug)
+		FROM products p WHERE product_id = $1`
+	err := r.db.QueryRow(ctx, query, id).Scan(&p.Product_id, &p.Product_name, &p.Description, &p.Price.Amount, &p.Price.Currency, &p.Img_url, &p.Stock, &p.Weight_grams, &p.Categories, &p.Tags)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Products{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Products{}, dbError(err)
+	}
+
+	variants, err := r.productVariants(ctx, []int{id})
+	if err != nil {
+		log.Println("Error reading variants:", err)
+		return models.Products{}, dbError(err)
+	}
+	p.Variants = variants[id]
+	p.Variant_options = VariantOptions(p.Variants)
+
+	if p.Images, err = r.productImages(ctx, id); err != nil {
+		log.Println("Error reading product images:", err)
+		return models.Products{}, dbError(err)
+	}
+	return p, nil
 }
 
 // ******************************add product*************************************
-func (r *ProductRepository) CreateProduct(p models.Products) error {
-	query := `INSERT INTO products (product_id, product_name, description, price, img_url) VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.db.Exec(context.Background(), query, p.Product_id, p.Product_name, p.Description, p.Price, p.Img_url)
-	return err
+func (r *ProductRepository) CreateProduct(ctx context.Context, p models.Products) (models.Products, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO products (product_name, description, price, currency, img_url, weight_grams) VALUES ($1, $2, $3, $4, $5, $6) RETURNING product_id`
+	err := r.db.QueryRow(ctx, query, p.Product_name, p.Description, p.Price.Amount, p.Price.Currency, p.Img_url, p.Weight_grams).Scan(&p.Product_id)
+	if err != nil {
+		return models.Products{}, dbError(err)
+	}
+	return p, nil
 }
 
 // *****************************delete product**************************************
-func (r *ProductRepository) DeleteProduct(id int) error {
+// DeleteProduct is ErrNotFound when there is no product id.
+func (r *ProductRepository) DeleteProduct(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	query := `DELETE FROM products WHERE product_id = $1`
-	_, err := r.db.Exec(context.Background(), query, id)
-	return err
+	tag, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
 // *****************************update product****************************************
-func (r *ProductRepository) UpdateProduct(p models.Products) error {
-	query := `UPDATE products SET product_name = $1, description = $2, price = $3 WHERE product_id = $4`
-	_, err := r.db.Exec(context.Background(), query, p.Product_name, p.Description, p.Price, p.Product_id)
-	return err
+// UpdateProduct is ErrNotFound when there is no product p.Product_id.
+func (r *ProductRepository) UpdateProduct(ctx context.Context, p models.Products) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE products SET product_name = $1, description = $2, price = $3, currency = $4, img_url = $5, weight_grams = $6 WHERE product_id = $7`
+	tag, err := r.db.Exec(ctx, query, p.Product_name, p.Description, p.Price.Amount, p.Price.Currency, p.Img_url, p.Weight_grams, p.Product_id)
+	if err != nil {
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
 // *************************** Get product sales with filtration using user name***************************
-func (r *ProductRepository) GetProductSales(username string) ([]models.Orders, error) {
-	query := `SELECT o.order_id, o.create_at, u.user_name, p.product_name, op.quantity, (op.quantity * op.price_update) AS total_price
+// GetProductSales pages through username's order lines, most recent first.
+func (r *ProductRepository) GetProductSales(ctx context.Context, username string, page PageRequest) (models.Page[models.Orders], error) {
+	after, _, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.Orders]{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var total int
+	err = r.db.QueryRow(ctx, `SELECT count(*)
+    FROM order_product op
+    JOIN users u ON op.user_id = u.user_id
+    WHERE u.user_name = $1`, username).Scan(&total)
+	if err != nil {
+		log.Println("Error counting sales:", err)
+		return models.Page[models.Orders]{}, dbError(err)
+	}
+
+	// after.ID is 0 on the first page
+	query := `SELECT op.op_id, o.order_id, o.create_at, u.user_name, p.product_name, op.quantity, (op.quantity * op.price_update) AS total_price, op.currency
     FROM orders o
     JOIN order_product op ON o.order_id = op.order_id
     JOIN users u ON op.user_id = u.user_id
     JOIN products p ON op.product_id = p.product_id
-    WHERE u.user_name = $1`
+    WHERE u.user_name = $1 AND ($2 = 0 OR op.op_id < $2)
+    ORDER BY op.op_id DESC
+    LIMIT $3`
 
-	rows, err := r.db.Query(context.Background(), query, username)
+	limit := page.limit()
+	rows, err := r.db.Query(ctx, query, username, after.ID, limit+1)
 	if err != nil {
 		log.Println("Error executing query:", err)
-		return nil, err
+		return models.Page[models.Orders]{}, dbError(err)
 	}
 	defer rows.Close()
 
 	var sales []models.Orders
+	var keys []cursor
 	for rows.Next() {
 		var sale models.Orders
-		if err := rows.Scan(&sale.Order_id, &sale.CreatedAt, &sale.Username, &sale.ProductName, &sale.Quantity, &sale.TotalPrice); err != nil {
+		var opID int
+		if err := rows.Scan(&opID, &sale.Order_id, &sale.CreatedAt, &sale.Username, &sale.ProductName, &sale.Quantity, &sale.TotalPrice.Amount, &sale.TotalPrice.Currency); err != nil {
 			log.Println("Error scanning row:", err)
-			return nil, err
+			return models.Page[models.Orders]{}, dbError(err)
 		}
 		sales = append(sales, sale)
+		keys = append(keys, cursor{ID: opID})
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error iterating rows:", err)
-		return nil, err
+		return models.Page[models.Orders]{}, dbError(err)
 	}
 
-	return sales, nil
+	return newPage(sales, keys, limit, total), nil
 }
 
 // **********************************************************************************
 // *****************************get all user*******************************************
-func (r *UserRepository) GetAllUsers() ([]models.Users, error) {
-	query := `SELECT user_id, user_name FROM users`
-	rows, err := r.db.Query(context.Background(), query)
+func (r *UserRepository) GetAllUsers(ctx context.Context, page PageRequest) (models.Page[models.Users], error) {
+	after, _, err := decodeCursor(page, "")
 	if err != nil {
+		return models.Page[models.Users]{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT count(*) FROM users`).Scan(&total); err != nil {
 		log.Println("err in sql", err)
-		return nil, err
+		return models.Page[models.Users]{}, dbError(err)
+	}
+
+	limit := page.limit()
+	query := `SELECT user_id, user_name, role FROM users WHERE user_id > $1 ORDER BY user_id LIMIT $2`
+	rows, err := r.db.Query(ctx, query, after.ID, limit+1)
+	if err != nil {
+		log.Println("err in sql", err)
+		return models.Page[models.Users]{}, dbError(err)
 	}
 	defer rows.Close()
 
 	var users []models.Users
+	var keys []cursor
 	for rows.Next() {
 		var u models.Users
-		if err := rows.Scan(&u.User_id, &u.User_name); err != nil {
-			return nil, err
+		if err := rows.Scan(&u.User_id, &u.User_name, &u.Role); err != nil {
+			return models.Page[models.Users]{}, dbError(err)
 		}
 		users = append(users, u)
+		keys = append(keys, cursor{ID: u.User_id})
+	}
+	if err := rows.Err(); err != nil {
+		return models.Page[models.Users]{}, dbError(err)
 	}
-	return users, nil
+	return newPage(users, keys, limit, total), nil
 }
 
 // **************************sign up***********************************************
-func (r *UserRepository) CreateUser(user models.Users) error {
+func (r *UserRepository) CreateUser(ctx context.Context, user models.Users) (models.Users, error) {
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return models.Users{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO users (user_name, password, email, phone, ` + addressColumns + `, role) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+              RETURNING user_id, create_at`
+
+	user.Role = models.RoleCustomer
+	a := user.Address
+	err = r.db.QueryRow(ctx, query,
+		user.User_name, string(hashedPassword),
+		user.Email, user.Phone, a.Line1, a.Line2, a.City, a.Region, a.Postal_code, a.Country, user.Role,
+	).Scan(&user.User_id, &user.CreatedAt)
+	if err != nil {
+		return models.Users{}, dbError(err)
 	}
 
-	query := `INSERT INTO users (user_id, user_name, password, email, phone, address, create_at) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	user.Password = ""
+	return user, nil
+}
 
-	_, err = r.db.Exec(context.Background(), query,
-		user.User_id, user.User_name, string(hashedPassword),
-		user.Email, user.Phone, user.Address, user.CreatedAt,
-	)
+// **************************get user by id***********************************************
+func (r *UserRepository) GetUser(ctx context.Context, id int) (models.Users, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 
-	return err
+	query := `SELECT user_id, user_name, email, phone, ` + addressColumns + `, role, create_at FROM users WHERE user_id = $1`
+	u, err := scanUser(r.db.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Users{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Users{}, dbError(err)
+	}
+	return u, nil
 }
 
 // ************************login***************************************************
-func (r *UserRepository) LoginUser(email, password string) (string, error) {
+func (r *UserRepository) LoginUser(ctx context.Context, email, password string) (models.TokenPair, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	var user models.Users
 
-	query := `SELECT user_id, user_name, password FROM users WHERE email = $1`
-	err := r.db.QueryRow(context.Background(), query, email).Scan(&user.User_id, &user.User_name, &user.Password)
+	query := `SELECT user_id, user_name, password, role FROM users WHERE email = $1`
+	err := r.db.QueryRow(ctx, query, email).Scan(&user.User_id, &user.User_name, &user.Password, &user.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TokenPair{}, ErrInvalidCredentials
+	}
 	if err != nil {
-		return "", errors.New("user is not found")
+		return models.TokenPair{}, dbError(err)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return "", errors.New("password incorrect")
+		return models.TokenPair{}, ErrInvalidCredentials
 	}
 
-	// jwt token
-	claims := models.JWTClaims{
-		UserID:   user.User_id,
-		UserName: user.User_name,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+	pair, _, err := r.issueSession(ctx, r.db, user, "")
+	return pair, err
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secretKey := []byte("mysecretkey")
+// ************************change role***************************************************
+// SetUserRole takes effect at the user's next login; tokens already issued keep
+// the role they were signed with until they expire.
+func (r *UserRepository) SetUserRole(ctx context.Context, userID int, role string) (models.Users, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE users SET role = $1 WHERE user_id = $2
+	          RETURNING user_id, user_name, email, phone, ` + addressColumns + `, role, create_at`
+	u, err := scanUser(r.db.QueryRow(ctx, query, role, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Users{}, ErrNotFound
+	}
+	if err != nil {
+		log.Println("Error updating user role:", err)
+		return models.Users{}, dbError(err)
+	}
+	return u, nil
+}
 
-	signedToken, err := token.SignedString(secretKey)
+// ************************change address***************************************************
+func (r *UserRepository) SetUserAddress(ctx context.Context, userID int, a models.Address) (models.Users, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE users SET address_line1 = $1, address_line2 = $2, city = $3, region = $4, postal_code = $5, country = $6
+	          WHERE user_id = $7
+	          RETURNING user_id, user_name, email, phone, ` + addressColumns + `, role, create_at`
+	u, err := scanUser(r.db.QueryRow(ctx, query, a.Line1, a.Line2, a.City, a.Region, a.Postal_code, a.Country, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Users{}, ErrNotFound
+	}
 	if err != nil {
-		return "", errors.New("failed to grnerate token")
+		log.Println("Error updating user address:", err)
+		return models.Users{}, dbError(err)
 	}
+	return u, nil
+}
 
-	return signedToken, nil
+// scanUser reads the user_id, user_name, email, phone, address, role and
+// create_at columns.
+func scanUser(row pgx.Row) (models.Users, error) {
+	var u models.Users
+	dest := []interface{}{&u.User_id, &u.User_name, &u.Email, &u.Phone}
+	dest = append(dest, addressFields(&u.Address)...)
+	dest = append(dest, &u.Role, &u.CreatedAt)
+	err := row.Scan(dest...)
+	return u, err
 }
 
 // ***************************add credit card*********************************
-func (r *UserRepository) AddCreditCard(userID int, card models.CreditCard) error {
-	query := `INSERT INTO credit_card (user_id, card_id, card_num) 
-              VALUES ($1, $2, $3)`
+const cardColumns = `card_id, user_id, COALESCE(token, ''), brand, last4, is_default, create_at`
 
-	_, err := r.db.Exec(context.Background(), query,
-		userID, card.Card_id, card.Card_num,
-	)
+func scanCard(row pgx.Row) (models.CreditCard, error) {
+	var c models.CreditCard
+	err := row.Scan(&c.Card_id, &c.User_id, &c.Token, &c.Brand, &c.Last4, &c.Is_default, &c.CreatedAt)
+	return c, err
+}
+
+// AddCreditCard saves an already tokenized card. A user's first card becomes
+// their default.
+func (r *UserRepository) AddCreditCard(ctx context.Context, userID int, card models.CreditCard) (models.CreditCard, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `INSERT INTO credit_card (user_id, token, brand, last4, is_default) 
+              VALUES ($1, $2, $3, $4, NOT EXISTS (SELECT 1 FROM credit_card WHERE user_id = $1))
+              RETURNING ` + cardColumns
+
+	card, err := scanCard(r.db.QueryRow(ctx, query,
+		userID, card.Token, card.Brand, card.Last4,
+	))
 
 	if err != nil {
 		log.Println("Error inserting credit card:", err)
-		return err
+		return models.CreditCard{}, dbError(err)
 	}
 
 	log.Println("Credit card added successfully for user:", userID)
-	return nil
+	return card, nil
 }
 
-// ***********************delete credit card**********************************
-func (r *UserRepository) DeleteCreditCard(cardID int) error {
-	query := `DELETE FROM credit_card WHERE card_id = $1`
-	_, err := r.db.Exec(context.Background(), query, cardID)
+// ***********************list credit cards**********************************
+func (r *UserRepository) ListCreditCards(ctx context.Context, userID int) ([]models.CreditCard, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 
+	query := `SELECT ` + cardColumns + ` FROM credit_card WHERE user_id = $1 ORDER BY is_default DESC, card_id`
+	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
-		log.Println("Error deleting credit card:", err)
-		return err
+		log.Println("Error executing query:", err)
+		return nil, dbError(err)
 	}
+	defer rows.Close()
 
-	log.Println("Credit card deleted successfully, Card ID:", cardID)
-	return nil
+	var cards []models.CreditCard
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, dbError(err)
+		}
+		cards = append(cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return cards, nil
 }
 
-// *********************add product in cart **********************************
-func (r *UserRepository) AddCartProduct(cp models.CartProduct) error {
-	query := `INSERT INTO cart_product (cp_id, cart_id, product_id, quantity) 
-              VALUES ($1, $2, $3, $4)`
+// ***********************get credit card**********************************
+func (r *UserRepository) GetCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 
-	_, err := r.db.Exec(context.Background(), query, cp.CP_id, cp.Cart_id, cp.Product_id, cp.Quantity)
+	query := `SELECT ` + cardColumns + ` FROM credit_card WHERE card_id = $1 AND user_id = $2`
+	card, err := scanCard(r.db.QueryRow(ctx, query, cardID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CreditCard{}, ErrNotFound
+	}
 	if err != nil {
-		log.Println("Error inserting product into cart:", err)
-		return err
+		return models.CreditCard{}, dbError(err)
 	}
-
-	log.Println("Product added to cart successfully")
-	return nil
+	return card, nil
 }
-func (r *UserRepository) AddCart(userID int, cart models.Cart) error {
-	query := `INSERT INTO cart (user_id, cart_id) VALUES ($1, $2)`
-	_, err := r.db.Exec(context.Background(), query, userID, cart.Cart_id)
+
+// ***********************get default credit card**********************************
+func (r *UserRepository) GetDefaultCreditCard(ctx context.Context, userID int) (models.CreditCard, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT ` + cardColumns + ` FROM credit_card WHERE user_id = $1 AND is_default`
+	card, err := scanCard(r.db.QueryRow(ctx, query, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CreditCard{}, ErrNotFound
+	}
 	if err != nil {
-		log.Println("Error inserting cart:", err)
-		return err
+		return models.CreditCard{}, dbError(err)
 	}
-
-	log.Println("Cart added successfully for user:", userID)
-	return nil
+	return card, nil
 }
 
-// ***************************get cart *********************************
-func (r *UserRepository) GetAllCart(userID int) ([]models.CartProduct, error) {
+// ***********************set default credit card**********************************
+func (r *UserRepository) SetDefaultCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 
-	query := `SELECT cp.cp_id, cp.cart_id, cp.product_id, cp.quantity 
-			  FROM cart_product cp 
-			  JOIN cart c ON cp.cart_id = c.cart_id 
-			  WHERE c.user_id = $1`
-
-	rows, err := r.db.Query(context.Background(), query, userID)
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		log.Println("err failed to excute sql", err)
-		return nil, err
+		return models.CreditCard{}, dbError(err)
 	}
-	defer rows.Close()
-	var carts []models.CartProduct
+	defer tx.Rollback(ctx)
 
-	for rows.Next() {
-		var p models.CartProduct
-
-		if err := rows.Scan(&p.CP_id, &p.Cart_id, &p.Product_id, &p.Quantity); err != nil {
-			log.Println("err , failed scan ", err)
-			return nil, err
-		}
-		carts = append(carts, p)
+	// clear the old default first so the one-default-per-user index never sees two
+	_, err = tx.Exec(ctx, `UPDATE credit_card SET is_default = false WHERE user_id = $1 AND is_default AND card_id <> $2`, userID, cardID)
+	if err != nil {
+		log.Println("Error clearing default card:", err)
+		return models.CreditCard{}, dbError(err)
 	}
 
-	if err := rows.Err(); err != nil {
-		log.Println("err , failed read this rows", err)
-		return nil, err
+	query := `UPDATE credit_card SET is_default = true WHERE card_id = $1 AND user_id = $2 RETURNING ` + cardColumns
+	card, err := scanCard(tx.QueryRow(ctx, query, cardID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CreditCard{}, ErrNotFound
+	}
+	if err != nil {
+		log.Println("Error setting default card:", err)
+		return models.CreditCard{}, dbError(err)
 	}
 
-	return carts, nil
+	if err := tx.Commit(ctx); err != nil {
+		return models.CreditCard{}, dbError(err)
+	}
+	return card, nil
 }
 
-// **********************add order *************************************
-func (r *UserRepository) AddOrder(order models.Orders) error {
-	query := `INSERT INTO orders (order_id, total_price ,status , create_at) VALUES ($1, $2 ,$3,$4)`
-	_, err := r.db.Exec(context.Background(), query, order.Order_id, order.TotalPrice, order.Status, order.CreatedAt)
+// ***********************delete credit card**********************************
+// DeleteCreditCard returns the deleted card so the caller can drop its token
+// from the vault.
+func (r *UserRepository) DeleteCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `DELETE FROM credit_card WHERE card_id = $1 AND user_id = $2 RETURNING ` + cardColumns
+	card, err := scanCard(r.db.QueryRow(ctx, query, cardID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.CreditCard{}, ErrNotFound
+	}
 	if err != nil {
-		log.Println("Error inserting order:", err)
-		return err
+		log.Println("Error deleting credit card:", err)
+		return models.CreditCard{}, dbError(err)
 	}
 
-	log.Println("order added successfully ")
-	return nil
+	log.Println("Credit card deleted successfully, Card ID:", cardID)
+	return card, nil
 }
 
-// *******************details of order ************************************
-func (r *UserRepository) AddOrderProduct(op models.OrderProduct) error {
-	query := `INSERT INTO order_product (op_id , order_id , product_id ,quantity , price_update )
-				VALUES($1,$2,$3,$4,$5)`
+// **********************get order *************************************
+func (r *UserRepository) GetOrder(ctx context.Context, userID, orderID int) (models.Orders, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.queryOrder(ctx, `order_id = $1 AND user_id = $2`, orderID, userID)
+}
 
-	_, err := r.db.Exec(context.Background(), query, op.OP_id, op.Order_id, op.Product_id, op.Quantity, op.Price_update)
+// **********************find order *************************************
+// FindOrder is GetOrder for staff: it returns the order whoever placed it,
+// including orders whose user has since been deleted.
+func (r *UserRepository) FindOrder(ctx context.Context, orderID int) (models.Orders, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.queryOrder(ctx, `order_id = $1`, orderID)
+}
+
+// queryOrder loads the one order matching where, with its delivery and
+// discount lines. User_id is 0 for an order whose user was deleted.
+func (r *UserRepository) queryOrder(ctx context.Context, where string, args ...interface{}) (models.Orders, error) {
+	var order models.Orders
+	var userID *int
+	var shipTo [6]*string
+	var shippingMethod, shippingName *string
+	var shippingAmount, taxAmount *int64
+	query := `SELECT order_id, user_id, total_price, currency, status, create_at,
+	                 ship_line1, ship_line2, ship_city, ship_region, ship_postal_code, ship_country,
+	                 shipping_method, shipping_name, shipping_amount, tax_amount, tax_included
+	          FROM orders WHERE ` + where
+	err := r.db.QueryRow(ctx, query, args...).Scan(&order.Order_id, &userID, &order.TotalPrice.Amount, &order.TotalPrice.Currency, &order.Status, &order.CreatedAt,
+		&shipTo[0], &shipTo[1], &shipTo[2], &shipTo[3], &shipTo[4], &shipTo[5],
+		&shippingMethod, &shippingName, &shippingAmount, &taxAmount, &order.Tax_included)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Orders{}, ErrNotFound
+	}
 	if err != nil {
-		log.Println("Error inserting order_product:", err)
-		return err
+		return models.Orders{}, dbError(err)
+	}
+	if userID != nil {
+		order.User_id = *userID
+	}
+	if shipTo[5] != nil {
+		order.Ship_to = &models.Address{}
+		for i, f := range addressFields(order.Ship_to) {
+			if shipTo[i] != nil {
+				*f.(*string) = *shipTo[i]
+			}
+		}
+	}
+	if shippingMethod != nil && shippingAmount != nil {
+		order.Shipping = &models.ShippingCharge{Method: *shippingMethod, Amount: money.New(*shippingAmount, order.TotalPrice.Currency)}
+		if shippingName != nil {
+			order.Shipping.Name = *shippingName
+		}
+	}
+	if taxAmount != nil {
+		tax := money.New(*taxAmount, order.TotalPrice.Currency)
+		order.Tax = &tax
+	}
+	if order.Discounts, err = r.orderDiscounts(ctx, order.Order_id); err != nil {
+		return models.Orders{}, dbError(err)
 	}
+	return order, nil
+}
 
-	log.Println("order_product added successfully")
-	return nil
+// **********************order lines *************************************
+// GetOrderItems returns the lines of an order at the prices checkout
+// recorded for them.
+func (r *UserRepository) GetOrderItems(ctx context.Context, orderID int) ([]models.OrderProduct, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
 
+	rows, err := r.db.Query(ctx,
+		`SELECT op_id, order_id, product_id, COALESCE(variant_id, 0), quantity, price_update, currency
+		 FROM order_product WHERE order_id = $1 ORDER BY op_id`, orderID)
+	if err != nil {
+		log.Println("Error executing query:", err)
+		return nil, dbError(err)
+	}
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.OrderProduct, error) {
+		var op models.OrderProduct
+		err := row.Scan(&op.OP_id, &op.Order_id, &op.Product_id, &op.Variant_id, &op.Quantity, &op.Price_update.Amount, &op.Price_update.Currency)
+		return op, err
+	})
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return items, nil
 }
 
 // ********************get all order ************************************
-func (r *UserRepository) GetHistory(userID int) ([]models.OrderProduct, error) {
-	query := `SELECT op.op_id , op.product_id ,op.order_id ,op.quantity 
+func (r *UserRepository) GetHistory(ctx context.Context, userID int, page PageRequest) (models.Page[models.OrderProduct], error) {
+	after, _, err := decodeCursor(page, "")
+	if err != nil {
+		return models.Page[models.OrderProduct]{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var total int
+	err = r.db.QueryRow(ctx, `SELECT count(*)
+		FROM order_product op
+		JOIN orders o ON o.order_id = op.order_id
+		WHERE o.user_id = $1
+		AND o.status IN ('paid', 'fulfilled', 'shipped', 'delivered')`, userID).Scan(&total)
+	if err != nil {
+		log.Println("Error counting history:", err)
+		return models.Page[models.OrderProduct]{}, dbError(err)
+	}
+
+	// newest lines first; after.ID is 0 on the first page
+	query := `SELECT op.op_id , op.product_id , COALESCE(op.variant_id, 0), op.order_id ,op.quantity 
        ,p.product_name
 		FROM order_product op
 		JOIN products p ON p.product_id=op.product_id
 		JOIN orders o ON o.order_id = op.order_id
-		WHERE op.user_id = $1 
-		AND o.status = 'completed';`
-
-	rows, err := r.db.Query(context.Background(), query, userID)
+		WHERE o.user_id = $1 
+		AND o.status IN ('paid', 'fulfilled', 'shipped', 'delivered')
+		AND ($2 = 0 OR op.op_id < $2)
+		ORDER BY op.op_id DESC
+		LIMIT $3`
+
+	limit := page.limit()
+	rows, err := r.db.Query(ctx, query, userID, after.ID, limit+1)
 	if err != nil {
 		log.Println("Error executing query:", err)
-		return nil, err
+		return models.Page[models.OrderProduct]{}, dbError(err)
 	}
 	defer rows.Close()
 
 	var orderHistory []models.OrderProduct
+	var keys []cursor
 
 	for rows.Next() {
 		var order models.OrderProduct
-		if err := rows.Scan(&order.OP_id, &order.Product_id, &order.Order_id, &order.Quantity, &order.ProductName); err != nil {
+		if err := rows.Scan(&order.OP_id, &order.Product_id, &order.Variant_id, &order.Order_id, &order.Quantity, &order.ProductName); err != nil {
 			log.Println("Error scanning row:", err)
-			return nil, err
+			return models.Page[models.OrderProduct]{}, dbError(err)
 		}
 		orderHistory = append(orderHistory, order)
+		keys = append(keys, cursor{ID: order.OP_id})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating rows:", err)
+		return models.Page[models.OrderProduct]{}, dbError(err)
+	}
+
+	return newPage(orderHistory, keys, limit, total), nil
+}
+
+// ********************change order status ************************************
+// TransitionOrder moves an order to status to if the transition table allows
+// it, and records the change with its actor in the order's timeline.
+func (r *UserRepository) TransitionOrder(ctx context.Context, orderID int, to string, actorID int, note string) (models.Orders, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.Orders{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := transitionOrder(ctx, tx, orderID, to, actorID, note)
+	if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrNotFound) {
+		return models.Orders{}, err
+	}
+	if err != nil {
+		log.Println("Error changing order status:", err)
+		return models.Orders{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Orders{}, dbError(err)
+	}
+	return order, nil
+}
+
+// ********************order timeline ************************************
+func (r *UserRepository) GetOrderTimeline(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT history_id, order_id, COALESCE(from_status, ''), to_status, COALESCE(actor_id, 0), note, create_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY create_at, history_id`
+
+	rows, err := r.db.Query(ctx, query, orderID)
+	if err != nil {
+		log.Println("Error executing query:", err)
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	var timeline []models.OrderStatusChange
+	for rows.Next() {
+		var c models.OrderStatusChange
+		if err := rows.Scan(&c.History_id, &c.Order_id, &c.From_status, &c.To_status, &c.Actor_id, &c.Note, &c.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			return nil, dbError(err)
+		}
+		timeline = append(timeline, c)
 	}
 
 	if err := rows.Err(); err != nil {
 		log.Println("Error iterating rows:", err)
-		return nil, err
+		return nil, dbError(err)
 	}
 
-	return orderHistory, nil
+	return timeline, nil
 }
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"my-go-project/models"
+	"my-go-project/money"
+	"testing"
+)
+
+func TestFindOrder(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore()
+	user, err := s.CreateUser(ctx, models.Users{
+		User_name: "alice",
+		Email:     "alice@example.com",
+		Password:  "secret",
+		Address:   models.Address{Line1: "1 Main St", City: "Los Angeles", Region: "CA", Country: "US"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.CreateProduct(ctx, models.Products{Product_name: "Tee", Price: money.New(1000, "USD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AdjustStock(ctx, p.Product_id, 0, 10, "restock", user.User_id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddCartProduct(ctx, user.User_id, models.CartProduct{Product_id: p.Product_id, Quantity: 1}); err != nil {
+		t.Fatal(err)
+	}
+	checkout, err := s.Checkout(ctx, user.User_id, models.Delivery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderID := checkout.Order.Order_id
+
+	if _, err := s.FindOrder(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing order: err = %v, want ErrNotFound", err)
+	}
+
+	order, err := s.FindOrder(ctx, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.User_id != user.User_id || order.Ship_to == nil {
+		t.Fatalf("order = %+v, want alice's with its delivery", order)
+	}
+
+	// deleting the user sets orders.user_id to NULL
+	s.mu.Lock()
+	o := s.orders[orderID]
+	o.User_id = 0
+	s.orders[orderID] = o
+	s.mu.Unlock()
+
+	order, err = s.FindOrder(ctx, orderID)
+	if err != nil {
+		t.Fatalf("order without an owner: %v", err)
+	}
+	if order.User_id != 0 || order.TotalPrice != checkout.Order.TotalPrice || order.Ship_to == nil {
+		t.Fatalf("order = %+v, want it unowned with its total and delivery", order)
+	}
+	if _, err := s.GetOrder(ctx, user.User_id, orderID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetOrder by the former owner: err = %v, want ErrNotFound", err)
+	}
+}
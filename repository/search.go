@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultSuggestLimit and MaxSuggestLimit bound SuggestProducts.
+	DefaultSuggestLimit = 10
+	MaxSuggestLimit     = 20
+
+	// suggestThreshold is the lowest score the in-memory SuggestProducts
+	// returns, matching pg_trgm's default word_similarity_threshold that the
+	// <% operator uses in Postgres.
+	suggestThreshold = 0.6
+
+	// highlightStart and highlightStop delimit matches in raw snippets. They
+	// cannot occur in product text, so the snippet can be HTML-escaped before
+	// they are turned into tags.
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// headlineOptions configures ts_headline to mark matches with highlightStart
+// and highlightStop.
+const headlineOptions = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", MaxWords=30, MinWords=10, MaxFragments=2`
+
+// highlight HTML-escapes a raw snippet and turns its match markers into <b>
+// tags.
+func highlight(raw string) string {
+	return strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>").Replace(html.EscapeString(raw))
+}
+
+func clampLimit(limit, def, max int) int {
+	switch {
+	case limit <= 0:
+		return def
+	case limit > max:
+		return max
+	}
+	return limit
+}
+
+// searchTerms splits a query into lowercase words, the way the in-memory store
+// approximates websearch_to_tsquery.
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns the set of pg_trgm trigrams of s: every word, lowercased and
+// padded with two spaces in front and one behind, cut into three-rune pieces.
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range searchTerms(s) {
+		r := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			set[string(r[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// wordSimilarity approximates pg_trgm's word_similarity(q, name): the share
+// of q's trigrams found in the best matching word of name, or in the whole
+// name for queries of several words. A prefix of a word scores high, so it
+// suits typeahead.
+func wordSimilarity(q, name string) float64 {
+	tq := trigrams(q)
+	if len(tq) == 0 {
+		return 0
+	}
+	best := 0.0
+	for _, text := range append(searchTerms(name), name) {
+		tt := trigrams(text)
+		shared := 0
+		for t := range tq {
+			if tt[t] {
+				shared++
+			}
+		}
+		if sim := float64(shared) / float64(len(tq)); sim > best {
+			best = sim
+		}
+	}
+	return best
+}
+
+// sortByScore orders results by score, highest first, then by id.
+func sortByScore[T any](items []T, score func(T) float64, id func(T) int) {
+	sort.Slice(items, func(i, j int) bool {
+		if si, sj := score(items[i]), score(items[j]); si != sj {
+			return si > sj
+		}
+		return id(items[i]) < id(items[j])
+	})
+}
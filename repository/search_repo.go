@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"my-go-project/models"
+)
+
+// ***************************search products*********************************
+// SearchProducts runs a full-text search over product names and descriptions,
+// best matches first. q uses web search syntax: quoted phrases, "or", and a
+// leading "-" to exclude a word. Names weigh more than descriptions.
+func (r *ProductRepository) SearchProducts(ctx context.Context, q string, limit int) (models.Page[models.ProductSearchResult], error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT p.product_id, p.product_name, p.description, p.price, p.currency, p.img_url, p.stock, p.weight_grams,
+		       ts_rank(p.search_vector, q) AS rank,
+		       ts_headline('english', p.product_name || ' — ' || p.description, q, $3) AS snippet,
+		       count(*) OVER () AS total
+		FROM products p, websearch_to_tsquery('english', $1) q
+		WHERE p.search_vector @@ q
+		ORDER BY rank DESC, p.product_id
+		LIMIT $2`
+
+	limit = clampLimit(limit, DefaultPageLimit, MaxPageLimit)
+	rows, err := r.db.Query(ctx, query, q, limit, headlineOptions)
+	if err != nil {
+		log.Println("Error searching products:", err)
+		return models.Page[models.ProductSearchResult]{}, dbError(err)
+	}
+	defer rows.Close()
+
+	page := models.Page[models.ProductSearchResult]{Items: []models.ProductSearchResult{}}
+	for rows.Next() {
+		var res models.ProductSearchResult
+		var rank float32
+		var snippet string
+		if err := rows.Scan(&res.Product_id, &res.Product_name, &res.Description, &res.Price.Amount, &res.Price.Currency, &res.Img_url, &res.Stock, &res.Weight_grams, &rank, &snippet, &page.Total); err != nil {
+			return models.Page[models.ProductSearchResult]{}, dbError(err)
+		}
+		res.Rank = float64(rank)
+		res.Snippet = highlight(snippet)
+		page.Items = append(page.Items, res)
+	}
+	if err := rows.Err(); err != nil {
+		return models.Page[models.ProductSearchResult]{}, dbError(err)
+	}
+	return page, nil
+}
+
+// ***************************suggest products*********************************
+// SuggestProducts returns product names resembling q, for typeahead. Matching
+// is by trigram word similarity, so a misspelled or partly typed word still
+// finds its product; the cut-off is pg_trgm.word_similarity_threshold.
+func (r *ProductRepository) SuggestProducts(ctx context.Context, q string, limit int) ([]models.ProductSuggestion, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `SELECT product_id, product_name, word_similarity($1, product_name) AS score
+		FROM products
+		WHERE $1 <% product_name
+		ORDER BY score DESC, product_id
+		LIMIT $2`
+
+	rows, err := r.db.Query(ctx, query, q, clampLimit(limit, DefaultSuggestLimit, MaxSuggestLimit))
+	if err != nil {
+		log.Println("Error suggesting products:", err)
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	suggestions := []models.ProductSuggestion{}
+	for rows.Next() {
+		var s models.ProductSuggestion
+		var score float32
+		if err := rows.Scan(&s.Product_id, &s.Product_name, &score); err != nil {
+			return nil, dbError(err)
+		}
+		s.Score = float64(score)
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+	return suggestions, nil
+}
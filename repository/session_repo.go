@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+	"time"
+)
+
+// queryRower is satisfied by both the pool and a transaction.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// issueSession signs an access token for user and stores a new refresh token
+// in family, starting a new family when family is empty. It returns the pair
+// and the new refresh token's row id.
+func (r *UserRepository) issueSession(ctx context.Context, q queryRower, user models.Users, family string) (models.TokenPair, int, error) {
+	access, err := signToken(user, r.signer, r.jwt.TTL)
+	if err != nil {
+		return models.TokenPair{}, 0, err
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		return models.TokenPair{}, 0, err
+	}
+	if family == "" {
+		if family, err = randomToken(16); err != nil {
+			return models.TokenPair{}, 0, err
+		}
+	}
+
+	var tokenID int
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+	          VALUES ($1, $2, $3, $4)
+	          RETURNING token_id`
+	err = q.QueryRow(ctx, query, user.User_id, family, hashToken(refresh), time.Now().Add(r.jwt.RefreshTTL)).Scan(&tokenID)
+	if err != nil {
+		log.Println("Error inserting refresh token:", err)
+		return models.TokenPair{}, 0, dbError(err)
+	}
+
+	return models.TokenPair{Token: access, RefreshToken: refresh, ExpiresIn: r.jwt.TTL, User_id: user.User_id}, tokenID, nil
+}
+
+// ************************refresh***************************************************
+// RefreshSession exchanges a refresh token for a new pair and retires the old
+// token. Presenting a retired token again means it was copied, so the whole
+// family is revoked and ErrRefreshTokenReused returned.
+func (r *UserRepository) RefreshSession(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return models.TokenPair{}, dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		tokenID   int
+		family    string
+		expiresAt time.Time
+		revoked   bool
+		user      models.Users
+	)
+	query := `SELECT rt.token_id, rt.family_id, rt.expires_at, rt.revoked_at IS NOT NULL,
+	                 u.user_id, u.user_name, u.role
+	          FROM refresh_tokens rt
+	          JOIN users u ON u.user_id = rt.user_id
+	          WHERE rt.token_hash = $1
+	          FOR UPDATE OF rt`
+	err = tx.QueryRow(ctx, query, hashToken(refreshToken)).Scan(&tokenID, &family, &expiresAt, &revoked, &user.User_id, &user.User_name, &user.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return models.TokenPair{}, dbError(err)
+	}
+
+	if revoked {
+		_, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`, family)
+		if err != nil {
+			return models.TokenPair{}, dbError(err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return models.TokenPair{}, dbError(err)
+		}
+		log.Println("Refresh token reused, revoked session family for user:", user.User_id)
+		return models.TokenPair{}, ErrRefreshTokenReused
+	}
+	if time.Now().After(expiresAt) {
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	pair, nextID, err := r.issueSession(ctx, tx, user, family)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = now(), replaced_by = $1 WHERE token_id = $2`, nextID, tokenID)
+	if err != nil {
+		return models.TokenPair{}, dbError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.TokenPair{}, dbError(err)
+	}
+	return pair, nil
+}
+
+// ************************logout***************************************************
+// Logout revokes the access token jti until it would have expired anyway and,
+// when refreshToken is one of userID's, every refresh token in its family.
+func (r *UserRepository) Logout(ctx context.Context, userID int, jti string, expiresAt time.Time, refreshToken string) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return dbError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	if err != nil {
+		log.Println("Error revoking access token:", err)
+		return dbError(err)
+	}
+	// the list only needs tokens that have not expired yet
+	if _, err := tx.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < now()`); err != nil {
+		return dbError(err)
+	}
+
+	if refreshToken != "" {
+		query := `UPDATE refresh_tokens SET revoked_at = now()
+		          WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2)
+		            AND revoked_at IS NULL`
+		if _, err := tx.Exec(ctx, query, hashToken(refreshToken), userID); err != nil {
+			log.Println("Error revoking refresh tokens:", err)
+			return dbError(err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+// ************************revocation check***************************************************
+func (r *UserRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var revoked bool
+	err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	if err != nil {
+		return false, dbError(err)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"my-go-project/models"
+	"time"
+)
+
+// ProductStore is the catalog and sales-report side of the data layer.
+type ProductStore interface {
+	GetAllProducts(ctx context.Context, f ProductFilter) (models.Page[models.Products], error)
+	GetProduct(ctx context.Context, id int) (models.Products, error)
+	SearchProducts(ctx context.Context, q string, limit int) (models.Page[models.ProductSearchResult], error)
+	SuggestProducts(ctx context.Context, q string, limit int) ([]models.ProductSuggestion, error)
+	CreateProduct(ctx context.Context, p models.Products) (models.Products, error)
+	DeleteProduct(ctx context.Context, id int) error
+	UpdateProduct(ctx context.Context, p models.Products) error
+	GetProductSales(ctx context.Context, username string, page PageRequest) (models.Page[models.Orders], error)
+}
+
+// CatalogStore covers the category tree, tags, and the links between them and
+// products. Category and tag slugs are unique; writes that break that fail
+// with ErrConflict.
+type CatalogStore interface {
+	ListCategories(ctx context.Context) ([]models.Category, error)
+	GetCategoryBySlug(ctx context.Context, slug string) (models.Category, error)
+	CreateCategory(ctx context.Context, c models.Category) (models.Category, error)
+	UpdateCategory(ctx context.Context, c models.Category) (models.Category, error)
+	DeleteCategory(ctx context.Context, id int) error
+	ListTags(ctx context.Context) ([]models.Tag, error)
+	CreateTag(ctx context.Context, t models.Tag) (models.Tag, error)
+	UpdateTag(ctx context.Context, t models.Tag) (models.Tag, error)
+	DeleteTag(ctx context.Context, id int) error
+	SetProductCategories(ctx context.Context, productID int, slugs []string) ([]string, error)
+	SetProductTags(ctx context.Context, productID int, slugs []string) ([]string, error)
+}
+
+// VariantStore covers the variants of a product. Variant SKUs are unique, and
+// so are option sets within a product; writes that break that fail with
+// ErrConflict.
+type VariantStore interface {
+	ListVariants(ctx context.Context, productID int) ([]models.ProductVariant, error)
+	CreateVariant(ctx context.Context, v models.ProductVariant) (models.ProductVariant, error)
+	UpdateVariant(ctx context.Context, v models.ProductVariant) (models.ProductVariant, error)
+	DeleteVariant(ctx context.Context, productID, variantID int) error
+}
+
+// ImageStore covers a product's image gallery: an ordered list whose positions
+// run from 0 without gaps. Only the rows live here; the files are in a
+// storage.BlobStore.
+type ImageStore interface {
+	ListProductImages(ctx context.Context, productID int) ([]models.ProductImage, error)
+	AddProductImage(ctx context.Context, img models.ProductImage) (models.ProductImage, error)
+	UpdateProductImage(ctx context.Context, productID, imageID int, altText string, position int) (models.ProductImage, error)
+	DeleteProductImage(ctx context.Context, productID, imageID int) (models.ProductImage, error)
+}
+
+// InventoryStore covers product stock and the ledger of changes to it.
+type InventoryStore interface {
+	GetStock(ctx context.Context, productID int) (models.StockLevel, error)
+	AdjustStock(ctx context.Context, productID, variantID, delta int, reason string, actorID int) (models.InventoryEntry, error)
+	ListInventoryLedger(ctx context.Context, productID int, page PageRequest) (models.Page[models.InventoryEntry], error)
+}
+
+// UserStore covers accounts and login.
+type UserStore interface {
+	GetAllUsers(ctx context.Context, page PageRequest) (models.Page[models.Users], error)
+	GetUser(ctx context.Context, id int) (models.Users, error)
+	CreateUser(ctx context.Context, user models.Users) (models.Users, error)
+	LoginUser(ctx context.Context, email, password string) (models.TokenPair, error)
+	RefreshSession(ctx context.Context, refreshToken string) (models.TokenPair, error)
+	Logout(ctx context.Context, userID int, jti string, expiresAt time.Time, refreshToken string) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	SetUserRole(ctx context.Context, userID int, role string) (models.Users, error)
+	SetUserAddress(ctx context.Context, userID int, a models.Address) (models.Users, error)
+}
+
+// Methods that take a userID only see that user's rows: a cart, order or card
+// belonging to someone else is reported as ErrNotFound, exactly like one that
+// does not exist.
+
+// CartStore covers each user's cart and the products placed in it. A user has
+// one cart, created the first time it is needed. QuoteCart prices a cart
+// exactly as Checkout will, and fails the same way.
+type CartStore interface {
+	AddCart(ctx context.Context, userID int) (models.Cart, error)
+	AddCartProduct(ctx context.Context, userID int, cp models.CartProduct) (models.CartProduct, error)
+	UpdateCartProduct(ctx context.Context, userID, cpID, quantity int) (models.CartProduct, error)
+	RemoveCartProduct(ctx context.Context, userID, cpID int) error
+	ClearCart(ctx context.Context, userID int) error
+	GetCart(ctx context.Context, userID int) (models.CartView, error)
+	QuoteCart(ctx context.Context, userID int, d models.Delivery) (models.Quote, error)
+}
+
+// GuestCartStore covers the carts of anonymous visitors, named by the guest
+// id their guest token carries. A guest cart expires after the configured TTL
+// and is merged into the user's cart when the visitor logs in or registers.
+type GuestCartStore interface {
+	StartGuestCart(ctx context.Context) (models.GuestCart, error)
+	GetGuestCart(ctx context.Context, guestID string) (models.CartView, error)
+	AddGuestCartProduct(ctx context.Context, guestID string, cp models.CartProduct) (models.CartProduct, error)
+	UpdateGuestCartProduct(ctx context.Context, guestID string, cpID, quantity int) (models.CartProduct, error)
+	RemoveGuestCartProduct(ctx context.Context, guestID string, cpID int) error
+	ClearGuestCart(ctx context.Context, guestID string) error
+	MergeGuestCart(ctx context.Context, guestID string, userID int) error
+	ExpireGuestCarts(ctx context.Context) (int, error)
+}
+
+// OrderStore covers orders, their lines and a user's order history. Pending
+// orders hold stock for their lines; ExpireReservations cancels the ones whose
+// hold has run out.
+type OrderStore interface {
+	GetOrder(ctx context.Context, userID, orderID int) (models.Orders, error)
+	FindOrder(ctx context.Context, orderID int) (models.Orders, error)
+	GetOrderItems(ctx context.Context, orderID int) ([]models.OrderProduct, error)
+	GetHistory(ctx context.Context, userID int, page PageRequest) (models.Page[models.OrderProduct], error)
+	Checkout(ctx context.Context, userID int, d models.Delivery) (models.Checkout, error)
+	TransitionOrder(ctx context.Context, orderID int, to string, actorID int, note string) (models.Orders, error)
+	GetOrderTimeline(ctx context.Context, orderID int) ([]models.OrderStatusChange, error)
+	ExpireReservations(ctx context.Context) (int, error)
+}
+
+// CouponStore covers discount codes and applying them to a user's cart. Codes
+// are unique; writes that break that fail with ErrConflict. A coupon applied
+// to a cart is checked again, and its discounts recorded on the order, at
+// checkout.
+type CouponStore interface {
+	ListCoupons(ctx context.Context, page PageRequest) (models.Page[models.Coupon], error)
+	GetCoupon(ctx context.Context, id int) (models.Coupon, error)
+	CreateCoupon(ctx context.Context, c models.Coupon) (models.Coupon, error)
+	UpdateCoupon(ctx context.Context, c models.Coupon) (models.Coupon, error)
+	DeleteCoupon(ctx context.Context, id int) error
+	ApplyCartCoupon(ctx context.Context, userID int, code string) (models.CartSummary, error)
+	RemoveCartCoupon(ctx context.Context, userID int) error
+}
+
+// CreditCardStore covers the cards saved on a user's account. Cards arrive
+// already tokenized; the store never sees a card number.
+type CreditCardStore interface {
+	AddCreditCard(ctx context.Context, userID int, card models.CreditCard) (models.CreditCard, error)
+	ListCreditCards(ctx context.Context, userID int) ([]models.CreditCard, error)
+	GetCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error)
+	GetDefaultCreditCard(ctx context.Context, userID int) (models.CreditCard, error)
+	SetDefaultCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error)
+	DeleteCreditCard(ctx context.Context, userID, cardID int) (models.CreditCard, error)
+}
+
+// PaymentStore records payments and settles the orders they pay for.
+type PaymentStore interface {
+	CreatePayment(ctx context.Context, p models.Payment) (models.Payment, error)
+	GetPayment(ctx context.Context, paymentID int) (models.Payment, error)
+	ListOrderPayments(ctx context.Context, orderID int) ([]models.Payment, error)
+	SetPaymentStatus(ctx context.Context, paymentID int, status, providerRef string) error
+	MarkPaymentCaptured(ctx context.Context, paymentID int, providerRef string, actorID int) (models.Payment, error)
+	ClaimRefund(ctx context.Context, paymentID int) (models.Payment, error)
+	MarkPaymentRefunded(ctx context.Context, paymentID int, actorID int) (models.Payment, error)
+}
+
+var (
+	_ ProductStore    = (*ProductRepository)(nil)
+	_ CatalogStore    = (*ProductRepository)(nil)
+	_ VariantStore    = (*ProductRepository)(nil)
+	_ ImageStore      = (*ProductRepository)(nil)
+	_ InventoryStore  = (*ProductRepository)(nil)
+	_ UserStore       = (*UserRepository)(nil)
+	_ CartStore       = (*UserRepository)(nil)
+	_ GuestCartStore  = (*UserRepository)(nil)
+	_ OrderStore      = (*UserRepository)(nil)
+	_ CouponStore     = (*UserRepository)(nil)
+	_ CreditCardStore = (*UserRepository)(nil)
+	_ PaymentStore    = (*PaymentRepository)(nil)
+)
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"my-go-project/models"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for a refresh token that is unknown or
+	// expired.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already
+	// exchanged or revoked is presented again. Its whole family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// TokenSigner signs access token claims; auth.KeyManager implements it.
+type TokenSigner interface {
+	Sign(claims jwt.Claims) (string, error)
+}
+
+// signToken issues an access JWT for user valid for ttl. Every token gets a
+// random jti so it can be revoked on its own.
+func signToken(user models.Users, signer TokenSigner, ttl time.Duration) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := models.JWTClaims{
+		UserID:   user.User_id,
+		UserName: user.User_name,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	signedToken, err := signer.Sign(claims)
+	if err != nil {
+		return "", errors.New("failed to grnerate token")
+	}
+
+	return signedToken, nil
+}
+
+// signGuestToken issues the guest token of the guest cart guestID, valid
+// until expiresAt. It names no user, so it is never accepted as an access
+// token.
+func signGuestToken(guestID string, signer TokenSigner, expiresAt time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Subject:   guestID,
+		Audience:  jwt.ClaimStrings{models.GuestAudience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+
+	signedToken, err := signer.Sign(claims)
+	if err != nil {
+		return "", errors.New("failed to generate guest token")
+	}
+	return signedToken, nil
+}
+
+// randomToken returns n random bytes, URL-safe base64 encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored, so a database leak does not
+// hand out live sessions.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"errors"
+	"my-go-project/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrVariantRequired is returned when a product that has variants is
+	// added to a cart or order without naming one.
+	ErrVariantRequired = errors.New("product has variants; a variant is required")
+	// ErrUnknownVariant is returned when a variant does not exist or belongs
+	// to another product.
+	ErrUnknownVariant = errors.New("unknown variant")
+)
+
+// Limits on variant fields.
+const (
+	maxSkuLen         = 64
+	maxVariantOptions = 5
+	maxOptionLen      = 50
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidSku reports whether s is a usable SKU: letters, digits, dots, dashes
+// and underscores, starting with a letter or digit.
+func ValidSku(s string) bool {
+	return len(s) <= maxSkuLen && skuPattern.MatchString(s)
+}
+
+// NormalizeOptions trims variant option names and values and lowercases the
+// names, so "Size" and " size" are the same option. It reports false if a name
+// or value is empty or too long, two names collide, or there are too many.
+func NormalizeOptions(options map[string]string) (map[string]string, bool) {
+	if len(options) > maxVariantOptions {
+		return nil, false
+	}
+	out := make(map[string]string, len(options))
+	for name, value := range options {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" || len(name) > maxOptionLen || len(value) > maxOptionLen {
+			return nil, false
+		}
+		if _, dup := out[name]; dup {
+			return nil, false
+		}
+		out[name] = value
+	}
+	return out, true
+}
+
+// VariantOptions builds a product's variant matrix: each option name with the
+// values its variants take, in the order the variants list them. It returns
+// nil when there are no variants.
+func VariantOptions(variants []models.ProductVariant) map[string][]string {
+	if len(variants) == 0 {
+		return nil
+	}
+	matrix := map[string][]string{}
+	for _, v := range variants {
+		names := make([]string, 0, len(v.Options))
+		for name := range v.Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !containsString(matrix[name], v.Options[name]) {
+				matrix[name] = append(matrix[name], v.Options[name])
+			}
+		}
+	}
+	return matrix
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOptions reports whether two option sets are equal.
+func sameOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if bv, ok := b[name]; !ok || bv != value {
+			return false
+		}
+	}
+	return true
+}
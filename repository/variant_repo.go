@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"my-go-project/models"
+	"my-go-project/money"
+)
+
+const variantColumns = `variant_id, product_id, sku, options, price, currency, stock, img_url`
+
+func scanVariant(row pgx.Row) (models.ProductVariant, error) {
+	var v models.ProductVariant
+	var amount *int64
+	var currency *string
+	err := row.Scan(&v.Variant_id, &v.Product_id, &v.Sku, &v.Options, &amount, &currency, &v.Stock, &v.Img_url)
+	if amount != nil && currency != nil {
+		v.Price = &money.Money{Amount: *amount, Currency: *currency}
+	}
+	return v, err
+}
+
+// variantPrice splits a variant's price override into its price and currency
+// columns, both NULL when the variant sells at the product price.
+func variantPrice(v models.ProductVariant) (amount *int64, currency *string) {
+	if v.Price == nil {
+		return nil, nil
+	}
+	return &v.Price.Amount, &v.Price.Currency
+}
+
+// productVariants loads the variants of productIDs, keyed by product, each
+// list in variant_id order.
+func (r *ProductRepository) productVariants(ctx context.Context, productIDs []int) (map[int][]models.ProductVariant, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+variantColumns+` FROM product_variants WHERE product_id = ANY($1) ORDER BY product_id, variant_id`,
+		productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := map[int][]models.ProductVariant{}
+	for rows.Next() {
+		v, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants[v.Product_id] = append(variants[v.Product_id], v)
+	}
+	return variants, rows.Err()
+}
+
+// ***************************list variants*********************************
+func (r *ProductRepository) ListVariants(ctx context.Context, productID int) ([]models.ProductVariant, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE product_id = $1)`, productID).Scan(&exists); err != nil {
+		return nil, dbError(err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	variants, err := r.productVariants(ctx, []int{productID})
+	if err != nil {
+		log.Println("Error reading variants:", err)
+		return nil, dbError(err)
+	}
+	if variants[productID] == nil {
+		return []models.ProductVariant{}, nil
+	}
+	return variants[productID], nil
+}
+
+// ***************************create variant*********************************
+// CreateVariant adds a variant to v.Product_id with no stock; stock arrives
+// through AdjustStock. It returns ErrNotFound if the product does not exist
+// and ErrConflict if the SKU or the option set is already taken.
+func (r *ProductRepository) CreateVariant(ctx context.Context, v models.ProductVariant) (models.ProductVariant, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// inserting through the product row turns a missing product into no rows
+	query := `INSERT INTO product_variants (product_id, sku, options, price, currency, img_url)
+			  SELECT p.product_id, $2, $3, $4, $5, $6 FROM products p WHERE p.product_id = $1
+			  RETURNING variant_id`
+	v.Stock = 0
+	amount, currency := variantPrice(v)
+	err := r.db.QueryRow(ctx, query, v.Product_id, v.Sku, v.Options, amount, currency, v.Img_url).Scan(&v.Variant_id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ProductVariant{}, ErrNotFound
+	}
+	if err != nil {
+		log.Println("Error inserting variant:", err)
+		return models.ProductVariant{}, dbError(err)
+	}
+	return v, nil
+}
+
+// ***************************update variant*********************************
+// UpdateVariant changes a variant's SKU, options, price and image. Stock is
+// left alone.
+func (r *ProductRepository) UpdateVariant(ctx context.Context, v models.ProductVariant) (models.ProductVariant, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	query := `UPDATE product_variants SET sku = $3, options = $4, price = $5, currency = $6, img_url = $7
+			  WHERE variant_id = $1 AND product_id = $2
+			  RETURNING stock`
+	amount, currency := variantPrice(v)
+	err := r.db.QueryRow(ctx, query, v.Variant_id, v.Product_id, v.Sku, v.Options, amount, currency, v.Img_url).Scan(&v.Stock)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ProductVariant{}, ErrNotFound
+	}
+	if err != nil {
+		log.Println("Error updating variant:", err)
+		return models.ProductVariant{}, dbError(err)
+	}
+	return v, nil
+}
+
+// ***************************delete variant*********************************
+// DeleteVariant removes a variant and the cart lines holding it. A variant
+// that has been ordered cannot be deleted.
+func (r *ProductRepository) DeleteVariant(ctx context.Context, productID, variantID int) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM product_variants WHERE variant_id = $1 AND product_id = $2`, variantID, productID)
+	if err != nil {
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
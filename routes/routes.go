@@ -2,40 +2,146 @@ package routes
 
 import (
 	"github.com/gorilla/mux"
+	"my-go-project/apierror"
 	"my-go-project/handlers"
 	"my-go-project/middlewares"
+	"my-go-project/models"
 	"net/http"
 )
 
-func SetupRoutes(productHandler *handlers.ProductHandler, userHandler *handlers.UserHandler) *mux.Router {
+func SetupRoutes(productHandler *handlers.ProductHandler, userHandler *handlers.UserHandler, paymentHandler *handlers.PaymentHandler, catalogHandler *handlers.CatalogHandler, inventoryHandler *handlers.InventoryHandler, variantHandler *handlers.VariantHandler, imageHandler *handlers.ImageHandler, couponHandler *handlers.CouponHandler, jwksHandler *handlers.JWKSHandler, media http.Handler, jwtAuth func(http.Handler) http.Handler, guestAuth func(http.Handler) http.Handler) *mux.Router {
 	r := mux.NewRouter()
 
+	// ✅ every response, errors included, carries an X-Request-ID
+	r.Use(middlewares.RequestID)
+	r.NotFoundHandler = middlewares.RequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		apierror.Write(w, req, http.StatusNotFound, "not_found", "Route not found", nil)
+	}))
+	r.MethodNotAllowedHandler = middlewares.RequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		apierror.Write(w, req, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed", nil)
+	}))
+
+	// ✅ public keys for services verifying our tokens
+	r.HandleFunc("/.well-known/jwks.json", jwksHandler.ServeJWKS).Methods("GET")
+
+	// staff and admin sit behind the token check and then the role check, so a
+	// missing token is a 401 and a customer token is a 403
+	staff := func(h http.HandlerFunc) http.Handler {
+		return jwtAuth(middlewares.RequireRole(models.RoleStaff, models.RoleAdmin)(h))
+	}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return jwtAuth(middlewares.RequireRole(models.RoleAdmin)(h))
+	}
+
 	// ✅ endpoint for admin
 	productRoutes := r.PathPrefix("/products").Subrouter()
 	productRoutes.HandleFunc("", productHandler.GetProductsHandler).Methods("GET")
-	productRoutes.HandleFunc("", productHandler.CreateProductHandler).Methods("POST")
-	productRoutes.HandleFunc("/{id}", productHandler.UpdateProductHandler).Methods("PUT")
-	productRoutes.HandleFunc("/{id}", productHandler.DeleteProductHandler).Methods("DELETE")
-	productRoutes.HandleFunc("/admin/{username}", productHandler.GetProductSalesHandler).Methods("GET")
+	productRoutes.Handle("", staff(productHandler.CreateProductHandler)).Methods("POST")
+	productRoutes.HandleFunc("/search", productHandler.SearchProductsHandler).Methods("GET")
+	productRoutes.HandleFunc("/suggest", productHandler.SuggestProductsHandler).Methods("GET")
+	productRoutes.HandleFunc("/{id:[0-9]+}", productHandler.GetProductHandler).Methods("GET")
+	productRoutes.Handle("/{id}", staff(productHandler.UpdateProductHandler)).Methods("PUT")
+	productRoutes.Handle("/{id}", staff(productHandler.DeleteProductHandler)).Methods("DELETE")
+	productRoutes.Handle("/admin/{username}", admin(productHandler.GetProductSalesHandler)).Methods("GET")
+
+	productRoutes.Handle("/{id:[0-9]+}/categories", staff(catalogHandler.SetProductCategoriesHandler)).Methods("PUT")
+	productRoutes.Handle("/{id:[0-9]+}/tags", staff(catalogHandler.SetProductTagsHandler)).Methods("PUT")
+
+	// ✅ variants (sizes, colours, ...) of a product
+	productRoutes.HandleFunc("/{id:[0-9]+}/variants", variantHandler.ListVariantsHandler).Methods("GET")
+	productRoutes.Handle("/{id:[0-9]+}/variants", staff(variantHandler.CreateVariantHandler)).Methods("POST")
+	productRoutes.Handle("/{id:[0-9]+}/variants/{variant_id:[0-9]+}", staff(variantHandler.UpdateVariantHandler)).Methods("PUT")
+	productRoutes.Handle("/{id:[0-9]+}/variants/{variant_id:[0-9]+}", staff(variantHandler.DeleteVariantHandler)).Methods("DELETE")
+
+	// ✅ image gallery of a product
+	productRoutes.HandleFunc("/{id:[0-9]+}/images", imageHandler.ListImagesHandler).Methods("GET")
+	productRoutes.Handle("/{id:[0-9]+}/images", staff(imageHandler.UploadImageHandler)).Methods("POST")
+	productRoutes.Handle("/{id:[0-9]+}/images/{image_id:[0-9]+}", staff(imageHandler.UpdateImageHandler)).Methods("PUT")
+	productRoutes.Handle("/{id:[0-9]+}/images/{image_id:[0-9]+}", staff(imageHandler.DeleteImageHandler)).Methods("DELETE")
+
+	// ✅ stock levels and adjustments (admin)
+	productRoutes.Handle("/{id:[0-9]+}/inventory", admin(inventoryHandler.GetStockHandler)).Methods("GET")
+	productRoutes.Handle("/{id:[0-9]+}/inventory/adjustments", admin(inventoryHandler.AdjustStockHandler)).Methods("POST")
+	productRoutes.Handle("/{id:[0-9]+}/inventory/ledger", admin(inventoryHandler.LedgerHandler)).Methods("GET")
+
+	// ✅ uploaded files, when they are stored locally rather than in a bucket
+	if media != nil {
+		r.PathPrefix("/media/").Handler(http.StripPrefix("/media", media)).Methods("GET", "HEAD")
+	}
+
+	// ✅ catalog browsing; categories and tags are managed by admins
+	r.HandleFunc("/categories", catalogHandler.ListCategoriesHandler).Methods("GET")
+	r.Handle("/categories", admin(catalogHandler.CreateCategoryHandler)).Methods("POST")
+	r.HandleFunc("/categories/{slug}", catalogHandler.GetCategoryHandler).Methods("GET")
+	r.HandleFunc("/categories/{slug}/products", catalogHandler.CategoryProductsHandler).Methods("GET")
+	r.Handle("/categories/{id:[0-9]+}", admin(catalogHandler.UpdateCategoryHandler)).Methods("PUT")
+	r.Handle("/categories/{id:[0-9]+}", admin(catalogHandler.DeleteCategoryHandler)).Methods("DELETE")
+	r.HandleFunc("/tags", catalogHandler.ListTagsHandler).Methods("GET")
+	r.Handle("/tags", admin(catalogHandler.CreateTagHandler)).Methods("POST")
+	r.Handle("/tags/{id:[0-9]+}", admin(catalogHandler.UpdateTagHandler)).Methods("PUT")
+	r.Handle("/tags/{id:[0-9]+}", admin(catalogHandler.DeleteTagHandler)).Methods("DELETE")
 
 	// ✅ endpoint for users
 	userRoutes := r.PathPrefix("/users").Subrouter()
-	userRoutes.HandleFunc("", userHandler.GetUsersHandler).Methods("GET")
-	userRoutes.HandleFunc("/register", userHandler.RegisterHandler).Methods("POST")
-	userRoutes.HandleFunc("/login", userHandler.LoginHandler).Methods("POST")
-	userRoutes.Handle("/cart", middlewares.JWTMiddleware(http.HandlerFunc(userHandler.AddCartHandler))).Methods("POST")
-	userRoutes.Handle("/cart", middlewares.JWTMiddleware(http.HandlerFunc(userHandler.GetCartHandler))).Methods("GET")
-	userRoutes.HandleFunc("/addOrder-product", userHandler.AddOrderProductHandler).Methods("POST")
-	userRoutes.HandleFunc("/addOrder", userHandler.AddOrderHandler).Methods("POST")
+	userRoutes.Handle("", admin(userHandler.GetUsersHandler)).Methods("GET")
+	userRoutes.Handle("/register", guestAuth(http.HandlerFunc(userHandler.RegisterHandler))).Methods("POST")
+	userRoutes.Handle("/login", guestAuth(http.HandlerFunc(userHandler.LoginHandler))).Methods("POST")
+	userRoutes.HandleFunc("/refresh", userHandler.RefreshHandler).Methods("POST")
+	userRoutes.Handle("/logout", jwtAuth(http.HandlerFunc(userHandler.LogoutHandler))).Methods("POST")
+	userRoutes.Handle("/{id:[0-9]+}", jwtAuth(http.HandlerFunc(userHandler.GetUserHandler))).Methods("GET")
+	userRoutes.Handle("/{id:[0-9]+}/role", admin(userHandler.SetUserRoleHandler)).Methods("PUT")
+	userRoutes.Handle("/address", jwtAuth(http.HandlerFunc(userHandler.SetAddressHandler))).Methods("PUT")
+	userRoutes.Handle("/cart", jwtAuth(http.HandlerFunc(userHandler.AddCartHandler))).Methods("POST")
+	userRoutes.Handle("/cart", jwtAuth(http.HandlerFunc(userHandler.GetCartHandler))).Methods("GET")
+	userRoutes.Handle("/cart", jwtAuth(http.HandlerFunc(userHandler.ClearCartHandler))).Methods("DELETE")
+	userRoutes.Handle("/cart/items", jwtAuth(http.HandlerFunc(userHandler.AddCartProductHandler))).Methods("POST")
+	userRoutes.Handle("/cart/items/{id:[0-9]+}", jwtAuth(http.HandlerFunc(userHandler.UpdateCartProductHandler))).Methods("PUT")
+	userRoutes.Handle("/cart/items/{id:[0-9]+}", jwtAuth(http.HandlerFunc(userHandler.RemoveCartProductHandler))).Methods("DELETE")
+	userRoutes.Handle("/checkout", jwtAuth(http.HandlerFunc(userHandler.CheckoutHandler))).Methods("POST")
+	userRoutes.Handle("/orders/{id:[0-9]+}/cancel", jwtAuth(http.HandlerFunc(userHandler.CancelOrderHandler))).Methods("POST")
+	userRoutes.Handle("/orders/{id:[0-9]+}/timeline", jwtAuth(http.HandlerFunc(userHandler.OrderTimelineHandler))).Methods("GET")
+
+	// ✅ payments
+	userRoutes.Handle("/orders/{id:[0-9]+}/pay", jwtAuth(http.HandlerFunc(paymentHandler.PayOrderHandler))).Methods("POST")
+	userRoutes.Handle("/orders/{id:[0-9]+}/payments", jwtAuth(http.HandlerFunc(paymentHandler.ListOrderPaymentsHandler))).Methods("GET")
+	userRoutes.Handle("/orders/{id:[0-9]+}", jwtAuth(http.HandlerFunc(userHandler.GetOrderHandler))).Methods("GET")
 	// ✅ product in  cart
-	r.HandleFunc("/addProduct-cart", userHandler.AddCartProductHandler).Methods("POST")
+	r.Handle("/addProduct-cart", jwtAuth(http.HandlerFunc(userHandler.AddCartProductHandler))).Methods("POST")
+
+	// ✅ guest carts, opened with a guest token instead of a login and merged
+	// into the user's cart on login or registration
+	guestRoutes := r.PathPrefix("/guest").Subrouter()
+	guestRoutes.Handle("/cart", guestAuth(http.HandlerFunc(userHandler.StartGuestCartHandler))).Methods("POST")
+	guestRoutes.Handle("/cart", guestAuth(http.HandlerFunc(userHandler.GetGuestCartHandler))).Methods("GET")
+	guestRoutes.Handle("/cart", guestAuth(http.HandlerFunc(userHandler.ClearGuestCartHandler))).Methods("DELETE")
+	guestRoutes.Handle("/cart/items", guestAuth(http.HandlerFunc(userHandler.AddGuestCartProductHandler))).Methods("POST")
+	guestRoutes.Handle("/cart/items/{id:[0-9]+}", guestAuth(http.HandlerFunc(userHandler.UpdateGuestCartProductHandler))).Methods("PUT")
+	guestRoutes.Handle("/cart/items/{id:[0-9]+}", guestAuth(http.HandlerFunc(userHandler.RemoveGuestCartProductHandler))).Methods("DELETE")
+
+	// ✅ discount codes; admins manage them, users apply them to their cart
+	r.Handle("/cart/coupon", jwtAuth(http.HandlerFunc(couponHandler.ApplyCouponHandler))).Methods("POST")
+	r.Handle("/cart/coupon", jwtAuth(http.HandlerFunc(couponHandler.RemoveCouponHandler))).Methods("DELETE")
+
+	// ✅ shipping and tax for the cart, priced as checkout will
+	r.Handle("/cart/quote", jwtAuth(http.HandlerFunc(userHandler.QuoteHandler))).Methods("POST")
+	r.Handle("/coupons", admin(couponHandler.ListCouponsHandler)).Methods("GET")
+	r.Handle("/coupons", admin(couponHandler.CreateCouponHandler)).Methods("POST")
+	r.Handle("/coupons/{id:[0-9]+}", admin(couponHandler.GetCouponHandler)).Methods("GET")
+	r.Handle("/coupons/{id:[0-9]+}", admin(couponHandler.UpdateCouponHandler)).Methods("PUT")
+	r.Handle("/coupons/{id:[0-9]+}", admin(couponHandler.DeleteCouponHandler)).Methods("DELETE")
 
 	// ✅ endpoint for users after login
-	r.Handle("/add-credit", middlewares.JWTMiddleware(http.HandlerFunc(userHandler.AddCreditCardHandler))).Methods("POST")
-	r.HandleFunc("/credit/{card_id}", userHandler.DeleteCreditCardHandler).Methods("DELETE")
+	r.Handle("/add-credit", jwtAuth(http.HandlerFunc(userHandler.AddCreditCardHandler))).Methods("POST")
+	r.Handle("/credit", jwtAuth(http.HandlerFunc(userHandler.ListCreditCardsHandler))).Methods("GET")
+	r.Handle("/credit/{card_id}", jwtAuth(http.HandlerFunc(userHandler.DeleteCreditCardHandler))).Methods("DELETE")
+	r.Handle("/credit/{card_id}/default", jwtAuth(http.HandlerFunc(userHandler.SetDefaultCreditCardHandler))).Methods("PUT")
+
+	// ✅ order fulfilment (staff)
+	r.Handle("/orders/{id:[0-9]+}/status", staff(userHandler.AdvanceOrderHandler)).Methods("POST")
+	r.Handle("/payments/{id:[0-9]+}/refund", staff(paymentHandler.RefundPaymentHandler)).Methods("POST")
 
 	// ✅ endpoint history order
-	r.Handle("/history", middlewares.JWTMiddleware(http.HandlerFunc(userHandler.GetHistoryOrder))).Methods("GET")
+	r.Handle("/history", jwtAuth(http.HandlerFunc(userHandler.GetHistoryOrder))).Methods("GET")
 
 	return r
 }
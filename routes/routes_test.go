@@ -0,0 +1,428 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"my-go-project/auth"
+	"my-go-project/config"
+	"my-go-project/handlers"
+	"my-go-project/middlewares"
+	"my-go-project/models"
+	"my-go-project/money"
+	"my-go-project/payments"
+	"my-go-project/pricing"
+	"my-go-project/repository"
+	"my-go-project/storage"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer is the full router over a MemoryStore.
+type testServer struct {
+	t        *testing.T
+	store    *repository.MemoryStore
+	provider *countingProvider
+	router   http.Handler
+}
+
+// countingProvider is the fake provider, counting refunds and holding each
+// one briefly so that concurrent requests overlap.
+type countingProvider struct {
+	*payments.FakeProvider
+	mu      sync.Mutex
+	refunds int
+}
+
+func (p *countingProvider) Refund(ctx context.Context, reference string, amount money.Money) (payments.Result, error) {
+	p.mu.Lock()
+	p.refunds++
+	p.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	return p.FakeProvider.Refund(ctx, reference, amount)
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	jwtCfg := config.JWTConfig{Secret: "0123456789abcdef", TTL: time.Hour, RefreshTTL: 24 * time.Hour}
+	keys := auth.NewHMACKeyManager([]byte(jwtCfg.Secret))
+	calc := pricing.NewCalculator(
+		config.ShippingConfig{Rates: []config.ShippingRate{{Method: "standard", Name: "Standard", Kind: "flat", Currency: "USD", Amount: 500}}},
+		config.TaxConfig{Rates: []config.TaxRate{{Name: "CA sales", Country: "US", Region: "CA", Percent: 7.25}}},
+	)
+	store := repository.NewMemoryStore(jwtCfg,
+		config.InventoryConfig{HoldTTL: time.Minute, SweepInterval: time.Minute},
+		config.GuestCartConfig{TTL: time.Hour, SweepInterval: time.Minute, Merge: "sum"},
+		keys, calc)
+
+	blobs, err := storage.NewLocalStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := payments.NewLocalVault(make([]byte, 32), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingProvider{FakeProvider: payments.NewFakeProvider()}
+
+	router := SetupRoutes(
+		handlers.NewProductHandler(store, blobs),
+		handlers.NewUserHandler(store, store, store, store, store, vault, blobs),
+		handlers.NewPaymentHandler(store, store, store, provider, "USD"),
+		handlers.NewCatalogHandler(store, store),
+		handlers.NewInventoryHandler(store),
+		handlers.NewVariantHandler(store),
+		handlers.NewImageHandler(store, blobs, 1<<20, 4_000_000),
+		handlers.NewCouponHandler(store),
+		handlers.NewJWKSHandler(keys),
+		blobs.Handler(),
+		middlewares.JWTMiddleware(keys, store),
+		middlewares.GuestToken(keys),
+	)
+	return &testServer{t: t, store: store, provider: provider, router: router}
+}
+
+// do sends a request with body as JSON, authorized by token when it is set.
+func (ts *testServer) do(method, path, body, token string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+// expect fails the test unless w has status code, and decodes its body into v
+// when v is not nil.
+func (ts *testServer) expect(w *httptest.ResponseRecorder, code int, v interface{}) {
+	ts.t.Helper()
+	if w.Code != code {
+		ts.t.Fatalf("status = %d, want %d: %s", w.Code, code, w.Body.String())
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			ts.t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+}
+
+// addUser creates a user with role and returns their id and access token.
+func (ts *testServer) addUser(name, role string) (int, string) {
+	ts.t.Helper()
+	ctx := context.Background()
+	user, err := ts.store.CreateUser(ctx, models.Users{
+		User_name: name,
+		Email:     name + "@example.com",
+		Password:  "secret-" + name,
+		Address:   models.Address{Line1: "1 Main St", City: "Los Angeles", Region: "CA", Country: "US"},
+	})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if role != models.RoleCustomer {
+		if _, err := ts.store.SetUserRole(ctx, user.User_id, role); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+
+	var pair struct {
+		Token string `json:"token"`
+	}
+	ts.expect(ts.do("POST", "/users/login", `{"Email":"`+user.Email+`","Password":"secret-`+name+`"}`, ""), http.StatusOK, &pair)
+	return user.User_id, pair.Token
+}
+
+// addProduct creates a product priced at cents USD with stock on hand.
+func (ts *testServer) addProduct(adminToken string, cents, stock int) int {
+	ts.t.Helper()
+	var p models.Products
+	body := `{"Product_name":"Tee","Price":{"Amount":` + strconv.Itoa(cents) + `,"Currency":"USD"}}`
+	ts.expect(ts.do("POST", "/products", body, adminToken), http.StatusCreated, &p)
+	path := "/products/" + strconv.Itoa(p.Product_id) + "/inventory/adjustments"
+	ts.expect(ts.do("POST", path, `{"Delta":`+strconv.Itoa(stock)+`,"Reason":"restock"}`, adminToken), http.StatusOK, nil)
+	return p.Product_id
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	ts := newTestServer(t)
+	w := ts.do("POST", "/users/register", `{"User_name":"alice","Email":"alice@example.com","Password":"secret","Address":{"Line1":"1 Main St","City":"Los Angeles","Region":"CA","Country":"US"}}`, "")
+	var created struct {
+		User_id int `json:"user_id"`
+	}
+	ts.expect(w, http.StatusCreated, &created)
+	if loc := w.Header().Get("Location"); created.User_id == 0 || loc != "/users/"+strconv.Itoa(created.User_id) {
+		t.Fatalf("created user %d at %q", created.User_id, loc)
+	}
+	ts.expect(ts.do("POST", "/users/register", `{"User_id":7,"User_name":"bob","Email":"bob@example.com","Password":"secret","Address":{"Line1":"1 Main St","City":"Los Angeles","Region":"CA","Country":"US"}}`, ""), http.StatusBadRequest, nil)
+	ts.expect(ts.do("POST", "/users/register", `{"User_name":"bob","Email":"bob@example.com"}`, ""), http.StatusBadRequest, nil)
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"right password", `{"Email":"alice@example.com","Password":"secret"}`, http.StatusOK},
+		{"wrong password", `{"Email":"alice@example.com","Password":"guess"}`, http.StatusUnauthorized},
+		{"unknown email", `{"Email":"nobody@example.com","Password":"secret"}`, http.StatusUnauthorized},
+		{"missing password", `{"Email":"alice@example.com"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.expect(ts.do("POST", "/users/login", tt.body, ""), tt.code, nil)
+		})
+	}
+}
+
+func TestGetUserSelfOrAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.addUser("admin", models.RoleAdmin)
+	aliceID, aliceToken := ts.addUser("alice", models.RoleCustomer)
+	bobID, _ := ts.addUser("bob", models.RoleCustomer)
+
+	tests := []struct {
+		name  string
+		id    int
+		token string
+		code  int
+	}{
+		{"no token", aliceID, "", http.StatusUnauthorized},
+		{"bad token", aliceID, "not-a-token", http.StatusUnauthorized},
+		{"self", aliceID, aliceToken, http.StatusOK},
+		{"another user", bobID, aliceToken, http.StatusNotFound},
+		{"missing user", 999, aliceToken, http.StatusNotFound},
+		{"admin", bobID, adminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := ts.do("GET", "/users/"+strconv.Itoa(tt.id), "", tt.token)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateAndGetProducts(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.addUser("admin", models.RoleAdmin)
+	id := ts.addProduct(adminToken, 1500, 5)
+	ts.expect(ts.do("POST", "/products", `{"Product_name":"Mug","Price":{"Amount":0,"Currency":"USD"}}`, adminToken), http.StatusBadRequest, nil)
+	ts.expect(ts.do("POST", "/products", `{"Product_id":9,"Product_name":"Mug","Price":{"Amount":900,"Currency":"USD"}}`, adminToken), http.StatusBadRequest, nil)
+
+	var products models.Page[models.Products]
+	ts.expect(ts.do("GET", "/products", "", ""), http.StatusOK, &products)
+	if len(products.Items) != 1 || products.Items[0].Product_id != id {
+		t.Fatalf("products = %+v, want product %d only", products.Items, id)
+	}
+
+	var p models.Products
+	ts.expect(ts.do("GET", "/products/"+strconv.Itoa(id), "", ""), http.StatusOK, &p)
+	if p.Product_name != "Tee" || p.Price.Amount != 1500 {
+		t.Fatalf("product = %+v, want the Tee at 1500", p)
+	}
+	ts.expect(ts.do("GET", "/products/999", "", ""), http.StatusNotFound, nil)
+}
+
+func TestProductWritesNeedStaff(t *testing.T) {
+	ts := newTestServer(t)
+	_, staffToken := ts.addUser("staff", models.RoleStaff)
+	_, customerToken := ts.addUser("carol", models.RoleCustomer)
+	body := `{"Product_name":"Mug","Price":{"Amount":999,"Currency":"USD"}}`
+
+	ts.expect(ts.do("POST", "/products", body, ""), http.StatusUnauthorized, nil)
+	ts.expect(ts.do("POST", "/products", body, customerToken), http.StatusForbidden, nil)
+	ts.expect(ts.do("POST", "/products", body, staffToken), http.StatusCreated, nil)
+}
+
+func TestCartNeedsToken(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.addUser("admin", models.RoleAdmin)
+	_, token := ts.addUser("carol", models.RoleCustomer)
+	_, otherToken := ts.addUser("dave", models.RoleCustomer)
+	productID := ts.addProduct(adminToken, 1500, 5)
+	body := `{"Product_id":` + strconv.Itoa(productID) + `,"Quantity":2}`
+
+	ts.expect(ts.do("POST", "/users/cart/items", body, ""), http.StatusUnauthorized, nil)
+	ts.expect(ts.do("POST", "/users/cart/items", body, "not-a-token"), http.StatusUnauthorized, nil)
+	var line models.CartProduct
+	ts.expect(ts.do("POST", "/users/cart/items", body, token), http.StatusCreated, &line)
+	// adding the product again adds to its line
+	ts.expect(ts.do("POST", "/users/cart/items", `{"Product_id":`+strconv.Itoa(productID)+`,"Quantity":1}`, token), http.StatusCreated, nil)
+
+	var cart models.CartView
+	ts.expect(ts.do("GET", "/users/cart", "", token), http.StatusOK, &cart)
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 3 || cart.Subtotal.Amount != 4500 {
+		t.Fatalf("cart = %+v, want one line of 3 at 45.00", cart)
+	}
+
+	// another user's token cannot reach the line
+	linePath := "/users/cart/items/" + strconv.Itoa(line.CP_id)
+	ts.expect(ts.do("PUT", linePath, `{"Quantity":1}`, otherToken), http.StatusNotFound, nil)
+	var empty struct{ Items []json.RawMessage }
+	ts.expect(ts.do("GET", "/users/cart", "", otherToken), http.StatusOK, &empty)
+	if len(empty.Items) != 0 {
+		t.Fatalf("other user's cart has %d lines, want none", len(empty.Items))
+	}
+}
+
+func TestCheckoutPayAndRefund(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.addUser("admin", models.RoleAdmin)
+	_, token := ts.addUser("dave", models.RoleCustomer)
+	productID := ts.addProduct(adminToken, 2000, 10)
+
+	ts.expect(ts.do("POST", "/users/cart/items", `{"Product_id":`+strconv.Itoa(productID)+`,"Quantity":2}`, token), http.StatusCreated, nil)
+	var checkout models.Checkout
+	ts.expect(ts.do("POST", "/users/checkout", "", token), http.StatusCreated, &checkout)
+	// 2 x 20.00 + 5.00 shipping + 7.25% on the goods
+	if want := int64(4000 + 500 + 290); checkout.Order.TotalPrice.Amount != want {
+		t.Fatalf("order total = %d, want %d", checkout.Order.TotalPrice.Amount, want)
+	}
+
+	ts.expect(ts.do("POST", "/add-credit", `{"Card_num":"4242424242424242","Exp_month":12,"Exp_year":2099,"Holder_name":"Dave D"}`, token), http.StatusCreated, nil)
+	orderPath := "/users/orders/" + strconv.Itoa(checkout.Order.Order_id)
+	var payment models.Payment
+	ts.expect(ts.do("POST", orderPath+"/pay", "", token), http.StatusCreated, &payment)
+	if payment.Amount != checkout.Order.TotalPrice || payment.Status != models.PaymentCaptured {
+		t.Fatalf("payment = %+v, want %v captured", payment, checkout.Order.TotalPrice)
+	}
+	ts.expect(ts.do("POST", orderPath+"/pay", "", token), http.StatusConflict, nil)
+
+	refund := "/payments/" + strconv.Itoa(payment.Payment_id) + "/refund"
+	ts.expect(ts.do("POST", refund, "", token), http.StatusForbidden, nil)
+	ts.expect(ts.do("POST", refund, "", adminToken), http.StatusOK, &payment)
+	if payment.Status != models.PaymentRefunded {
+		t.Fatalf("payment status = %q, want %q", payment.Status, models.PaymentRefunded)
+	}
+
+	var order models.Orders
+	ts.expect(ts.do("GET", orderPath, "", token), http.StatusOK, &order)
+	if order.Status != models.OrderRefunded {
+		t.Fatalf("order status = %q, want %q", order.Status, models.OrderRefunded)
+	}
+}
+
+func TestConcurrentRefundsPayOutOnce(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.addUser("admin", models.RoleAdmin)
+	_, token := ts.addUser("erin", models.RoleCustomer)
+	productID := ts.addProduct(adminToken, 2000, 10)
+
+	ts.expect(ts.do("POST", "/users/cart/items", `{"Product_id":`+strconv.Itoa(productID)+`,"Quantity":1}`, token), http.StatusCreated, nil)
+	var checkout models.Checkout
+	ts.expect(ts.do("POST", "/users/checkout", "", token), http.StatusCreated, &checkout)
+	ts.expect(ts.do("POST", "/add-credit", `{"Card_num":"4242424242424242","Exp_month":12,"Exp_year":2099,"Holder_name":"Erin E"}`, token), http.StatusCreated, nil)
+	var payment models.Payment
+	ts.expect(ts.do("POST", "/users/orders/"+strconv.Itoa(checkout.Order.Order_id)+"/pay", "", token), http.StatusCreated, &payment)
+
+	refund := "/payments/" + strconv.Itoa(payment.Payment_id) + "/refund"
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = ts.do("POST", refund, "", adminToken).Code
+		}(i)
+	}
+	wg.Wait()
+
+	ok, conflict := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusConflict:
+			conflict++
+		}
+	}
+	if ok != 1 || conflict != 1 {
+		t.Fatalf("statuses = %v, want one 200 and one 409", codes)
+	}
+	if ts.provider.refunds != 1 {
+		t.Fatalf("provider refunded %d times, want once", ts.provider.refunds)
+	}
+}
+
+func TestGuestCartMergesOnLogin(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.addUser("admin", models.RoleAdmin)
+	_, token := ts.addUser("erin", models.RoleCustomer)
+	productID := ts.addProduct(adminToken, 500, 5)
+
+	ts.expect(ts.do("POST", "/users/cart/items", `{"Product_id":`+strconv.Itoa(productID)+`,"Quantity":1}`, token), http.StatusCreated, nil)
+
+	w := ts.do("POST", "/guest/cart/items", `{"Product_id":`+strconv.Itoa(productID)+`,"Quantity":2}`, "")
+	ts.expect(w, http.StatusCreated, nil)
+	guestToken := w.Header().Get(models.GuestTokenHeader)
+	if guestToken == "" {
+		t.Fatal("no guest token handed out")
+	}
+
+	// a guest token is not an access token
+	ts.expect(ts.do("GET", "/users/cart", "", guestToken), http.StatusUnauthorized, nil)
+
+	// over TLS, so the cookie that clears the guest token must be Secure like the one that set it
+	req := httptest.NewRequest("POST", "https://shop.example.com/users/login", strings.NewReader(`{"Email":"erin@example.com","Password":"secret-erin"}`))
+	req.Header.Set(models.GuestTokenHeader, guestToken)
+	w = httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	ts.expect(w, http.StatusOK, nil)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != models.GuestCookie || cookies[0].MaxAge >= 0 || !cookies[0].Secure || !cookies[0].HttpOnly {
+		t.Fatalf("login cookies = %+v, want the guest cookie cleared with Secure and HttpOnly", cookies)
+	}
+
+	var cart models.CartView
+	ts.expect(ts.do("GET", "/users/cart", "", token), http.StatusOK, &cart)
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 3 {
+		t.Fatalf("merged cart = %+v, want one line of 3", cart.Items)
+	}
+
+	req = httptest.NewRequest("GET", "/guest/cart", nil)
+	req.Header.Set(models.GuestTokenHeader, guestToken)
+	w = httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	ts.expect(w, http.StatusNotFound, nil)
+}
+
+func TestUpdateAndDeleteProduct(t *testing.T) {
+	ts := newTestServer(t)
+	_, adminToken := ts.addUser("admin", models.RoleAdmin)
+	productID := ts.addProduct(adminToken, 1000, 1)
+	path := "/products/" + strconv.Itoa(productID)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		code int
+	}{
+		{"body without id", path, `{"Product_name":"Mug","Price":{"Amount":1200,"Currency":"USD"}}`, http.StatusOK},
+		{"body with the path id", path, `{"Product_id":` + strconv.Itoa(productID) + `,"Product_name":"Mug","Price":{"Amount":1300,"Currency":"USD"}}`, http.StatusOK},
+		{"body naming another product", path, `{"Product_id":999,"Product_name":"Mug","Price":{"Amount":1400,"Currency":"USD"}}`, http.StatusBadRequest},
+		{"unknown product", "/products/999", `{"Product_name":"Mug","Price":{"Amount":1400,"Currency":"USD"}}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.expect(ts.do("PUT", tt.path, tt.body, adminToken), tt.code, nil)
+		})
+	}
+
+	var p models.Products
+	ts.expect(ts.do("GET", path, "", ""), http.StatusOK, &p)
+	if p.Product_name != "Mug" || p.Price.Amount != 1300 {
+		t.Fatalf("product = %+v, want Mug at 1300", p)
+	}
+
+	ts.expect(ts.do("DELETE", "/products/999", "", adminToken), http.StatusNotFound, nil)
+	ts.expect(ts.do("DELETE", path, "", adminToken), http.StatusOK, nil)
+	ts.expect(ts.do("DELETE", path, "", adminToken), http.StatusNotFound, nil)
+}
@@ -0,0 +1,43 @@
+// Package storage keeps uploaded files, such as product images, behind the
+// BlobStore interface so the server can write to a local directory in
+// development and to an S3-compatible bucket in production.
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidKey is returned for a key that could escape the store's root.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores immutable blobs under slash-separated keys such as
+// "products/12/3f9a.../original.jpg".
+type BlobStore interface {
+	// Put stores data under key, replacing any blob already there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes the blob under key. A missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL is where clients can fetch the blob under key.
+	URL(key string) string
+}
+
+// ValidKey reports whether key is a relative, slash-separated path without
+// empty, "." or ".." segments.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 1024 || strings.ContainsAny(key, "\\\x00") {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// joinURL appends key to base with exactly one slash between them.
+func joinURL(base, key string) string {
+	return strings.TrimRight(base, "/") + "/" + key
+}
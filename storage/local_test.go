@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"products/1/abc.jpg", true},
+		{"a", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../secret", false},
+		{"products/../../secret", false},
+		{"products/./a.jpg", false},
+		{"products//a.jpg", false},
+		{"products/", false},
+		{`products\..\a.jpg`, false},
+		{"a\x00b", false},
+	}
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLocalStoreRefusesKeysOutsideDir(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s, err := NewLocalStore(filepath.Join(root, "media"), "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../escaped", "/tmp/escaped"} {
+		if err := s.Put(ctx, key, []byte("x"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("a file was written outside the store: %v", err)
+	}
+}
+
+func TestLocalStoreHandler(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewLocalStore(dir, "/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "products/1/a.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "products", "1", ".upload-123"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.URL("products/1/a.jpg"); got != "/media/products/1/a.jpg" {
+		t.Fatalf("URL = %q", got)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/products/1/a.jpg", http.StatusOK},
+		{"/products/1/missing.jpg", http.StatusNotFound},
+		{"/products/1/.upload-123", http.StatusNotFound},
+		{"/products/1", http.StatusNotFound},
+		{"/products/1/", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}